@@ -1,5 +1,5 @@
 os=$(uname -s)
 arch=$(uname -m)
-for cmd in "ctcheck" "emblemcheck" "emblemgen" "kid" "leafhash" "probe" "records" "rootsetupcheck"; do
+for cmd in "acme" "bundle" "ctcheck" "emblemcheck" "emblemgen" "init" "keys" "kid" "leafhash" "probe" "records" "renewd" "rollover" "rootsetupcheck" "signerd" "tokenlog"; do
   go build -o "release/$cmd-$os-$arch" "github.com/adem-wg/adem-proto/cmd/$cmd"
 done
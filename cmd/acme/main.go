@@ -0,0 +1,249 @@
+/*
+This tool obtains the configuration certificate of a root key from an ACME
+(RFC 8555) certificate authority and converts the certificate's embedded SCTs
+into the "log" claim of endorsements (cf. leafhash).
+
+The certificate is requested for the issuer's hostname and
+<kid>.adem-configuration.<host>, either with a fresh TLS key (-key-out) or for
+an existing certificate signing request (-csr), e.g., as generated by init.
+
+Challenges are answered by a built-in HTTP-01 responder listening on -http,
+or by a hook command (-hook) that is called as
+
+	HOOK present|cleanup DOMAIN NAME VALUE
+
+For dns-01, NAME is the TXT record to publish VALUE at. For http-01, NAME is
+the URL path to serve VALUE at.
+
+The ACME account key (-account-key) is generated if the file does not exist.
+To test against a local CA such as Pebble, trust its TLS certificate with
+-ca-roots.
+*/
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/adem-wg/adem-proto/pkg/acme"
+	"github.com/adem-wg/adem-proto/pkg/roots"
+	"github.com/adem-wg/adem-proto/pkg/util"
+)
+
+var directory string
+var iss string
+var kid string
+var csrPath string
+var keyOut string
+var accountKeyPath string
+var email string
+var challenge string
+var hook string
+var httpAddr string
+var caRootsPath string
+var certOut string
+var timeout time.Duration
+
+func init() {
+	flag.StringVar(&directory, "directory", "", "URL of the CA's ACME directory")
+	flag.StringVar(&iss, "iss", "", "issuer, i.e., the organization's OI, e.g., https://example.com")
+	flag.StringVar(&kid, "kid", "", "KID of the root key")
+	flag.StringVar(&csrPath, "csr", "", "path to a PEM-encoded CSR to request the certificate for; if omitted, a new TLS key is generated")
+	flag.StringVar(&keyOut, "key-out", "", "path to write the generated TLS key to")
+	flag.StringVar(&accountKeyPath, "account-key", "acme-account.pem", "path to the ACME account key; generated if it does not exist")
+	flag.StringVar(&email, "email", "", "contact email address of the ACME account")
+	flag.StringVar(&challenge, "challenge", acme.ChallengeHTTP01, "challenge type; either http-01 or dns-01")
+	flag.StringVar(&hook, "hook", "", "command to present and clean up challenges; required for dns-01")
+	flag.StringVar(&httpAddr, "http", ":80", "address to answer http-01 challenges on if no -hook is given")
+	flag.StringVar(&caRootsPath, "ca-roots", "", "path to PEM certificates to trust for the connection to the CA")
+	flag.StringVar(&certOut, "cert-out", "", "path to write the certificate chain to")
+	flag.DurationVar(&timeout, "timeout", 5*time.Minute, "time to wait for the certificate")
+}
+
+func writePEM(path string, typ string, der []byte) {
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		log.Fatalf("could not write %s: %s", path, err)
+	}
+}
+
+func loadAccountKey() crypto.Signer {
+	bs, err := os.ReadFile(accountKeyPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			log.Fatalf("could not generate account key: %s", err)
+		} else if der, err := x509.MarshalPKCS8PrivateKey(key); err != nil {
+			log.Fatalf("could not encode account key: %s", err)
+		} else {
+			writePEM(accountKeyPath, "PRIVATE KEY", der)
+			log.Printf("generated account key %s", accountKeyPath)
+		}
+		return key
+	} else if err != nil {
+		log.Fatalf("could not read account key: %s", err)
+	}
+
+	if block, _ := pem.Decode(bs); block == nil {
+		log.Fatal("could not decode account key")
+	} else if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err != nil {
+		log.Fatalf("could not parse account key: %s", err)
+	} else if signer, ok := key.(crypto.Signer); !ok {
+		log.Fatal("account key cannot sign")
+	} else {
+		return signer
+	}
+	return nil
+}
+
+// Load the CSR to request the certificate with. Checks that the CSR is valid
+// for the configuration names, if -iss and -kid were given.
+func loadCSR() []byte {
+	var names []string
+	if iss != "" || kid != "" {
+		var err error
+		if iss == "" || kid == "" {
+			log.Fatal("-iss and -kid must be given together")
+		} else if names, err = roots.ConfigurationNames(iss, kid); err != nil {
+			log.Fatalf("could not parse issuer: %s", err)
+		}
+	}
+
+	if csrPath == "" {
+		if names == nil {
+			log.Fatal("no -csr or -iss and -kid given")
+		} else if keyOut == "" {
+			log.Fatal("no -key-out given")
+		}
+		csr, key, err := acme.NewCSR(names)
+		if err != nil {
+			log.Fatalf("could not create CSR: %s", err)
+		} else if der, err := x509.MarshalPKCS8PrivateKey(key); err != nil {
+			log.Fatalf("could not encode TLS key: %s", err)
+		} else {
+			writePEM(keyOut, "PRIVATE KEY", der)
+		}
+		return csr
+	}
+
+	bs, err := os.ReadFile(csrPath)
+	if err != nil {
+		log.Fatalf("could not read CSR: %s", err)
+	}
+	block, _ := pem.Decode(bs)
+	if block == nil {
+		log.Fatal("could not decode CSR")
+	}
+	if csr, err := x509.ParseCertificateRequest(block.Bytes); err != nil {
+		log.Fatalf("could not parse CSR: %s", err)
+	} else {
+		for _, name := range names {
+			if !util.Contains(csr.DNSNames, name) {
+				log.Fatalf("CSR is not valid for %s", name)
+			}
+		}
+	}
+	return block.Bytes
+}
+
+func loadSolver() acme.Solver {
+	if hook != "" {
+		if solver, err := acme.NewHookSolver(challenge, hook); err != nil {
+			log.Fatal(err)
+		} else {
+			return solver
+		}
+	} else if challenge != acme.ChallengeHTTP01 {
+		log.Fatalf("%s challenges require -hook", challenge)
+	}
+
+	solver := acme.NewHTTPSolver()
+	if l, err := net.Listen("tcp", httpAddr); err != nil {
+		log.Fatalf("could not listen for http-01 challenges: %s", err)
+	} else {
+		go func() {
+			if err := solver.Serve(l); err != nil {
+				log.Printf("http-01 responder failed: %s", err)
+			}
+		}()
+	}
+	return solver
+}
+
+func loadHTTPClient() *http.Client {
+	if caRootsPath == "" {
+		return nil
+	}
+
+	pool := x509.NewCertPool()
+	if bs, err := os.ReadFile(caRootsPath); err != nil {
+		log.Fatalf("could not read CA roots: %s", err)
+	} else if !pool.AppendCertsFromPEM(bs) {
+		log.Fatal("could not parse CA roots")
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+}
+
+func main() {
+	flag.Parse()
+	if directory == "" {
+		log.Fatal("no -directory given")
+	} else if certOut == "" {
+		log.Fatal("no -cert-out given")
+	}
+
+	var contact []string
+	if email != "" {
+		contact = []string{"mailto:" + email}
+	}
+	cfg := &acme.Config{
+		DirectoryURL: directory,
+		AccountKey:   loadAccountKey(),
+		Contact:      contact,
+		Solver:       loadSolver(),
+		HTTPClient:   loadHTTPClient(),
+	}
+	csr := loadCSR()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	chain, err := acme.Obtain(ctx, cfg, csr)
+	if err != nil {
+		log.Fatalf("could not obtain certificate: %s", err)
+	} else if err := os.WriteFile(certOut, chain, 0644); err != nil {
+		log.Fatalf("could not write certificate: %s", err)
+	}
+	log.Printf("wrote certificate chain to %s", certOut)
+
+	certChain, err := roots.ParseCerts(chain)
+	if err != nil {
+		log.Fatalf("could not parse certificate: %s", err)
+	}
+	logs, errs := roots.LogConfigs(certChain)
+	for _, err := range errs {
+		log.Printf("could not build log config: %s", err)
+	}
+	if len(logs) == 0 {
+		log.Print("no SCTs found")
+	}
+	if bs, err := json.MarshalIndent(logs, "", "  "); err != nil {
+		log.Fatalf("could not marshal JSON: %s", err)
+	} else {
+		fmt.Printf("%s\n", string(bs))
+	}
+}
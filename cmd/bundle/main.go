@@ -0,0 +1,252 @@
+/*
+This tool creates, inspects, and splits token bundles. A bundle is a single
+JSON file that holds an emblem, its endorsements, and verification keys.
+Bundles hold exactly one emblem; emblems split by emblemgen -split cannot be
+bundled.
+
+Usage:
+
+	bundle create [-pk-alg ALG] FILE...
+	bundle inspect BUNDLE
+	bundle split -out DIR BUNDLE
+
+When creating a bundle, files ending in .jws or .cose are read as
+newline-separated tokens, files ending in .pem or .jwk as keys.
+*/
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/adem-wg/adem-proto/pkg/args"
+	"github.com/adem-wg/adem-proto/pkg/bundle"
+	"github.com/adem-wg/adem-proto/pkg/cose"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var outDir string
+
+func init() {
+	args.AddPublicKeyAlgArgs()
+	flag.StringVar(&outDir, "out", ".", "output directory (split only)")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("no subcommand given (expected create, inspect, or split)")
+	}
+	cmd := os.Args[1]
+	if err := flag.CommandLine.Parse(os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
+
+	switch cmd {
+	case "create":
+		create(flag.Args())
+	case "inspect":
+		inspect(loadBundle())
+	case "split":
+		split(loadBundle())
+	default:
+		log.Fatalf("unknown subcommand: %s", cmd)
+	}
+}
+
+func readLines(path string) [][]byte {
+	fp, err := os.Open(path)
+	if err != nil {
+		log.Fatalf("could not read file: %s", err)
+	}
+	defer fp.Close()
+
+	lines := [][]byte{}
+	scanner := bufio.NewScanner(fp)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			lines = append(lines, bytes.Clone(line))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatalf("could not read file: %s", err)
+	}
+	return lines
+}
+
+func create(files []string) {
+	if len(files) == 0 {
+		log.Fatal("no input")
+	}
+
+	alg, algOk := args.LoadPKAlgOpt()
+	rawTokens := [][]byte{}
+	keys := jwk.NewSet()
+	for _, file := range files {
+		switch filepath.Ext(file) {
+		case ".jws", ".cose":
+			rawTokens = append(rawTokens, readLines(file)...)
+		case ".pem", ".jwk":
+			if ks, err := args.LoadKeys(file, filepath.Ext(file) == ".jwk"); err != nil {
+				log.Fatalf("cannot load keys: %s", err)
+			} else {
+				for i := range ks.Len() {
+					if k, ok := ks.Key(i); !ok {
+						log.Fatalf("cannot access key at %d", i)
+					} else if pk, err := k.PublicKey(); err != nil {
+						log.Fatalf("cannot get public key: %s", err)
+					} else {
+						if algOk {
+							if err := pk.Set("alg", alg); err != nil {
+								log.Fatalf("could not set alg: %s", err)
+							}
+						}
+						if _, err := tokens.SetKID(pk, true); err != nil {
+							log.Fatalf("could not calculate kid: %s", err)
+						}
+						keys.AddKey(pk)
+					}
+				}
+			}
+		default:
+			log.Fatalf("unsupported file format: %s", file)
+		}
+	}
+
+	if keys.Len() == 0 {
+		keys = nil
+	}
+	if b, err := bundle.New(rawTokens, keys); err != nil {
+		log.Fatalf("could not create bundle: %s", err)
+	} else if bs, err := json.MarshalIndent(b, "", "  "); err != nil {
+		log.Fatalf("could not encode bundle: %s", err)
+	} else {
+		fmt.Println(string(bs))
+	}
+}
+
+func loadBundle() *bundle.Bundle {
+	if len(flag.Args()) != 1 {
+		log.Fatal("expected exactly one bundle")
+	} else if bs, err := os.ReadFile(flag.Arg(0)); err != nil {
+		log.Fatalf("could not read bundle: %s", err)
+	} else if b, err := bundle.Parse(bs); err != nil {
+		log.Fatalf("could not parse bundle: %s", err)
+	} else {
+		return b
+	}
+	return nil
+}
+
+// Describe a token without verifying it.
+func describe(raw string) string {
+	var kid string
+	var body jwt.Token
+	if cose.IsCOSE([]byte(raw)) {
+		if msg, err := cose.Parse([]byte(raw)); err != nil {
+			return fmt.Sprintf("unparsable token: %s", err)
+		} else if t, err := msg.Claims(); err != nil {
+			return fmt.Sprintf("unparsable claims: %s", err)
+		} else {
+			kid, _ = msg.KeyID()
+			body = t
+		}
+	} else if msg, err := jws.Parse([]byte(raw)); err != nil {
+		return fmt.Sprintf("unparsable token: %s", err)
+	} else if t, err := jwt.Parse(msg.Payload(), jwt.WithVerify(false)); err != nil {
+		return fmt.Sprintf("unparsable claims: %s", err)
+	} else {
+		headers := msg.Signatures()[0].ProtectedHeaders()
+		if k, ok := headers.KeyID(); ok {
+			kid = k
+		} else if k, ok := headers.JWK(); ok {
+			kid, _ = tokens.CalcKID(k)
+		}
+		body = t
+	}
+
+	parts := []string{}
+	if kid != "" {
+		parts = append(parts, fmt.Sprintf("signed by %s", kid))
+	} else {
+		parts = append(parts, "unsigned")
+	}
+	if iss, ok := body.Issuer(); ok {
+		parts = append(parts, fmt.Sprintf("iss %s", iss))
+	}
+	if sub, ok := body.Subject(); ok {
+		parts = append(parts, fmt.Sprintf("sub %s", sub))
+	}
+	if key, err := tokens.GetEndorsedKID(body); err == nil {
+		parts = append(parts, fmt.Sprintf("endorses %s", key))
+	}
+	if body.Has("log") {
+		parts = append(parts, "root key commitment")
+	}
+	if exp, ok := body.Expiration(); ok {
+		parts = append(parts, fmt.Sprintf("expires %s", exp.UTC().Format("2006-01-02T15:04:05Z")))
+	}
+	return strings.Join(parts, ", ")
+}
+
+func inspect(b *bundle.Bundle) {
+	lns := []string{
+		fmt.Sprintf("Bundle %s (content hash verified)", b.Hash),
+		fmt.Sprintf("- Emblem:         %s", describe(b.Emblem)),
+	}
+	for _, end := range b.Endorsements {
+		lns = append(lns, fmt.Sprintf("- Endorsement:    %s", describe(end)))
+	}
+	if b.Keys != nil {
+		for i := range b.Keys.Len() {
+			if k, ok := b.Keys.Key(i); ok {
+				kid, _ := k.KeyID()
+				lns = append(lns, fmt.Sprintf("- Key:            %s", kid))
+			}
+		}
+	}
+	fmt.Println(strings.Join(lns, "\n"))
+}
+
+func tokenExt(raw string) string {
+	if cose.IsCOSE([]byte(raw)) {
+		return ".cose"
+	}
+	return ".jws"
+}
+
+func writeFile(name string, bs []byte) {
+	path := filepath.Join(outDir, name)
+	if err := os.WriteFile(path, bs, 0644); err != nil {
+		log.Fatalf("could not write %s: %s", path, err)
+	}
+	log.Printf("wrote %s", path)
+}
+
+func split(b *bundle.Bundle) {
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		log.Fatalf("could not create output directory: %s", err)
+	}
+
+	writeFile("emblem"+tokenExt(b.Emblem), []byte(b.Emblem+"\n"))
+	for i, end := range b.Endorsements {
+		writeFile(fmt.Sprintf("endorsement-%d%s", i, tokenExt(end)), []byte(end+"\n"))
+	}
+	if b.Keys != nil && b.Keys.Len() > 0 {
+		if bs, err := json.MarshalIndent(b.Keys, "", "  "); err != nil {
+			log.Fatalf("could not encode keys: %s", err)
+		} else {
+			writeFile("keys.jwk", bs)
+		}
+	}
+}
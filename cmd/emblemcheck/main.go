@@ -1,6 +1,7 @@
 /*
 This tool will read a number of newline seperated tokens in JWS compact
 serialization (see [RFC 7515]) and attempt to verify them as ADEM tokens.
+Instead of newline separated tokens, it also accepts a token bundle.
 
 [RFC 7515]: https://www.rfc-editor.org/rfc/rfc7515
 */
@@ -8,11 +9,14 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"flag"
 	"io"
 	"log"
+	"strings"
 
 	"github.com/adem-wg/adem-proto/pkg/args"
+	"github.com/adem-wg/adem-proto/pkg/bundle"
 	"github.com/adem-wg/adem-proto/pkg/tokens"
 	"github.com/adem-wg/adem-proto/pkg/vfy"
 )
@@ -20,7 +24,10 @@ import (
 func init() {
 	args.AddCTArgs()
 	args.AddVerificationArgs()
+	args.AddX5CAnchorArgs()
 	args.AddVerificationLocalArgs()
+	args.AddAssetArgs()
+	args.AddClaimExtensionArgs()
 }
 
 func loadTokensLocal() ([][]byte, error) {
@@ -28,7 +35,14 @@ func loadTokensLocal() ([][]byte, error) {
 	if file != nil {
 		defer file.Close()
 	}
-	reader := bufio.NewReader(file)
+	bs, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	} else if ts, ok, err := bundle.Expand(bs); ok {
+		return ts, err
+	}
+
+	reader := bufio.NewReader(bytes.NewReader(bs))
 	lines := [][]byte{}
 	for {
 		line, err := reader.ReadBytes('\n')
@@ -45,9 +59,11 @@ func loadTokensLocal() ([][]byte, error) {
 
 func main() {
 	flag.Parse()
+	args.LoadClaimExtensions()
 	if err := args.FetchKnownLogs(); err != nil {
 		log.Fatalf("could not fetch known logs: %s", err)
 	}
+	args.LoadX5CAnchors()
 
 	ts, err := loadTokensLocal()
 	if err != nil {
@@ -61,5 +77,18 @@ func main() {
 		}
 	}
 
-	vfy.VerifyTokens(ts, trustedKeys).Print()
+	asset := args.LoadAsset()
+	results := vfy.VerifyTokens(ts, trustedKeys)
+	results.Print()
+	if asset != nil {
+		if levels := results.ResultsFor(asset); len(levels) > 0 {
+			strs := make([]string, 0, len(levels))
+			for _, level := range levels {
+				strs = append(strs, level.String())
+			}
+			log.Printf("asset %s is protected with security levels %s", asset, strings.Join(strs, ", "))
+		} else {
+			log.Fatalf("asset %s is not protected", asset)
+		}
+	}
 }
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/adem-wg/adem-proto/pkg/args"
+	"github.com/adem-wg/adem-proto/pkg/bundle"
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/gen"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/adem-wg/adem-proto/pkg/util"
+	"github.com/adem-wg/adem-proto/pkg/vfy"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+func describeEndorsement(t jwt.Token) string {
+	desc := "of key"
+	if kid, err := tokens.GetEndorsedKID(t); err == nil {
+		desc = fmt.Sprintf("of key %s", kid)
+	}
+	if iss, ok := t.Issuer(); ok {
+		desc = fmt.Sprintf("%s by %s", desc, iss)
+	}
+	return desc
+}
+
+// Check a freshly signed emblem against the given endorsements before it is
+// output. First, check the emblem against the constraints of every
+// endorsement. Second, verify the emblem together with the endorsements as a
+// verifier would. The emblem's own verification key is added to the tokens but
+// not trusted. Every endorsement must verify and be part of the emblem's chain
+// of endorsements. Terminates the program if any check fails.
+func checkAgainst(emblem jwt.Token, signed []byte, signer gen.Signer, alg jwa.SignatureAlgorithm, against [][]byte) {
+	rawTokens := [][]byte{signed}
+	endorsements := [][]byte{}
+	bodies := []jwt.Token{}
+	violations := []string{}
+	for _, raw := range against {
+		if _, err := jwk.ParseKey(raw); err == nil {
+			rawTokens = append(rawTokens, raw)
+			continue
+		}
+
+		if cty, err := bundle.ContentType(raw); err != nil {
+			log.Fatalf("could not parse endorsement: %s", err)
+		} else if cty != string(consts.EndorsementCty) {
+			log.Print("ignoring token that is no endorsement")
+		} else if body, err := vfy.ParseUnverified(raw); err != nil {
+			log.Fatalf("could not parse endorsement: %s", err)
+		} else {
+			for _, err := range tokens.ConstraintViolations(emblem, body) {
+				violations = append(violations, fmt.Sprintf("endorsement %s: %s", describeEndorsement(body), err))
+			}
+			rawTokens = append(rawTokens, raw)
+			endorsements = append(endorsements, raw)
+			bodies = append(bodies, body)
+		}
+	}
+
+	if pk, err := signer.PublicKey(); err != nil {
+		log.Fatalf("could not get public key: %s", err)
+	} else if err := pk.Set("alg", alg); err != nil {
+		log.Fatalf("could not set alg: %s", err)
+	} else if _, err := tokens.SetKID(pk, true); err != nil {
+		log.Fatalf("could not calculate kid: %s", err)
+	} else if bs, err := json.Marshal(pk); err != nil {
+		log.Fatalf("could not encode public key: %s", err)
+	} else {
+		rawTokens = append(rawTokens, bs)
+	}
+
+	if err := args.FetchKnownLogs(); err != nil {
+		log.Printf("could not fetch known logs; root key commitments cannot be verified: %s", err)
+	}
+
+	results := vfy.VerifyTokens(rawTokens, nil)
+	results.Print()
+	if util.Contains(results.Results(), vfy.INVALID) {
+		violations = append(violations, "emblem and endorsements verify as INVALID")
+	} else {
+		for i, raw := range endorsements {
+			if !results.Joins(raw) {
+				violations = append(violations, fmt.Sprintf("endorsement %s does not verify or is not part of the emblem's chain", describeEndorsement(bodies[i])))
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		log.Fatalf("refusing to output emblem:\n- %s", strings.Join(violations, "\n- "))
+	}
+}
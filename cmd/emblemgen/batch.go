@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/adem-wg/adem-proto/pkg/args"
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/cose"
+	"github.com/adem-wg/adem-proto/pkg/gen"
+	"github.com/adem-wg/adem-proto/pkg/schema"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var ErrUnknownVariable = errors.New("unknown variable")
+var ErrIllegalName = errors.New("illegal token name")
+var ErrDuplicateName = errors.New("duplicate token name")
+var ErrIllegalLifetime = errors.New("illegal lifetime")
+
+const manifestFile = "manifest.json"
+
+// Batch specification. Strings in proto, key, lifetime, and name may contain
+// variables "${NAME}" that are replaced by the respective value of each
+// instance. A string that consists of a single variable is replaced by the
+// variable's value as is, e.g., by a list of assets. Within lists, such
+// strings are replaced by their whitespace-separated fields, e.g.,
+// "assets": ["${assets}"] expands an instance's assets
+// "a.example b.example" to two assets.
+//
+// Instances are either a list of JSON objects or a path to a JSON file holding
+// such a list or a CSV file with a header row. If key is given, one
+// endorsement of key is signed per instance; otherwise, one emblem. Keys are
+// JWKs or paths to PEM or JWK files. Relative paths are resolved relative to
+// the specification.
+type batchSpec struct {
+	Proto     any             `json:"proto"`
+	Key       any             `json:"key,omitempty"`
+	Lifetime  any             `json:"lifetime,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Instances json.RawMessage `json:"instances"`
+	Out       string          `json:"out"`
+}
+
+// Manifest entry of a signed token or a failed instance.
+type manifestEntry struct {
+	Row    int      `json:"row"`
+	File   string   `json:"file,omitempty"`
+	Cty    string   `json:"cty,omitempty"`
+	Iss    string   `json:"iss,omitempty"`
+	Assets []string `json:"assets,omitempty"`
+	Key    string   `json:"key,omitempty"`
+	Nbf    int64    `json:"nbf,omitempty"`
+	Exp    int64    `json:"exp,omitempty"`
+	Size   int      `json:"size,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+var variable = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// Resolve a path relative to the batch specification.
+func resolve(dir string, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
+// Expand the variables in a JSON value with an instance's values.
+func expand(v any, vars map[string]any) (any, error) {
+	switch v := v.(type) {
+	case string:
+		if m := variable.FindStringSubmatch(v); m != nil && m[0] == v {
+			if value, ok := vars[m[1]]; !ok {
+				return nil, fmt.Errorf("%w: %s", ErrUnknownVariable, m[1])
+			} else {
+				return value, nil
+			}
+		}
+
+		var err error
+		expanded := variable.ReplaceAllStringFunc(v, func(match string) string {
+			name := variable.FindStringSubmatch(match)[1]
+			if value, ok := vars[name]; !ok {
+				err = fmt.Errorf("%w: %s", ErrUnknownVariable, name)
+			} else if s, ok := value.(string); ok {
+				return s
+			} else if bs, jsonErr := json.Marshal(value); jsonErr != nil {
+				err = jsonErr
+			} else {
+				return string(bs)
+			}
+			return ""
+		})
+		return expanded, err
+	case []any:
+		out := []any{}
+		for _, elem := range v {
+			if expanded, err := expand(elem, vars); err != nil {
+				return nil, err
+			} else if s, ok := expanded.(string); ok && s != elem {
+				for _, field := range strings.Fields(s) {
+					out = append(out, field)
+				}
+			} else if l, ok := expanded.([]any); ok {
+				out = append(out, l...)
+			} else {
+				out = append(out, expanded)
+			}
+		}
+		return out, nil
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, elem := range v {
+			if expanded, err := expand(elem, vars); err != nil {
+				return nil, err
+			} else {
+				out[k] = expanded
+			}
+		}
+		return out, nil
+	default:
+		return v, nil
+	}
+}
+
+// Load the instances of a batch. CSV values are strings.
+func loadInstances(dir string, raw json.RawMessage) []map[string]any {
+	var instances []map[string]any
+	var path string
+	if err := json.Unmarshal(raw, &instances); err == nil {
+		return instances
+	} else if err := json.Unmarshal(raw, &path); err != nil {
+		log.Fatal("batch instances must be a list of objects or a path")
+	}
+
+	bs, err := os.ReadFile(resolve(dir, path))
+	if err != nil {
+		log.Fatalf("could not read instances: %s", err)
+	}
+	if filepath.Ext(path) != ".csv" {
+		if err := json.Unmarshal(bs, &instances); err != nil {
+			log.Fatalf("could not parse instances: %s", err)
+		}
+		return instances
+	}
+
+	records, err := csv.NewReader(bytes.NewReader(bs)).ReadAll()
+	if err != nil {
+		log.Fatalf("could not parse instances: %s", err)
+	} else if len(records) == 0 {
+		log.Fatal("instances have no header row")
+	}
+	for _, record := range records[1:] {
+		instance := make(map[string]any)
+		for i, name := range records[0] {
+			instance[name] = record[i]
+		}
+		instances = append(instances, instance)
+	}
+	return instances
+}
+
+// Load the key to endorse. The key is either a JWK or a path to a key file.
+func loadEndorsedKey(dir string, v any) (jwk.Key, jwa.SignatureAlgorithm, error) {
+	var key jwk.Key
+	if path, ok := v.(string); ok {
+		if bs, err := os.ReadFile(resolve(dir, path)); err != nil {
+			return nil, jwa.NoSignature(), err
+		} else if set, err := jwk.Parse(bs, jwk.WithPEM(bytes.Contains(bs, []byte("-----BEGIN ")))); err != nil {
+			return nil, jwa.NoSignature(), err
+		} else if set.Len() != 1 {
+			return nil, jwa.NoSignature(), fmt.Errorf("%s holds %d keys; expected one", path, set.Len())
+		} else {
+			key, _ = set.Key(0)
+		}
+	} else if bs, err := json.Marshal(v); err != nil {
+		return nil, jwa.NoSignature(), err
+	} else if key, err = jwk.ParseKey(bs); err != nil {
+		return nil, jwa.NoSignature(), err
+	}
+
+	// Keys are endorsed with -pk-alg, if given, and their own algorithm
+	// otherwise.
+	alg, _ := args.LoadPKAlgOpt()
+	if err := tokens.SetAlg(key, alg); err != nil {
+		return nil, jwa.NoSignature(), err
+	} else if keyAlg, ok := key.Algorithm(); !ok {
+		return nil, jwa.NoSignature(), tokens.ErrUnsupportedAlg
+	} else if sigAlg, ok := jwa.LookupSignatureAlgorithm(keyAlg.String()); !ok {
+		return nil, jwa.NoSignature(), fmt.Errorf("%w: %s", tokens.ErrUnsupportedAlg, keyAlg)
+	} else if alg != jwa.NoSignature() {
+		return key, alg, nil
+	} else {
+		return key, sigAlg, nil
+	}
+}
+
+func parseLifetime(v any) (int64, error) {
+	switch v := v.(type) {
+	case nil:
+		return args.LoadLifetime(), nil
+	case float64:
+		return int64(v), nil
+	case string:
+		if l, err := strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, fmt.Errorf("%w: %s", ErrIllegalLifetime, v)
+		} else {
+			return l, nil
+		}
+	default:
+		return 0, fmt.Errorf("%w: %v", ErrIllegalLifetime, v)
+	}
+}
+
+// A batch instance with its expanded proto and signing parameters.
+type batchJob struct {
+	row        int
+	name       string
+	proto      jwt.Token
+	cty        consts.CTY
+	endorseKey jwk.Key
+	pkAlg      jwa.SignatureAlgorithm
+	lifetime   int64
+}
+
+// Instantiate the batch specification for an instance.
+func mkJob(spec *batchSpec, dir string, row int, vars map[string]any) (*batchJob, error) {
+	job := &batchJob{row: row, name: strconv.Itoa(row), cty: consts.EmblemCty, pkAlg: jwa.NoSignature()}
+	if spec.Name != "" {
+		if name, err := expand(spec.Name, vars); err != nil {
+			return nil, err
+		} else if job.name = fmt.Sprint(name); job.name == "" || job.name != filepath.Base(job.name) || strings.HasPrefix(job.name, ".") {
+			return nil, fmt.Errorf("%w: %q", ErrIllegalName, job.name)
+		}
+	}
+
+	if spec.Key != nil {
+		job.cty = consts.EndorsementCty
+		if key, err := expand(spec.Key, vars); err != nil {
+			return nil, err
+		} else if job.endorseKey, job.pkAlg, err = loadEndorsedKey(dir, key); err != nil {
+			return nil, fmt.Errorf("could not load key: %w", err)
+		}
+	}
+
+	if lifetime, err := expand(spec.Lifetime, vars); err != nil {
+		return nil, err
+	} else if job.lifetime, err = parseLifetime(lifetime); err != nil {
+		return nil, err
+	}
+
+	if proto, err := expand(spec.Proto, vars); err != nil {
+		return nil, err
+	} else if bs, err := json.Marshal(proto); err != nil {
+		return nil, err
+	} else if err := schema.ValidateProto(job.cty, bs); err != nil {
+		return nil, err
+	} else if job.proto, err = jwt.Parse(bs, jwt.WithVerify(false), jwt.WithValidate(false)); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Sign a batch instance and store the token in the output directory.
+func (job *batchJob) run(signer gen.Signer, format consts.Format, logs tokens.Log, out string) manifestEntry {
+	entry := manifestEntry{Row: job.row, Cty: string(job.cty)}
+	t, signed, err := sign(signer, format, job.proto, job.endorseKey, job.pkAlg, logs, job.lifetime)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry
+	}
+
+	entry.File = job.name + ".jws"
+	if format == consts.FormatCOSE {
+		entry.File = job.name + ".cose"
+		signed = cose.EncodeText(signed)
+	}
+	entry.Size = len(signed)
+	if budget := args.LoadSizeBudget(); budget > 0 && entry.Size > budget {
+		log.Printf("%s: encoded token size of %d bytes exceeds budget of %d bytes", entry.File, entry.Size, budget)
+	}
+	if err := logTokens(signed); err != nil {
+		entry.File = ""
+		entry.Error = err.Error()
+		return entry
+	} else if err := os.WriteFile(filepath.Join(out, entry.File), append(signed, '\n'), 0644); err != nil {
+		entry.File = ""
+		entry.Error = err.Error()
+		return entry
+	}
+
+	entry.Iss, _ = t.Issuer()
+	var assets tokens.Assets
+	if err := t.Get("assets", &assets); err == nil {
+		for _, ai := range assets {
+			entry.Assets = append(entry.Assets, ai.String())
+		}
+	}
+	if job.endorseKey != nil {
+		entry.Key, _ = tokens.GetEndorsedKID(t)
+	}
+	if nbf, ok := t.NotBefore(); ok {
+		entry.Nbf = nbf.Unix()
+	}
+	if exp, ok := t.Expiration(); ok {
+		entry.Exp = exp.Unix()
+	}
+	return entry
+}
+
+// Sign one token per instance of the batch specification at the given path.
+// Tokens are written to the specification's output directory together with a
+// manifest. Instances that cannot be signed are recorded in the manifest and
+// make the command fail after all other instances were signed.
+func batch(path string, format consts.Format) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("could not read batch specification: %s", err)
+	}
+	var spec batchSpec
+	if err := json.Unmarshal(bs, &spec); err != nil {
+		log.Fatalf("could not parse batch specification: %s", err)
+	} else if spec.Proto == nil {
+		log.Fatal("batch specification has no proto")
+	} else if spec.Out == "" {
+		log.Fatal("batch specification has no output directory")
+	}
+
+	dir := filepath.Dir(path)
+	out := resolve(dir, spec.Out)
+	instances := loadInstances(dir, spec.Instances)
+	if err := os.MkdirAll(out, 0755); err != nil {
+		log.Fatalf("could not create output directory: %s", err)
+	}
+
+	// Instantiate all rows first, so that no token is signed for faulty
+	// specifications.
+	entries := make([]manifestEntry, len(instances))
+	jobs := []*batchJob{}
+	names := make(map[string]int)
+	for i, vars := range instances {
+		row := i + 1
+		if job, err := mkJob(&spec, dir, row, vars); err != nil {
+			entries[i] = manifestEntry{Row: row, Error: err.Error()}
+		} else if prev, ok := names[job.name]; ok {
+			entries[i] = manifestEntry{Row: row, Error: fmt.Sprintf("%s: %s (row %d)", ErrDuplicateName, job.name, prev)}
+		} else {
+			names[job.name] = row
+			jobs = append(jobs, job)
+		}
+	}
+
+	signer := args.LoadSigner()
+	logs := args.LoadLogs()
+	queue := make(chan *batchJob)
+	var wg sync.WaitGroup
+	for range min(args.LoadJobs(), max(len(jobs), 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				entries[job.row-1] = job.run(signer, format, logs, out)
+			}
+		}()
+	}
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	failed := 0
+	for _, entry := range entries {
+		if entry.Error != "" {
+			log.Printf("row %d: %s", entry.Row, entry.Error)
+			failed += 1
+		}
+	}
+	if bs, err := json.MarshalIndent(entries, "", "  "); err != nil {
+		log.Fatalf("could not encode manifest: %s", err)
+	} else if err := os.WriteFile(filepath.Join(out, manifestFile), append(bs, '\n'), 0644); err != nil {
+		log.Fatalf("could not write manifest: %s", err)
+	}
+
+	log.Printf("signed %d of %d token(s) into %s", len(instances)-failed, len(instances), out)
+	if failed > 0 {
+		log.Fatalf("%d instance(s) failed", failed)
+	}
+}
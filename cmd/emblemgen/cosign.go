@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/adem-wg/adem-proto/pkg/args"
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/gen"
+)
+
+// Add a signature to the given endorsement and print the endorsement in JWS
+// JSON serialization.
+func cosign(endorsement []byte, format consts.Format) {
+	if format == consts.FormatCOSE {
+		log.Fatal("co-endorsements cannot be encoded as COSE")
+	} else if args.LoadUnsigned() {
+		log.Fatal("co-endorsements must be signed")
+	}
+
+	var iss string
+	if proto := args.LoadClaimsProtoOpt(consts.EndorsementCty); proto != nil {
+		iss, _ = proto.Issuer()
+	}
+	if iss == "" {
+		log.Fatal("co-signers must state their issuer as iss claim of -proto")
+	}
+
+	if signed, err := gen.Cosign(
+		endorsement,
+		args.LoadSigner(),
+		args.LoadHeaderKeyJWK(),
+		args.LoadAlg(),
+		iss,
+		args.LoadLogs(),
+	); err != nil {
+		log.Fatalf("could not co-sign endorsement: %s", err)
+	} else if err := logSignature(signed); err != nil {
+		log.Fatalf("could not log co-signature: %s", err)
+	} else {
+		fmt.Println(string(signed))
+	}
+}
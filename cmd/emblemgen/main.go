@@ -9,43 +9,110 @@ import (
 	"log"
 
 	"github.com/adem-wg/adem-proto/pkg/args"
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/cose"
 	"github.com/adem-wg/adem-proto/pkg/gen"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
 )
 
 func init() {
 	args.AddSigningArgs()
 	args.AddPublicKeyArgs()
 	args.AddPublicKeyAlgArgs()
+	args.AddFormatArgs()
+	args.AddCTProviderArgs()
+	args.AddClaimExtensionArgs()
+	args.AddCriticalClaimArgs()
+	args.AddSizeArgs()
+	args.AddTokenLogArgs()
 }
 
 func main() {
 	flag.Parse()
+	args.LoadClaimExtensions()
 	var signedToken []byte
 	var err error
+	format := args.LoadFormat()
 	endorseKey := args.LoadPublicKey()
-	if endorseKey == nil {
-		_, signedToken, err = gen.SignEmblem(
-			args.LoadPrivateKey(),
-			args.LoadHeaderKeyJWK(),
-			args.LoadAlg(),
-			args.LoadClaimsProto(),
+	if args.LoadCheckOnly() {
+		cty := consts.EmblemCty
+		if endorseKey != nil {
+			cty = consts.EndorsementCty
+		}
+		args.LoadClaimsProto(cty)
+		log.Printf("claims prototype complies with %s schema", cty)
+		return
+	}
+
+	// Unsigned emblems are not attributable to issuers and are not logged
+	if !args.LoadUnsigned() {
+		tokenLog = args.LoadTokenLog()
+	}
+
+	if endorsement := args.LoadCosign(); endorsement != nil {
+		cosign(endorsement, format)
+		return
+	}
+
+	if format == consts.FormatCOSE && args.LoadUnsigned() {
+		log.Fatal("unsigned emblems cannot be encoded as COSE")
+	} else if format == consts.FormatCOSE && args.LoadHeaderKeyJWK() {
+		log.Fatal("COSE-encoded tokens reference their verification key by kid only")
+	} else if format == consts.FormatCOSE && args.LoadX5C() != nil {
+		log.Fatal("COSE-encoded tokens cannot carry certificate chains")
+	}
+
+	if spec := args.LoadBatch(); spec != "" {
+		if args.LoadUnsigned() {
+			log.Fatal("batches cannot contain unsigned emblems")
+		} else if args.LoadAgainst() != nil {
+			log.Fatal("batches cannot be checked against endorsements")
+		} else if args.LoadSplit() {
+			log.Fatal("batches cannot be split")
+		}
+		batch(spec, format)
+		return
+	}
+
+	against := args.LoadAgainst()
+	if against != nil && (endorseKey != nil || args.LoadUnsigned()) {
+		log.Fatal("only signed emblems can be checked against endorsements")
+	}
+
+	if args.LoadSplit() {
+		if endorseKey != nil {
+			log.Fatal("only emblems can be split")
+		}
+		split(format, against)
+		return
+	}
+
+	var emblem jwt.Token
+	if args.LoadUnsigned() {
+		if endorseKey != nil {
+			log.Fatal("endorsements cannot be unsigned")
+		}
+		_, signedToken, err = gen.MkUnsignedEmblem(
+			args.LoadClaimsProto(consts.EmblemCty),
 			args.LoadLifetime(),
 		)
-	} else {
-		proto := args.LoadClaimsProto()
-		logs := args.LoadLogs()
-		if logs != nil {
-			if err := proto.Set("log", logs); err != nil {
-				log.Fatalf("could not set log in proto: %s", err)
-			}
+	} else if endorseKey == nil {
+		signer := args.LoadSigner()
+		emblem, signedToken, err = sign(signer, format, args.LoadClaimsProto(consts.EmblemCty), nil, jwa.NoSignature(), nil, args.LoadLifetime())
+		if err == nil && against != nil {
+			checkAgainst(emblem, signedToken, signer, args.LoadAlg(), against)
 		}
-		_, signedToken, err = gen.SignEndorsement(
-			args.LoadPrivateKey(),
-			args.LoadHeaderKeyJWK(),
-			args.LoadAlg(),
-			proto,
+	} else {
+		_, signedToken, err = sign(
+			args.LoadSigner(),
+			format,
+			args.LoadClaimsProto(consts.EndorsementCty),
 			endorseKey,
 			args.LoadPKAlg(),
+			args.LoadLogs(),
 			args.LoadLifetime(),
 		)
 	}
@@ -53,5 +120,35 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	if format == consts.FormatCOSE {
+		signedToken = cose.EncodeText(signedToken)
+	}
+	reportSize(signedToken)
+	if err := logTokens(signedToken); err != nil {
+		log.Fatalf("could not log token: %s", err)
+	}
 	fmt.Println(string(signedToken))
 }
+
+// Sign an emblem or, if endorseKey is not nil, an endorsement of endorseKey
+// with algorithm pkAlg. Endorsements carry the given logs as root key
+// commitment, if any.
+func sign(signer gen.Signer, format consts.Format, proto jwt.Token, endorseKey jwk.Key, pkAlg jwa.SignatureAlgorithm, logs tokens.Log, lifetime int64) (jwt.Token, []byte, error) {
+	alg := args.LoadAlg()
+	if endorseKey == nil && format == consts.FormatCOSE {
+		return gen.SignEmblemCOSE(signer, alg, proto, lifetime)
+	} else if endorseKey == nil {
+		return gen.SignEmblem(signer, args.LoadHeaderKeyJWK(), alg, proto, lifetime)
+	}
+
+	if logs != nil {
+		if err := proto.Set("log", logs); err != nil {
+			return nil, nil, fmt.Errorf("could not set log in proto: %w", err)
+		}
+	}
+	if format == consts.FormatCOSE {
+		return gen.SignEndorsementCOSE(signer, alg, proto, endorseKey, pkAlg, args.LoadEmbedKey(), lifetime)
+	} else {
+		return gen.SignEndorsement(signer, args.LoadHeaderKeyJWK(), alg, proto, endorseKey, pkAlg, args.LoadEmbedKey(), lifetime)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/adem-wg/adem-proto/pkg/args"
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/cose"
+	"github.com/adem-wg/adem-proto/pkg/gen"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+// Log the size of an encoded token and whether it fits the size budget.
+func reportSize(encoded []byte) {
+	if budget := args.LoadSizeBudget(); budget == 0 {
+		log.Printf("encoded token size: %d bytes", len(encoded))
+	} else if len(encoded) > budget {
+		log.Printf("encoded token size: %d bytes; exceeds budget of %d bytes (see -split)", len(encoded), budget)
+	} else {
+		log.Printf("encoded token size: %d bytes; fits budget of %d bytes", len(encoded), budget)
+	}
+}
+
+// Sign the emblem prototype as several emblems that each fit the size budget
+// and print them as newline-separated tokens. If against is not nil, every
+// emblem is checked against the endorsements before output.
+func split(format consts.Format, against [][]byte) {
+	var signer gen.Signer
+	if !args.LoadUnsigned() {
+		signer = args.LoadSigner()
+	}
+
+	encodeWith := func(signer gen.Signer) func(jwt.Token) (jwt.Token, []byte, error) {
+		return func(t jwt.Token) (jwt.Token, []byte, error) {
+			if signer == nil {
+				return gen.MkUnsignedEmblem(t, args.LoadLifetime())
+			} else if t, signed, err := sign(signer, format, t, nil, jwa.NoSignature(), nil, args.LoadLifetime()); err != nil {
+				return nil, nil, err
+			} else if format == consts.FormatCOSE {
+				return t, cose.EncodeText(signed), nil
+			} else {
+				return t, signed, nil
+			}
+		}
+	}
+
+	// Only the final emblems are signed, e.g., such that signerd logs no trials
+	measure := encodeWith(nil)
+	if signer != nil {
+		measure = encodeWith(gen.DryRunSigner(signer))
+	}
+	proto := args.LoadClaimsProto(consts.EmblemCty)
+	emblems, encoded, err := gen.SplitEmblem(proto, args.LoadSizeBudget(), measure, encodeWith(signer))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if against != nil {
+		for i := range emblems {
+			checkAgainst(emblems[i], encoded[i], signer, args.LoadAlg(), against)
+		}
+	}
+	log.Printf("split assets over %d emblem(s)", len(emblems))
+	if err := logTokens(encoded...); err != nil {
+		log.Fatalf("could not log emblems: %s", err)
+	}
+	for _, raw := range encoded {
+		reportSize(raw)
+		fmt.Println(string(raw))
+	}
+}
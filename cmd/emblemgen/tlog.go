@@ -0,0 +1,48 @@
+package main
+
+import (
+	"log"
+
+	"github.com/adem-wg/adem-proto/pkg/tokenlog"
+)
+
+// Token log to append signed tokens to; nil if none was given.
+var tokenLog *tokenlog.Log
+
+// Append the entries of the given tokens to the token log. Tokens are only
+// output once they were logged.
+func logTokens(signed ...[]byte) error {
+	if tokenLog == nil {
+		return nil
+	}
+
+	entries := [][]byte{}
+	for _, token := range signed {
+		if es, err := tokenlog.Entries(token); err != nil {
+			return err
+		} else {
+			entries = append(entries, es...)
+		}
+	}
+	if index, err := tokenLog.Append(entries...); err != nil {
+		return err
+	} else {
+		log.Printf("appended %d entries to token log at index %d", len(entries), index)
+		return nil
+	}
+}
+
+// Append the entry of a token's last signature to the token log, e.g., of a
+// co-signature.
+func logSignature(signed []byte) error {
+	if tokenLog == nil {
+		return nil
+	} else if entries, err := tokenlog.Entries(signed); err != nil {
+		return err
+	} else if index, err := tokenLog.Append(entries[len(entries)-1]); err != nil {
+		return err
+	} else {
+		log.Printf("appended co-signature to token log at index %d", index)
+		return nil
+	}
+}
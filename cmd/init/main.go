@@ -0,0 +1,425 @@
+/*
+This tool sets up an organization's ADEM deployment from scratch. It keeps its
+state in a directory and is run in two stages:
+
+	init start -dir DIR -iss OI [-alg ALG] [-encrypt] [-new-pass SRC]
+	init finish -dir DIR -cert CHAIN -proto EMBLEM [-format jws|cose] [-lifetime SEC] [-pass SRC] [-quoted]
+
+start generates a root key and an emblem key, and a certificate signing request
+(CSR) for the root key's configuration certificate. The CSR is valid for the
+issuer's host name and <kid>.adem-configuration.<host>, where <kid> is the root
+key's KID. The CSR is signed by a separate TLS key (tls.pem), as certificate
+authorities may not accept the root key's algorithm. The certificate can be
+obtained with the acme tool, e.g., "acme -csr DIR/csr.pem".
+
+finish takes the issued certificate chain and derives the log claim from its
+embedded SCTs (cf. leafhash). It then signs an endorsement of the emblem key by
+the root key that carries the log claim, signs an emblem for the claims
+prototype EMBLEM, and verifies the resulting setup (cf. emblemcheck). On
+success, it prints the DNS records to publish (cf. records). Certificates are
+only included in logs after their maximum merge delay; repeat finish until it
+succeeds.
+*/
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/adem-wg/adem-proto/pkg/acme"
+	"github.com/adem-wg/adem-proto/pkg/args"
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/cose"
+	"github.com/adem-wg/adem-proto/pkg/gen"
+	"github.com/adem-wg/adem-proto/pkg/keystore"
+	"github.com/adem-wg/adem-proto/pkg/roots"
+	"github.com/adem-wg/adem-proto/pkg/schema"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/adem-wg/adem-proto/pkg/util"
+	"github.com/adem-wg/adem-proto/pkg/vfy"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+// Files in the state directory
+const stateFile = "init.json"
+const rootKeyFile = "root.pem"
+const emblemKeyFile = "emblem.pem"
+const tlsKeyFile = "tls.pem"
+const csrFile = "csr.pem"
+const certFile = "cert.pem"
+const logsFile = "logs.json"
+const tokensFile = "tokens.txt"
+const recordsFile = "records.txt"
+
+type state struct {
+	Issuer    string `json:"iss"`
+	Alg       string `json:"alg"`
+	RootKid   string `json:"rootKid"`
+	EmblemKid string `json:"emblemKid"`
+}
+
+var dir string
+var iss string
+var alg string
+var encrypt bool
+var pass string
+var newPass string
+var certPath string
+var protoPath string
+var lifetime int64
+var quoted bool
+
+func init() {
+	args.AddCTArgs()
+	args.AddFormatArgs()
+	args.AddClaimExtensionArgs()
+	args.AddCriticalClaimArgs()
+	flag.StringVar(&dir, "dir", "", "directory to keep the setup in")
+	flag.StringVar(&iss, "iss", "", "issuer, i.e., the organization's OI, e.g., https://example.com (start only)")
+	flag.StringVar(&alg, "alg", "ES512", "algorithm of the root and emblem key (start only)")
+	flag.BoolVar(&encrypt, "encrypt", false, "encrypt the root and emblem key (start only)")
+	flag.StringVar(&pass, "pass", "prompt", "passphrase source for encrypted keys: prompt, env:NAME, or fd:N")
+	flag.StringVar(&newPass, "new-pass", "prompt", "passphrase source to encrypt keys with: prompt, env:NAME, or fd:N")
+	flag.StringVar(&certPath, "cert", "", "path to the root key's configuration certificate chain, leaf first (finish only)")
+	flag.StringVar(&protoPath, "proto", "", "path to the emblem's claims prototype (finish only)")
+	flag.Int64Var(&lifetime, "lifetime", 172800, "validity period of the emblem and endorsement (finish only)")
+	flag.BoolVar(&quoted, "quoted", false, "quote each record as DNS TXT record contents (finish only)")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("no subcommand given (expected start or finish)")
+	}
+	cmd := os.Args[1]
+	if err := flag.CommandLine.Parse(os.Args[2:]); err != nil {
+		log.Fatal(err)
+	} else if dir == "" {
+		log.Fatal("no -dir given")
+	}
+	args.LoadClaimExtensions()
+
+	switch cmd {
+	case "start":
+		start()
+	case "finish":
+		finish()
+	default:
+		log.Fatalf("unknown subcommand: %s", cmd)
+	}
+}
+
+func path(name string) string {
+	return filepath.Join(dir, name)
+}
+
+func writeFile(name string, bs []byte) {
+	if err := os.WriteFile(path(name), bs, 0600); err != nil {
+		log.Fatalf("could not write %s: %s", name, err)
+	}
+}
+
+func readFile(name string) []byte {
+	if bs, err := os.ReadFile(path(name)); err != nil {
+		log.Fatalf("could not read %s: %s", name, err)
+		return nil
+	} else {
+		return bs
+	}
+}
+
+// Return a passphrase provider that reads the passphrase from its source only
+// once. Keys are stored in separate files, but share their passphrase.
+func sharedPassphrase(passphrase keystore.Passphrase) keystore.Passphrase {
+	var cached []byte
+	return func() ([]byte, error) {
+		if cached == nil {
+			if p, err := passphrase(); err != nil {
+				return nil, err
+			} else {
+				cached = p
+			}
+		}
+		return bytes.Clone(cached), nil
+	}
+}
+
+// Return the names the configuration certificate of the given root key must be
+// valid for.
+func certNames(iss string, kid string) []string {
+	if names, err := roots.ConfigurationNames(iss, kid); err != nil {
+		log.Fatalf("could not parse issuer: %s", err)
+		return nil
+	} else {
+		return names
+	}
+}
+
+// Generate a key, store it in the state directory, and return its KID.
+func genKey(keyAlg jwa.SignatureAlgorithm, name string, passphrase keystore.Passphrase) string {
+	key, err := tokens.GenerateKey(keyAlg)
+	if err != nil {
+		log.Fatalf("could not generate key: %s", err)
+	}
+
+	set := jwk.NewSet()
+	set.AddKey(key)
+	var bs []byte
+	if passphrase != nil {
+		bs, err = keystore.EncryptPEM(set, passphrase)
+	} else {
+		bs, err = jwk.Pem(set)
+	}
+	if err != nil {
+		log.Fatalf("could not encode key: %s", err)
+	}
+	writeFile(name, bs)
+
+	kid, _ := key.KeyID()
+	return kid
+}
+
+// Generate a TLS key and a CSR for the given names.
+func genCSR(names []string) []byte {
+	csr, tlsKey, err := acme.NewCSR(names)
+	if err != nil {
+		log.Fatalf("could not create CSR: %s", err)
+	} else if der, err := x509.MarshalPKCS8PrivateKey(tlsKey); err != nil {
+		log.Fatalf("could not encode TLS key: %s", err)
+	} else {
+		writeFile(tlsKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})
+}
+
+func start() {
+	if _, err := os.Stat(path(stateFile)); err == nil {
+		log.Fatalf("%s already holds a setup", dir)
+	} else if iss == "" {
+		log.Fatal("no -iss given")
+	}
+
+	keyAlg, ok := jwa.LookupSignatureAlgorithm(alg)
+	if !ok {
+		log.Fatalf(`"-alg %s" algorithm not found`, alg)
+	}
+	// Fail early on illegal issuers
+	certNames(iss, "")
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Fatalf("could not create state directory: %s", err)
+	}
+	var passphrase keystore.Passphrase
+	if encrypt {
+		passphrase = sharedPassphrase(args.PassphraseFrom(newPass, "New passphrase", true))
+	}
+	st := state{
+		Issuer:    iss,
+		Alg:       keyAlg.String(),
+		RootKid:   genKey(keyAlg, rootKeyFile, passphrase),
+		EmblemKid: genKey(keyAlg, emblemKeyFile, passphrase),
+	}
+	names := certNames(iss, st.RootKid)
+	writeFile(csrFile, genCSR(names))
+	if bs, err := json.MarshalIndent(st, "", "  "); err != nil {
+		log.Fatalf("could not encode state: %s", err)
+	} else {
+		writeFile(stateFile, bs)
+	}
+
+	fmt.Printf("generated root key %s and emblem key %s\n", st.RootKid, st.EmblemKid)
+	fmt.Printf("request a certificate with %s that is valid for:\n", path(csrFile))
+	for _, name := range names {
+		fmt.Printf("  %s\n", name)
+	}
+	fmt.Printf("then run: init finish -dir %s -cert <chain> -proto <emblem claims>\n", dir)
+}
+
+func loadState() state {
+	var st state
+	if err := json.Unmarshal(readFile(stateFile), &st); err != nil {
+		log.Fatalf("could not parse state: %s", err)
+	}
+	return st
+}
+
+// Load the key with the given KID as signer. Returns the signer and its public
+// key.
+func loadSigner(name string, kid string, keyAlg jwa.SignatureAlgorithm, passphrase keystore.Passphrase) (gen.Signer, jwk.Key) {
+	if keys, err := keystore.Parse(readFile(name), false, passphrase); err != nil {
+		log.Fatalf("could not load %s: %s", name, err)
+		return nil, nil
+	} else if key, err := tokens.SelectKey(keys, kid, keyAlg); err != nil {
+		log.Fatalf("could not load %s: %s", name, err)
+		return nil, nil
+	} else if signer, err := gen.KeySigner(key); err != nil {
+		log.Fatalf("could not load %s: %s", name, err)
+		return nil, nil
+	} else if pk, err := signer.PublicKey(); err != nil {
+		log.Fatalf("could not load %s: %s", name, err)
+		return nil, nil
+	} else if _, err := tokens.SetKID(pk, true); err != nil {
+		log.Fatalf("could not set KID: %s", err)
+		return nil, nil
+	} else {
+		return signer, pk
+	}
+}
+
+// Load the emblem's claims prototype. The issuer defaults to the setup's
+// issuer.
+func loadEmblemProto(st state) jwt.Token {
+	bs, err := os.ReadFile(protoPath)
+	if err != nil {
+		log.Fatalf("cannot read proto file: %s", err)
+	} else if err := schema.ValidateProto(consts.EmblemCty, bs); err != nil {
+		log.Fatalf("%s: %s", protoPath, err)
+	}
+
+	proto, err := jwt.Parse(bs, jwt.WithVerify(false), jwt.WithValidate(false))
+	if err != nil {
+		log.Fatalf("cannot parse proto file: %s", err)
+	}
+	if protoIss, ok := proto.Issuer(); ok && protoIss != st.Issuer {
+		log.Fatalf("emblem issuer %s does not match setup issuer %s", protoIss, st.Issuer)
+	} else if err := proto.Set(jwt.IssuerKey, st.Issuer); err != nil {
+		log.Fatalf("could not set issuer: %s", err)
+	}
+	return proto
+}
+
+// Encode a public key for the adem-key record, either as JWK or as
+// base64url-encoded COSE_Key.
+func encodeKey(pk jwk.Key, format consts.Format) []byte {
+	if format == consts.FormatCOSE {
+		if bs, err := cose.EncodeKey(pk); err != nil {
+			log.Fatalf("could not encode key: %s", err)
+			return nil
+		} else {
+			return cose.EncodeText(bs)
+		}
+	} else if bs, err := json.Marshal(pk); err != nil {
+		log.Fatalf("could not encode key: %s", err)
+		return nil
+	} else {
+		return bs
+	}
+}
+
+func record(format string, ins ...any) string {
+	s := fmt.Sprintf(format, ins...)
+	if quoted {
+		s = strconv.Quote(s)
+	}
+	return s
+}
+
+func finish() {
+	st := loadState()
+	if certPath == "" {
+		log.Fatal("no -cert given")
+	} else if protoPath == "" {
+		log.Fatal("no -proto given")
+	}
+	keyAlg, _ := jwa.LookupSignatureAlgorithm(st.Alg)
+	format := args.LoadFormat()
+
+	bs, err := os.ReadFile(certPath)
+	if err != nil {
+		log.Fatalf("could not read certificate: %s", err)
+	}
+	chain, err := roots.ParseCerts(bs)
+	if err != nil {
+		log.Fatalf("could not parse certificate: %s", err)
+	}
+	for _, name := range certNames(st.Issuer, st.RootKid) {
+		if !util.Contains(chain[0].DNSNames, name) {
+			log.Fatalf("certificate is not valid for %s", name)
+		}
+	}
+	logs, errs := roots.LogConfigs(chain)
+	for _, err := range errs {
+		log.Printf("could not build log config: %s", err)
+	}
+	if len(logs) == 0 {
+		log.Fatal("certificate carries no SCTs; was it logged?")
+	}
+	writeFile(certFile, bs)
+	if logsBs, err := json.MarshalIndent(logs, "", "  "); err != nil {
+		log.Fatalf("could not encode log claim: %s", err)
+	} else {
+		writeFile(logsFile, logsBs)
+	}
+
+	passphrase := sharedPassphrase(args.PassphraseFrom(pass, "Passphrase for "+dir, false))
+	rootSigner, rootKey := loadSigner(rootKeyFile, st.RootKid, keyAlg, passphrase)
+	emblemSigner, emblemKey := loadSigner(emblemKeyFile, st.EmblemKid, keyAlg, passphrase)
+
+	endorsementProto := jwt.New()
+	for k, v := range map[string]any{
+		"ver":          string(consts.V1),
+		jwt.IssuerKey:  st.Issuer,
+		jwt.SubjectKey: st.Issuer,
+		"end":          true,
+		"log":          logs,
+	} {
+		if err := endorsementProto.Set(k, v); err != nil {
+			log.Fatalf("could not set %s: %s", k, err)
+		}
+	}
+
+	var endorsement, emblem []byte
+	if format == consts.FormatCOSE {
+		_, endorsement, err = gen.SignEndorsementCOSE(rootSigner, keyAlg, endorsementProto, emblemKey, keyAlg, false, lifetime)
+		if err == nil {
+			_, emblem, err = gen.SignEmblemCOSE(emblemSigner, keyAlg, loadEmblemProto(st), lifetime)
+		}
+		if err == nil {
+			endorsement, emblem = cose.EncodeText(endorsement), cose.EncodeText(emblem)
+		}
+	} else {
+		_, endorsement, err = gen.SignEndorsement(rootSigner, false, keyAlg, endorsementProto, emblemKey, keyAlg, false, lifetime)
+		if err == nil {
+			_, emblem, err = gen.SignEmblem(emblemSigner, false, keyAlg, loadEmblemProto(st), lifetime)
+		}
+	}
+	if err != nil {
+		log.Fatalf("could not sign tokens: %s", err)
+	}
+
+	ts := [][]byte{emblem, endorsement}
+	keys := [][]byte{encodeKey(rootKey, format), encodeKey(emblemKey, format)}
+	out := []byte{}
+	for _, t := range append(ts, keys...) {
+		out = append(append(out, t...), '\n')
+	}
+	writeFile(tokensFile, out)
+
+	if err := args.FetchKnownLogs(); err != nil {
+		log.Fatalf("could not fetch known CT logs: %s", err)
+	}
+	results := vfy.VerifyTokens(append(ts, keys...), jwk.NewSet())
+	results.Print()
+	if !util.Contains(results.Results(), vfy.ORGANIZATIONAL) {
+		log.Fatal("setup does not verify as ORGANIZATIONAL (yet); the certificate may not be included in the logs yet, retry later")
+	}
+
+	records := []byte{}
+	for _, t := range ts {
+		records = fmt.Appendln(records, record("adem-token=%s", t))
+	}
+	for _, k := range keys {
+		records = fmt.Appendln(records, record("adem-key=%s", k))
+	}
+	writeFile(recordsFile, records)
+	fmt.Print(string(records))
+}
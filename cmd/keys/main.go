@@ -0,0 +1,246 @@
+/*
+This tool generates and manages signing keys.
+
+Usage:
+
+	keys gen -alg ALG [-to pem|jwk] [-pub] [-encrypt] [-new-pass SRC]
+	keys convert [-pk-alg ALG] [-to pem|jwk] [-pub] [-pass SRC] FILE
+	keys info [-pk-alg ALG] [-iss OI] [-pass SRC] FILE
+	keys select -kid KID [-pk-alg ALG] [-to pem|jwk] [-pub] [-pass SRC] FILE
+	keys encrypt [-pk-alg ALG] [-to pem|jwk] [-pass SRC] [-new-pass SRC] FILE
+
+Supported algorithms are ES256, ES384, ES512, and EdDSA (Ed25519). Input
+files may hold PEM-encoded keys or JWK (sets); the encoding is detected
+automatically. Keys without algorithm are assigned -pk-alg or, if omitted, the
+algorithm matching their key type. JWK output includes the keys' algorithm and
+KID.
+
+Encrypted input files, i.e., encrypted PKCS#8 PEM or JWE-encrypted JWK sets,
+are decrypted in memory using the passphrase from -pass. The encrypt
+subcommand encrypts keys with the passphrase from -new-pass; applied to
+encrypted keys, it re-encrypts them. Passphrase sources are prompt, env:NAME,
+and fd:N.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+
+	"github.com/adem-wg/adem-proto/pkg/args"
+	"github.com/adem-wg/adem-proto/pkg/keystore"
+	"github.com/adem-wg/adem-proto/pkg/roots"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+var genAlg string
+var to string
+var pubOnly bool
+var selectKid string
+var iss string
+var pass string
+var newPass string
+var encrypt bool
+
+func init() {
+	args.AddPublicKeyAlgArgs()
+	flag.StringVar(&genAlg, "alg", "", "algorithm of the key to generate (gen only)")
+	flag.StringVar(&to, "to", "", "output encoding, pem or jwk; defaults to pem for gen, to the other encoding for convert, and to the input encoding for select and encrypt")
+	flag.BoolVar(&pubOnly, "pub", false, "only output public keys")
+	flag.StringVar(&selectKid, "kid", "", "kid of the key to select (select only)")
+	flag.StringVar(&iss, "iss", "", "issuer OI to print the full adem-configuration name for (info only)")
+	flag.StringVar(&pass, "pass", "prompt", "passphrase source for encrypted input keys: prompt, env:NAME, or fd:N")
+	flag.StringVar(&newPass, "new-pass", "prompt", "passphrase source to encrypt output keys with: prompt, env:NAME, or fd:N")
+	flag.BoolVar(&encrypt, "encrypt", false, "encrypt the generated key (gen only)")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("no subcommand given (expected gen, convert, info, select, or encrypt)")
+	}
+	cmd := os.Args[1]
+	if err := flag.CommandLine.Parse(os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
+
+	switch cmd {
+	case "gen":
+		gen()
+	case "convert":
+		set, isJWK := loadSet()
+		output(set, outputJWK(!isJWK))
+	case "info":
+		set, _ := loadSet()
+		info(set)
+	case "select":
+		set, isJWK := loadSet()
+		if selectKid == "" {
+			log.Fatal("no -kid given")
+		} else if key, err := tokens.SelectKey(set, selectKid, loadPKAlg()); err != nil {
+			log.Fatal(err)
+		} else {
+			selected := jwk.NewSet()
+			selected.AddKey(key)
+			output(selected, outputJWK(isJWK))
+		}
+	case "encrypt":
+		set, isJWK := loadSet()
+		encrypt = true
+		output(set, outputJWK(isJWK))
+	default:
+		log.Fatalf("unknown subcommand: %s", cmd)
+	}
+}
+
+func loadPKAlg() jwa.SignatureAlgorithm {
+	alg, _ := args.LoadPKAlgOpt()
+	return alg
+}
+
+// Load the key set given as argument. Returns whether the keys were encoded as
+// JWK. All keys are assigned an algorithm and their KID.
+func loadSet() (jwk.Set, bool) {
+	if flag.NArg() != 1 {
+		log.Fatal("expected exactly one key file")
+	}
+
+	path := flag.Arg(0)
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("could not read keys: %s", err)
+	}
+	isJWK := !bytes.Contains(bs, []byte("-----BEGIN "))
+	set, err := keystore.Parse(bs, isJWK, args.PassphraseFrom(pass, "Passphrase for "+path, false))
+	if err != nil {
+		log.Fatalf("could not parse keys: %s", err)
+	}
+
+	alg := loadPKAlg()
+	for i := range set.Len() {
+		if k, ok := set.Key(i); !ok {
+			log.Fatalf("could not access key at index %d", i)
+		} else if err := tokens.SetAlg(k, alg); err != nil {
+			log.Fatalf("could not determine algorithm of key %d: %s", i, err)
+		} else if _, err := tokens.SetKID(k, true); err != nil {
+			log.Fatalf("could not calculate kid of key %d: %s", i, err)
+		}
+	}
+	return set, isJWK
+}
+
+// Resolve the output encoding. Returns true for JWK.
+func outputJWK(dflt bool) bool {
+	switch to {
+	case "":
+		return dflt
+	case "jwk":
+		return true
+	case "pem":
+		return false
+	default:
+		log.Fatalf("illegal output encoding: %s", to)
+		return false
+	}
+}
+
+func gen() {
+	if alg, ok := jwa.LookupSignatureAlgorithm(genAlg); !ok {
+		log.Fatalf(`"-alg %s" algorithm not found`, genAlg)
+	} else if key, err := tokens.GenerateKey(alg); err != nil {
+		log.Fatalf("could not generate key: %s", err)
+	} else {
+		set := jwk.NewSet()
+		set.AddKey(key)
+		output(set, outputJWK(false))
+	}
+}
+
+func output(set jwk.Set, asJWK bool) {
+	if encrypt {
+		if pubOnly {
+			log.Fatal("public keys cannot be encrypted")
+		}
+		encryptOutput(set, asJWK)
+		return
+	}
+
+	if pubOnly {
+		if pubSet, err := jwk.PublicSetOf(set); err != nil {
+			log.Fatalf("could not get public keys: %s", err)
+		} else {
+			set = pubSet
+		}
+	}
+
+	if !asJWK {
+		if bs, err := jwk.Pem(set); err != nil {
+			log.Fatalf("could not encode keys as PEM: %s", err)
+		} else {
+			fmt.Print(string(bs))
+		}
+		return
+	}
+
+	var v any = set
+	if set.Len() == 1 {
+		v, _ = set.Key(0)
+	}
+	if bs, err := json.MarshalIndent(v, "", "  "); err != nil {
+		log.Fatalf("could not marshal JSON: %s", err)
+	} else {
+		fmt.Println(string(bs))
+	}
+}
+
+// Print the given keys encrypted with the passphrase from -new-pass.
+func encryptOutput(set jwk.Set, asJWK bool) {
+	passphrase := args.PassphraseFrom(newPass, "New passphrase", true)
+	if asJWK {
+		if bs, err := keystore.EncryptJWK(set, passphrase); err != nil {
+			log.Fatalf("could not encrypt keys: %s", err)
+		} else {
+			fmt.Println(string(bs))
+		}
+	} else if bs, err := keystore.EncryptPEM(set, passphrase); err != nil {
+		log.Fatalf("could not encrypt keys: %s", err)
+	} else {
+		fmt.Print(string(bs))
+	}
+}
+
+func info(set jwk.Set) {
+	host := ""
+	if iss != "" {
+		if issuerUrl, err := url.Parse(iss); err != nil {
+			log.Fatalf("could not parse issuer: %s", err)
+		} else if issuerUrl.Hostname() == "" {
+			log.Fatal(roots.ErrIssNoHostName)
+		} else {
+			host = "." + issuerUrl.Hostname()
+		}
+	}
+
+	for i := range set.Len() {
+		k, _ := set.Key(i)
+		kid, _ := k.KeyID()
+		alg, _ := k.Algorithm()
+		if uri, err := tokens.ThumbprintURI(k); err != nil {
+			log.Fatalf("could not calculate thumbprint: %s", err)
+		} else {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("kid:            %s\n", kid)
+			fmt.Printf("alg:            %s\n", alg)
+			fmt.Printf("configuration:  %s%s\n", roots.ConfigurationLabel(kid), host)
+			fmt.Printf("thumbprint URI: %s\n", uri)
+		}
+	}
+}
@@ -10,21 +10,13 @@ leaf index advertised in the SCT extension.
 package main
 
 import (
-	"encoding/base64"
 	"encoding/json"
-	"encoding/pem"
-	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
 
-	"filippo.io/sunlight"
-	"github.com/adem-wg/adem-proto/pkg/consts"
-	"github.com/adem-wg/adem-proto/pkg/tokens"
-	ct "github.com/google/certificate-transparency-go"
-	"github.com/google/certificate-transparency-go/tls"
-	"github.com/google/certificate-transparency-go/x509"
+	"github.com/adem-wg/adem-proto/pkg/roots"
 )
 
 var certPath string
@@ -33,75 +25,6 @@ func init() {
 	flag.StringVar(&certPath, "cert", "", "path to certificate or certificate chain; log type is detected automatically")
 }
 
-func loadCerts(path string) ([]*x509.Certificate, error) {
-	if toDecode, err := os.ReadFile(path); err != nil {
-		return nil, err
-	} else {
-		certs := make([]*x509.Certificate, 0)
-		var block *pem.Block
-		var rest []byte
-		for rest == nil || len(rest) > 0 {
-			if block, rest = pem.Decode(toDecode); block == nil {
-				return nil, errors.New("could not decode PEM")
-			} else {
-				toDecode = rest
-				if cert, err := x509.ParseCertificate(block.Bytes); err != nil {
-					return nil, err
-				} else {
-					certs = append(certs, cert)
-				}
-			}
-		}
-		return certs, nil
-	}
-}
-
-func mkV1Cfg(logID []byte, leaf *ct.MerkleTreeLeaf) (*tokens.LogConfig, error) {
-	if hash, err := ct.LeafHashForLeaf(leaf); err != nil {
-		return nil, err
-	} else {
-		cfg := tokens.LogConfig{
-			Ver: consts.LogVersionV1,
-			Id:  base64.StdEncoding.EncodeToString(logID),
-			Hash: &tokens.LeafHash{
-				B64: base64.StdEncoding.EncodeToString(hash[:]),
-			},
-		}
-		return &cfg, nil
-	}
-}
-
-func mkStaticCfg(logID []byte, sct *ct.SignedCertificateTimestamp) (*tokens.LogConfig, error) {
-	if ext, err := sunlight.ParseExtensions(sct.Extensions); err != nil {
-		return nil, err
-	} else {
-		return &tokens.LogConfig{
-			Ver:   consts.LogVersionStatic,
-			Id:    base64.StdEncoding.EncodeToString(logID),
-			Index: &ext.LeafIndex,
-		}, nil
-	}
-}
-
-func mkV1Leaf(certChain []*x509.Certificate, timestamp uint64) (*ct.MerkleTreeLeaf, error) {
-	cert := certChain[0]
-	if len(cert.SCTList.SCTList) > 0 {
-		return ct.MerkleTreeLeafForEmbeddedSCT(certChain, timestamp)
-	} else {
-		return ct.MerkleTreeLeafFromChain(certChain, ct.X509LogEntryType, timestamp)
-	}
-}
-
-func mkCfg(certChain []*x509.Certificate, sct *ct.SignedCertificateTimestamp) (*tokens.LogConfig, error) {
-	if len(sct.Extensions) > 0 {
-		return mkStaticCfg(sct.LogID.KeyID[:], sct)
-	} else if leaf, err := mkV1Leaf(certChain, sct.Timestamp); err != nil {
-		return nil, err
-	} else {
-		return mkV1Cfg(sct.LogID.KeyID[:], leaf)
-	}
-}
-
 func main() {
 	flag.Parse()
 
@@ -109,21 +32,14 @@ func main() {
 		log.Fatal("no certificate provided")
 	}
 
-	if certChain, err := loadCerts(certPath); err != nil {
+	if bs, err := os.ReadFile(certPath); err != nil {
+		log.Fatalf("could not load certificates: %s", err)
+	} else if certChain, err := roots.ParseCerts(bs); err != nil {
 		log.Fatalf("could not load certificates: %s", err)
 	} else {
-		logs := []*tokens.LogConfig{}
-		for _, serializedSct := range certChain[0].SCTList.SCTList {
-			var sct ct.SignedCertificateTimestamp
-			if _, err := tls.Unmarshal(serializedSct.Val, &sct); err != nil {
-				log.Printf("could not deserialize the sct: %s", err)
-			} else {
-				if cfg, err := mkCfg(certChain, &sct); err != nil {
-					log.Printf("could not build log config: %s", err)
-				} else {
-					logs = append(logs, cfg)
-				}
-			}
+		logs, errs := roots.LogConfigs(certChain)
+		for _, err := range errs {
+			log.Printf("could not build log config: %s", err)
 		}
 
 		if len(logs) == 0 {
@@ -9,23 +9,37 @@ import (
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/adem-wg/adem-proto/pkg/args"
+	"github.com/adem-wg/adem-proto/pkg/bundle"
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/cose"
 	"github.com/lestrrat-go/jwx/v3/jwa"
 	"github.com/lestrrat-go/jwx/v3/jwk"
 )
 
 func init() {
 	args.AddPublicKeyAlgArgs()
-	flag.BoolVar(&quoted, "quoted", false, "quote each output line as DNS TXT record contents")
+	args.AddFormatArgs()
+	flag.BoolVar(&quoted, "quoted", false, "quote each output line as DNS TXT record contents, split into strings of at most 255 bytes")
 }
 
 var quoted bool
 
+// Maximum length of a character string in DNS TXT records
+const txtStringLen = 255
+
 func printLn(format string, ins ...any) {
 	s := fmt.Sprintf(format, ins...)
 	if quoted {
-		s = strconv.Quote(s)
+		// Resolvers concatenate the strings of a TXT record
+		strs := []string{}
+		for len(s) > txtStringLen {
+			strs = append(strs, strconv.Quote(s[:txtStringLen]))
+			s = s[txtStringLen:]
+		}
+		s = strings.Join(append(strs, strconv.Quote(s)), " ")
 	}
 	fmt.Println(s)
 }
@@ -46,7 +60,21 @@ func printTokens(path string) {
 	}
 }
 
-func printKeys(keys jwk.Set, alg jwa.SignatureAlgorithm, setAlg bool) {
+// Encode a public key for the adem-key record, either as JWK or as
+// base64url-encoded COSE_Key.
+func encodeKey(pk jwk.Key, format consts.Format) ([]byte, error) {
+	if format == consts.FormatCOSE {
+		if bs, err := cose.EncodeKey(pk); err != nil {
+			return nil, err
+		} else {
+			return cose.EncodeText(bs), nil
+		}
+	} else {
+		return json.Marshal(pk)
+	}
+}
+
+func printKeys(keys jwk.Set, alg jwa.SignatureAlgorithm, setAlg bool, format consts.Format) {
 	if keys == nil {
 		log.Fatal("key set is nil")
 	}
@@ -64,16 +92,30 @@ func printKeys(keys jwk.Set, alg jwa.SignatureAlgorithm, setAlg bool) {
 				}
 			}
 
-			if bJwk, err := json.Marshal(pk); err != nil {
+			if bKey, err := encodeKey(pk, format); err != nil {
 				log.Printf("could not encode key: %s", err)
 				continue
 			} else {
-				printLn("adem-key=%s", bJwk)
+				printLn("adem-key=%s", bKey)
 			}
 		}
 	}
 }
 
+func printBundle(bs []byte, alg jwa.SignatureAlgorithm, setAlg bool, format consts.Format) {
+	if b, err := bundle.Parse(bs); err != nil {
+		log.Printf("cannot load bundle: %s", err)
+	} else {
+		printLn("adem-token=%s", b.Emblem)
+		for _, end := range b.Endorsements {
+			printLn("adem-token=%s", end)
+		}
+		if b.Keys != nil {
+			printKeys(b.Keys, alg, setAlg, format)
+		}
+	}
+}
+
 func main() {
 	flag.Parse()
 	files := flag.Args()
@@ -83,22 +125,28 @@ func main() {
 	}
 
 	alg, algOk := args.LoadPKAlgOpt()
+	format := args.LoadFormat()
 
 	for _, file := range files {
+		if bs, err := os.ReadFile(file); err == nil && bundle.IsBundle(bs) {
+			printBundle(bs, alg, algOk, format)
+			continue
+		}
+
 		switch filepath.Ext(file) {
-		case ".jws":
+		case ".jws", ".cose":
 			printTokens(file)
 		case ".pem":
 			if keys, err := args.LoadKeys(file, false); err != nil {
 				log.Printf("cannot load keys: %s", err)
 			} else {
-				printKeys(keys, alg, algOk)
+				printKeys(keys, alg, algOk, format)
 			}
 		case ".jwk":
 			if keys, err := args.LoadKeys(file, true); err != nil {
 				log.Printf("cannot load keys: %s", err)
 			} else {
-				printKeys(keys, alg, algOk)
+				printKeys(keys, alg, algOk, format)
 			}
 		default:
 			log.Printf("unsupported file format: %s", file)
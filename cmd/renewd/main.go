@@ -0,0 +1,141 @@
+/*
+This tool is a daemon that renews an emblem before it expires. It periodically
+checks the emblem in -out and, once the emblem expires within -window, signs a
+new emblem from the claims prototype (-proto) that is valid for -lifetime
+seconds.
+
+Usage:
+
+	renewd -out FILE -proto FILE -alg ALG (-skey FILE | -signer SOCKET)
+		[-format jws|cose] [-window DURATION] [-interval DURATION] [-hook CMD]
+		[-endorsements GLOB] [-alert-window DURATION] [-alert CMD] [-once]
+
+-out either holds newline-separated tokens or a bundle (see bundle). Only the
+emblem is replaced; other tokens and keys are kept. The file is replaced
+atomically, i.e., readers never see partially written output. If -out does not
+exist, it is created and holds the emblem only. -out must hold at most
+one emblem; emblems split by emblemgen -split cannot be renewed. Encrypted
+signing keys are decrypted once at startup.
+
+After each renewal, the publish hook is called as
+
+	HOOK FILE
+
+e.g., to update DNS records (cf. records). If the hook fails, it is called again
+at the next check. Pending publications are recorded in FILE.pending, i.e., the
+hook is also called again after a restart of the daemon.
+
+Endorsements are signed by other parties' keys and cannot be renewed by the
+daemon. Instead, endorsements in -out and in files matching -endorsements that
+expire within -alert-window raise an alert. Alerts are logged and, if given,
+the alert command is called once per endorsement as
+
+	ALERT FILE KID EXP
+
+where KID is the kid of the endorsement's verification key and EXP its
+expiration time in RFC 3339 format.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/adem-wg/adem-proto/pkg/args"
+	"github.com/adem-wg/adem-proto/pkg/consts"
+)
+
+var outPath string
+var window time.Duration
+var interval time.Duration
+var hook string
+var endorsementsPattern string
+var alertWindow time.Duration
+var alertCmd string
+var once bool
+
+func init() {
+	args.AddSignerArgs()
+	args.AddProtoArgs()
+	args.AddFormatArgs()
+	args.AddClaimExtensionArgs()
+	args.AddCriticalClaimArgs()
+	args.AddTokenLogArgs()
+	flag.StringVar(&outPath, "out", "", "path to the token file or bundle holding the emblem to renew")
+	flag.DurationVar(&window, "window", 12*time.Hour, "renew the emblem once it expires within this window")
+	flag.DurationVar(&interval, "interval", 5*time.Minute, "time between checks")
+	flag.StringVar(&hook, "hook", "", "command to publish the renewed emblem with; called with -out as argument")
+	flag.StringVar(&endorsementsPattern, "endorsements", "", "glob of further endorsement files (newline-separated tokens or bundles) to watch for expiry")
+	flag.DurationVar(&alertWindow, "alert-window", 7*24*time.Hour, "raise an alert once an endorsement expires within this window")
+	flag.StringVar(&alertCmd, "alert", "", "command to raise alerts with; called with file, kid, and expiration time of the endorsement")
+	flag.BoolVar(&once, "once", false, "check once and exit, e.g., when run from cron")
+}
+
+func main() {
+	flag.Parse()
+	args.LoadClaimExtensions()
+	if outPath == "" {
+		log.Fatal("no -out given")
+	} else if window <= 0 || interval <= 0 {
+		log.Fatal("-window and -interval must be positive")
+	}
+
+	proto := args.LoadClaimsProto(consts.EmblemCty)
+	if proto.Has("exp") || proto.Has("nbf") {
+		log.Fatal("-proto must not specify exp or nbf; renewed emblems would not be valid for longer")
+	} else if time.Duration(args.LoadLifetime())*time.Second <= window {
+		log.Fatal("-lifetime must be longer than -window")
+	}
+
+	if _, _, err := readOutput(outPath); errors.Is(err, ErrSplitEmblem) {
+		log.Fatalf("%s: %s", outPath, err)
+	}
+
+	r := &renewer{
+		signer:       args.LoadSigner(),
+		alg:          args.LoadAlg(),
+		format:       args.LoadFormat(),
+		headerKeyJwk: args.LoadHeaderKeyJWK(),
+		proto:        proto,
+		lifetime:     args.LoadLifetime(),
+		tokenLog:     args.LoadTokenLog(),
+		alerted:      make(map[string]bool),
+	}
+	if r.format == consts.FormatCOSE && r.headerKeyJwk {
+		log.Fatal("COSE-encoded tokens reference their verification key by kid only")
+	} else if r.format == consts.FormatCOSE && args.LoadX5C() != nil {
+		log.Fatal("COSE-encoded tokens cannot carry certificate chains")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := r.check(ctx); err != nil && once {
+		log.Fatal(err)
+	} else if err != nil {
+		log.Print(err)
+	}
+	if once {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			log.Print("stopping")
+			return
+		case <-ticker.C:
+			if err := r.check(ctx); err != nil {
+				log.Print(err)
+			}
+		}
+	}
+}
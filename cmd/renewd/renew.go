@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/adem-wg/adem-proto/pkg/args"
+	"github.com/adem-wg/adem-proto/pkg/bundle"
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/cose"
+	"github.com/adem-wg/adem-proto/pkg/gen"
+	"github.com/adem-wg/adem-proto/pkg/tokenlog"
+	"github.com/adem-wg/adem-proto/pkg/util"
+	"github.com/adem-wg/adem-proto/pkg/vfy"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var ErrNoExp = errors.New("token has no exp claim")
+var ErrExpiresInWindow = errors.New("renewed emblem expires within the renewal window")
+var ErrSplitEmblem = errors.New("output holds several emblems; split emblems cannot be renewed")
+
+type renewer struct {
+	signer       gen.Signer
+	alg          jwa.SignatureAlgorithm
+	format       consts.Format
+	headerKeyJwk bool
+	proto        jwt.Token
+	lifetime     int64
+	// Token log to append renewed emblems to; may be nil
+	tokenLog *tokenlog.Log
+	// Endorsements an alert was raised for
+	alerted map[string]bool
+}
+
+// Return a token's expiration time without verifying the token.
+func expiration(raw []byte) (time.Time, error) {
+	if t, err := vfy.ParseUnverified(raw); err != nil {
+		return time.Time{}, err
+	} else if exp, ok := t.Expiration(); !ok {
+		return time.Time{}, ErrNoExp
+	} else {
+		return exp, nil
+	}
+}
+
+// Read the emblem and endorsements of the output file. Returns a nil emblem if
+// the file does not exist yet or is empty.
+func readOutput(path string) ([]byte, [][]byte, error) {
+	ts, err := args.ReadTokens(path)
+	if errors.Is(err, fs.ErrNotExist) || (err == nil && len(ts) == 0) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	var emblem []byte
+	endorsements := [][]byte{}
+	for _, t := range ts {
+		if cty, err := bundle.ContentType(t); err != nil {
+			// Keys and other non-tokens are kept as is
+			continue
+		} else if cty == string(consts.EndorsementCty) {
+			endorsements = append(endorsements, t)
+		} else if emblem != nil {
+			return nil, nil, ErrSplitEmblem
+		} else {
+			emblem = t
+		}
+	}
+	if emblem == nil {
+		return nil, nil, bundle.ErrNoEmblem
+	}
+	return emblem, endorsements, nil
+}
+
+// Path of the marker file recording that the emblem in the output file has not
+// been published yet. Unlike in-memory state, the marker survives restarts of
+// the daemon, e.g., between runs with -once.
+func pendingPath() string {
+	return outPath + ".pending"
+}
+
+// Record that the output file needs to be published, if there is a publish
+// hook.
+func markUnpublished() error {
+	if hook == "" {
+		return nil
+	}
+	return util.WriteFileAtomic(pendingPath(), nil, 0644)
+}
+
+// Check whether the output file still needs to be published.
+func isUnpublished() bool {
+	_, err := os.Stat(pendingPath())
+	return err == nil
+}
+
+// Record that the output file has been published.
+func markPublished() error {
+	if err := os.Remove(pendingPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Replace the emblem in the output file's contents. Returns the new contents
+// and the file's permissions.
+func replaceEmblem(path string, emblem []byte) ([]byte, os.FileMode, error) {
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return append(emblem, '\n'), 0644, nil
+	} else if err != nil {
+		return nil, 0, err
+	}
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	if bundle.IsBundle(bs) {
+		if b, err := bundle.Parse(bs); err != nil {
+			return nil, 0, err
+		} else {
+			b.Emblem = string(emblem)
+			if b.Hash, err = b.ContentHash(); err != nil {
+				return nil, 0, err
+			} else if out, err := json.MarshalIndent(b, "", "  "); err != nil {
+				return nil, 0, err
+			} else {
+				return append(out, '\n'), perm, nil
+			}
+		}
+	}
+
+	lines := bytes.Split(bs, []byte("\n"))
+	for i, line := range lines {
+		if cty, err := bundle.ContentType(bytes.TrimSpace(line)); err == nil && cty != string(consts.EndorsementCty) {
+			lines[i] = emblem
+			return bytes.Join(lines, []byte("\n")), perm, nil
+		}
+	}
+	// The file holds no emblem yet
+	if len(bytes.TrimSpace(bs)) > 0 && !bytes.HasSuffix(bs, []byte("\n")) {
+		bs = append(bs, '\n')
+	}
+	return append(append(emblem, '\n'), bytes.TrimLeft(bs, "\n")...), perm, nil
+}
+
+// Sign a new emblem from the claims prototype.
+func (r *renewer) sign() ([]byte, time.Time, error) {
+	proto, err := r.proto.Clone()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	var t jwt.Token
+	var signed []byte
+	if r.format == consts.FormatCOSE {
+		t, signed, err = gen.SignEmblemCOSE(r.signer, r.alg, proto, r.lifetime)
+		signed = cose.EncodeText(signed)
+	} else {
+		t, signed, err = gen.SignEmblem(r.signer, r.headerKeyJwk, r.alg, proto, r.lifetime)
+	}
+	if err != nil {
+		return nil, time.Time{}, err
+	} else if exp, ok := t.Expiration(); !ok {
+		return nil, time.Time{}, ErrNoExp
+	} else {
+		return signed, exp, nil
+	}
+}
+
+// Append the renewed emblem to the token log, if any.
+func (r *renewer) logEmblem(signed []byte) error {
+	if r.tokenLog == nil {
+		return nil
+	} else if entries, err := tokenlog.Entries(signed); err != nil {
+		return err
+	} else {
+		_, err := r.tokenLog.Append(entries...)
+		return err
+	}
+}
+
+// Renew the emblem in the output file if it expires within the renewal window,
+// and publish it, if it has not been published yet. Then raise alerts for
+// expiring endorsements.
+func (r *renewer) check(ctx context.Context) error {
+	now := time.Now()
+	emblem, endorsements, err := readOutput(outPath)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", outPath, err)
+	}
+
+	due := emblem == nil
+	if emblem != nil {
+		if exp, err := expiration(emblem); err != nil {
+			log.Printf("could not read expiration of emblem: %s; renewing", err)
+			due = true
+		} else {
+			due = !now.Add(window).Before(exp)
+		}
+	}
+
+	if due {
+		if signed, exp, err := r.sign(); err != nil {
+			return fmt.Errorf("could not sign emblem: %w", err)
+		} else if !now.Add(window).Before(exp) {
+			return ErrExpiresInWindow
+		} else if err := r.logEmblem(signed); err != nil {
+			return fmt.Errorf("could not log emblem: %w", err)
+		} else if out, perm, err := replaceEmblem(outPath, signed); err != nil {
+			return fmt.Errorf("could not update %s: %w", outPath, err)
+		} else if err := markUnpublished(); err != nil {
+			// Mark before writing such that a crash cannot lose the publication
+			return fmt.Errorf("could not write %s: %w", pendingPath(), err)
+		} else if err := util.WriteFileAtomic(outPath, out, perm); err != nil {
+			return fmt.Errorf("could not write %s: %w", outPath, err)
+		} else {
+			log.Printf("renewed emblem in %s; valid until %s", outPath, exp.Format(time.RFC3339))
+		}
+	}
+
+	if hook != "" && isUnpublished() {
+		if err := run(ctx, hook, outPath); err != nil {
+			return fmt.Errorf("publish hook failed: %w", err)
+		} else if err := markPublished(); err != nil {
+			return fmt.Errorf("could not remove %s: %w", pendingPath(), err)
+		}
+		log.Printf("published %s", outPath)
+	}
+
+	r.checkEndorsements(ctx, now, outPath, endorsements)
+	if endorsementsPattern != "" {
+		matches, err := filepath.Glob(endorsementsPattern)
+		if err != nil {
+			return fmt.Errorf("cannot expand endorsements glob: %w", err)
+		}
+		for _, path := range matches {
+			if ts, err := args.ReadTokens(path); err != nil {
+				log.Printf("could not read endorsements: %s", err)
+			} else {
+				r.checkEndorsements(ctx, now, path, ts)
+			}
+		}
+	}
+	return nil
+}
+
+// Raise an alert for each endorsement read from path that expires within the
+// alert window. Tokens that are no endorsements are ignored.
+func (r *renewer) checkEndorsements(ctx context.Context, now time.Time, path string, ts [][]byte) {
+	for _, raw := range ts {
+		if cty, err := bundle.ContentType(raw); err != nil || cty != string(consts.EndorsementCty) {
+			continue
+		} else if r.alerted[string(raw)] {
+			continue
+		}
+
+		exp, err := expiration(raw)
+		if err != nil {
+			log.Printf("could not read expiration of endorsement in %s: %s", path, err)
+			continue
+		} else if now.Add(alertWindow).Before(exp) {
+			continue
+		}
+
+		kid, err := vfy.VerificationKID(raw)
+		if err != nil {
+			kid = "unknown"
+		}
+		if exp.Before(now) {
+			log.Printf("ALERT: endorsement in %s signed by %s expired at %s", path, kid, exp.Format(time.RFC3339))
+		} else {
+			log.Printf("ALERT: endorsement in %s signed by %s expires at %s", path, kid, exp.Format(time.RFC3339))
+		}
+
+		if alertCmd != "" {
+			if err := run(ctx, alertCmd, path, kid, exp.Format(time.RFC3339)); err != nil {
+				log.Printf("alert command failed: %s", err)
+				continue
+			}
+		}
+		r.alerted[string(raw)] = true
+	}
+}
+
+func run(ctx context.Context, command string, arg ...string) error {
+	cmd := exec.CommandContext(ctx, command, arg...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
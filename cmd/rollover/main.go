@@ -0,0 +1,445 @@
+/*
+This tool guides an organization through rotating its root key. It keeps its
+state in a directory and walks through the following stages, checking the
+result of each stage before the next one can be run:
+
+	rollover start -dir DIR -alg ALG [-encrypt] [-new-pass SRC] TOKENS...
+	rollover cert -dir DIR -cert CHAIN
+	rollover check -dir DIR
+	rollover endorse -dir DIR [-pass SRC]
+	rollover publish -dir DIR [-quoted]
+	rollover finish -dir DIR
+	rollover status -dir DIR
+
+start reads the currently published tokens and keys (newline-separated, as in
+DNS, or bundles), identifies the root key as the key that signs endorsements
+with a log claim, and generates a new root key. It prints the DNS names that
+the new root key's configuration certificate must be valid for.
+
+cert takes the issued certificate chain, checks its names, and derives the new
+log claim from its embedded SCTs (cf. leafhash). check verifies that the new
+root key is committed to the CT logs (cf. rootsetupcheck). Certificates are
+only included in logs after their maximum merge delay; repeat check until it
+succeeds.
+
+endorse re-signs all tokens of the old root key with the new root key and the
+new log claim, and verifies each emblem with the new endorsements. publish
+prints the DNS records of the new setup (cf. records). Until the new
+commitment verifies, only the old setup is published. Afterwards, the new
+records replace the old ones; verifiers reject setups with two endorsements of
+the same key. Old and new root keys overlap: the old root key's configuration
+certificate must stay valid until all tokens of the old root key have expired.
+finish checks this and concludes the rollover.
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/adem-wg/adem-proto/pkg/args"
+	"github.com/adem-wg/adem-proto/pkg/cose"
+	"github.com/adem-wg/adem-proto/pkg/gen"
+	"github.com/adem-wg/adem-proto/pkg/keystore"
+	"github.com/adem-wg/adem-proto/pkg/roots"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/adem-wg/adem-proto/pkg/util"
+	"github.com/adem-wg/adem-proto/pkg/vfy"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var dir string
+var alg string
+var encrypt bool
+var pass string
+var newPass string
+var certPath string
+var quoted bool
+
+func init() {
+	args.AddCTArgs()
+	args.AddClaimExtensionArgs()
+	args.AddCriticalClaimArgs()
+	flag.StringVar(&dir, "dir", "", "directory to keep the rollover state in")
+	flag.StringVar(&alg, "alg", "", "algorithm of the new root key (start only)")
+	flag.BoolVar(&encrypt, "encrypt", false, "encrypt the new root key (start only)")
+	flag.StringVar(&pass, "pass", "prompt", "passphrase source for the new root key: prompt, env:NAME, or fd:N")
+	flag.StringVar(&newPass, "new-pass", "prompt", "passphrase source to encrypt the new root key with: prompt, env:NAME, or fd:N")
+	flag.StringVar(&certPath, "cert", "", "path to the new root key's configuration certificate chain, leaf first (cert only)")
+	flag.BoolVar(&quoted, "quoted", false, "quote each record as DNS TXT record contents (publish only)")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("no subcommand given (expected start, cert, check, endorse, publish, finish, or status)")
+	}
+	cmd := os.Args[1]
+	if err := flag.CommandLine.Parse(os.Args[2:]); err != nil {
+		log.Fatal(err)
+	} else if dir == "" {
+		log.Fatal("no -dir given")
+	}
+	args.LoadClaimExtensions()
+
+	switch cmd {
+	case "start":
+		start()
+	case "cert":
+		certify()
+	case "check":
+		check()
+	case "endorse":
+		endorse()
+	case "publish":
+		publish()
+	case "finish":
+		finish()
+	case "status":
+		status()
+	default:
+		log.Fatalf("unknown subcommand: %s", cmd)
+	}
+}
+
+// Return the subcommand that advances a rollover at the given stage.
+func nextStep(s stage) string {
+	switch s {
+	case STARTED:
+		return "cert"
+	case CERTIFIED:
+		return "check"
+	case COMMITTED:
+		return "endorse"
+	case ENDORSED:
+		return "publish"
+	case PUBLISHED:
+		return "finish"
+	default:
+		return "start"
+	}
+}
+
+// Return the names the configuration certificate of the given root key must be
+// valid for.
+func certNames(iss string, kid string) []string {
+	if names, err := roots.ConfigurationNames(iss, kid); err != nil {
+		log.Fatalf("could not parse issuer: %s", err)
+		return nil
+	} else {
+		return names
+	}
+}
+
+func start() {
+	if _, err := os.Stat(path(stateFile)); err == nil {
+		log.Fatalf("%s already holds a rollover", dir)
+	} else if flag.NArg() == 0 {
+		log.Fatal("no token files given")
+	}
+
+	ts := [][]byte{}
+	for _, file := range flag.Args() {
+		if fileTs, err := args.ReadTokens(file); err != nil {
+			log.Fatalf("could not read tokens: %s", err)
+		} else {
+			ts = append(ts, fileTs...)
+		}
+	}
+
+	oldKid, iss, err := findRoot(ts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	old := splitSetup(ts, oldKid)
+	log.Printf("current root key %s of %s signs %d token(s)", oldKid, iss, len(old.rootSigned))
+
+	if err := args.FetchKnownLogs(); err != nil {
+		log.Printf("could not fetch known logs; cannot check current setup: %s", err)
+	} else if !verifySetup(old, old.rootSigned, old.rawKeys) {
+		log.Print("current setup does not verify as ORGANIZATIONAL; continuing nonetheless")
+	}
+
+	keyAlg, ok := jwa.LookupSignatureAlgorithm(alg)
+	if !ok {
+		log.Fatalf(`"-alg %s" algorithm not found`, alg)
+	}
+	key, err := tokens.GenerateKey(keyAlg)
+	if err != nil {
+		log.Fatalf("could not generate key: %s", err)
+	}
+	newKid, _ := key.KeyID()
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		log.Fatalf("could not create state directory: %s", err)
+	}
+	set := jwk.NewSet()
+	set.AddKey(key)
+	var keyBs []byte
+	if encrypt {
+		keyBs, err = keystore.EncryptPEM(set, args.PassphraseFrom(newPass, "New passphrase", true))
+	} else {
+		keyBs, err = jwk.Pem(set)
+	}
+	if err != nil {
+		log.Fatalf("could not encode key: %s", err)
+	}
+	writeFile(keyFile, keyBs)
+	if pk, err := key.PublicKey(); err != nil {
+		log.Fatalf("could not get public key: %s", err)
+	} else if bs, err := json.Marshal(pk); err != nil {
+		log.Fatalf("could not encode public key: %s", err)
+	} else {
+		writeFile(pubKeyFile, bs)
+	}
+	writeTokens(tokensFile, ts)
+
+	st := &state{
+		Stage:     STARTED,
+		Issuer:    iss,
+		Alg:       keyAlg.String(),
+		OldKid:    oldKid,
+		NewKid:    newKid,
+		OldExpiry: latestExpiry(old.rootSigned),
+	}
+	st.save()
+
+	fmt.Printf("generated new root key %s\n", newKid)
+	fmt.Println("request a certificate that is valid for:")
+	for _, name := range certNames(iss, newKid) {
+		fmt.Printf("  %s\n", name)
+	}
+	fmt.Printf("then run: rollover cert -dir %s -cert <chain>\n", dir)
+}
+
+func certify() {
+	st := loadStateAt(STARTED)
+	if certPath == "" {
+		log.Fatal("no -cert given")
+	}
+
+	bs, err := os.ReadFile(certPath)
+	if err != nil {
+		log.Fatalf("could not read certificate: %s", err)
+	}
+	chain, err := roots.ParseCerts(bs)
+	if err != nil {
+		log.Fatalf("could not parse certificate: %s", err)
+	}
+
+	leaf := chain[0]
+	for _, name := range certNames(st.Issuer, st.NewKid) {
+		if !util.Contains(leaf.DNSNames, name) {
+			log.Fatalf("certificate is not valid for %s", name)
+		}
+	}
+	if time.Now().After(leaf.NotAfter) {
+		log.Fatal("certificate has expired")
+	}
+
+	logs, errs := roots.LogConfigs(chain)
+	for _, err := range errs {
+		log.Printf("could not build log config: %s", err)
+	}
+	if len(logs) == 0 {
+		log.Fatal("certificate carries no SCTs; was it logged?")
+	}
+
+	if logsBs, err := json.MarshalIndent(logs, "", "  "); err != nil {
+		log.Fatalf("could not encode log claim: %s", err)
+	} else {
+		writeFile(certFile, bs)
+		writeFile(logsFile, logsBs)
+	}
+	st.advance(CERTIFIED)
+	fmt.Printf("derived log claim for %d log(s); next run: rollover check -dir %s\n", len(logs), dir)
+}
+
+// Verify the CT commitment of the new root key. Returns false if it cannot be
+// verified (yet).
+func verifyCommitment(st *state) bool {
+	if err := args.FetchKnownLogs(); err != nil {
+		log.Fatalf("could not fetch known CT logs: %s", err)
+	}
+
+	pk := loadPublicKey()
+	ok := true
+	for _, r := range roots.VerifyBindingCerts(st.Issuer, pk, loadLogs()) {
+		var msg string
+		if r.Ok {
+			msg = "root key correctly committed to log"
+		} else {
+			msg = "root key commitment verification failed for log"
+			ok = false
+		}
+		log.Printf("%s:\n\turl:  %s\n\tname: %s", msg, r.LogURL, r.LogID)
+	}
+	return ok
+}
+
+func check() {
+	st := loadStateAt(CERTIFIED)
+	if !verifyCommitment(st) {
+		log.Fatal("new root key commitment does not verify (yet); keep the current setup published and retry later")
+	}
+	st.advance(COMMITTED)
+	fmt.Printf("new root key commitment verifies; next run: rollover endorse -dir %s\n", dir)
+}
+
+// Return the keys of the new setup: the keys of the old setup with the new
+// root key replacing the old root key.
+func newKeys(st *state, old *setup) [][]byte {
+	pk := loadPublicKey()
+	asCOSE := false
+	keys := [][]byte{}
+	for i, key := range old.keys {
+		if kid, err := tokens.SetKID(key, true); err == nil && kid == st.OldKid {
+			_, err := jwk.ParseKey(old.rawKeys[i])
+			asCOSE = err != nil
+		} else {
+			keys = append(keys, old.rawKeys[i])
+		}
+	}
+
+	if !asCOSE {
+		if bs, err := json.Marshal(pk); err != nil {
+			log.Fatalf("could not encode root key: %s", err)
+		} else {
+			keys = append(keys, bs)
+		}
+	} else if bs, err := cose.EncodeKey(pk); err != nil {
+		log.Fatalf("could not encode root key: %s", err)
+	} else {
+		keys = append(keys, cose.EncodeText(bs))
+	}
+	return keys
+}
+
+func endorse() {
+	st := loadStateAt(COMMITTED)
+	keyAlg, _ := jwa.LookupSignatureAlgorithm(st.Alg)
+	keys, err := args.LoadSecretKeys(path(keyFile), false, args.PassphraseFrom(pass, "Passphrase for "+path(keyFile), false))
+	if err != nil {
+		log.Fatalf("could not load root key: %s", err)
+	}
+	key, _ := keys.Key(0)
+	signer, err := gen.KeySigner(key)
+	if err != nil {
+		log.Fatalf("could not load root key: %s", err)
+	}
+
+	logs := loadLogs()
+	pk := loadPublicKey()
+	old := splitSetup(readTokens(tokensFile), st.OldKid)
+	endorsements := [][]byte{}
+	for _, raw := range old.rootSigned {
+		oldToken, err := vfy.ParseUnverified(raw)
+		if err != nil {
+			log.Fatalf("could not parse token: %s", err)
+		}
+		lifetime := int64(172800)
+		if nbf, ok := oldToken.NotBefore(); ok {
+			if exp, ok := oldToken.Expiration(); ok {
+				lifetime = exp.Unix() - nbf.Unix()
+			}
+		}
+
+		_, signed, err := gen.Resign(signer, keyAlg, raw, lifetime, func(t jwt.Token) error {
+			return updateClaims(t, st, pk, logs)
+		})
+		if err != nil {
+			log.Fatalf("could not sign endorsement: %s", err)
+		}
+		endorsements = append(endorsements, signed)
+	}
+
+	if err := args.FetchKnownLogs(); err != nil {
+		log.Fatalf("could not fetch known CT logs: %s", err)
+	} else if !verifySetup(old, endorsements, newKeys(st, old)) {
+		log.Fatal("new setup does not verify as ORGANIZATIONAL")
+	}
+
+	writeTokens(endorsementsFile, endorsements)
+	st.advance(ENDORSED)
+	fmt.Printf("signed %d token(s) with the new root key; next run: rollover publish -dir %s\n", len(endorsements), dir)
+}
+
+// Update the claims of a token of the old root key for the new root key. Tokens
+// that endorse the old root key itself endorse the new root key instead.
+func updateClaims(t jwt.Token, st *state, pk jwk.Key, logs tokens.Log) error {
+	if t.Has("log") {
+		if err := t.Set("log", logs); err != nil {
+			return err
+		}
+	}
+
+	if kid, err := tokens.GetEndorsedKID(t); err != nil || kid != st.OldKid {
+		return nil
+	} else if err := t.Set("key", st.NewKid); err != nil {
+		return err
+	} else if t.Has("jwk") {
+		return t.Set("jwk", tokens.EmbeddedKey{Key: pk})
+	}
+	return nil
+}
+
+func printRecord(format string, ins ...any) {
+	s := fmt.Sprintf(format, ins...)
+	if quoted {
+		s = strconv.Quote(s)
+	}
+	fmt.Println(s)
+}
+
+func publish() {
+	st := loadStateAt(ENDORSED)
+	old := splitSetup(readTokens(tokensFile), st.OldKid)
+	ts := append(append(append([][]byte{}, old.emblems...), old.others...), readTokens(endorsementsFile)...)
+	for _, t := range ts {
+		printRecord("adem-token=%s", t)
+	}
+	for _, k := range newKeys(st, old) {
+		printRecord("adem-key=%s", k)
+	}
+
+	if st.Published == 0 {
+		st.Published = time.Now().Unix()
+	}
+	st.advance(PUBLISHED)
+	log.Print("replace the current records with the records above")
+	log.Printf("keep the configuration certificate of the old root key %s valid until %s", st.OldKid, formatTime(st.OldExpiry))
+}
+
+func finish() {
+	st := loadStateAt(PUBLISHED)
+	if now := time.Now().Unix(); now < st.OldExpiry {
+		log.Fatalf("tokens of the old root key are valid until %s; finish the rollover afterwards", formatTime(st.OldExpiry))
+	} else if !verifyCommitment(st) {
+		log.Fatal("new root key commitment does not verify anymore")
+	}
+	st.advance(DONE)
+	fmt.Printf("rollover done; %s may retire the old root key %s and its configuration certificate\n", st.Issuer, st.OldKid)
+}
+
+func status() {
+	st := loadState()
+	fmt.Printf("issuer:        %s\n", st.Issuer)
+	fmt.Printf("old root key:  %s\n", st.OldKid)
+	fmt.Printf("new root key:  %s\n", st.NewKid)
+	fmt.Printf("stage:         %s\n", st.Stage)
+	if st.OldExpiry > 0 {
+		fmt.Printf("old tokens:    valid until %s\n", formatTime(st.OldExpiry))
+	}
+	if st.Published > 0 {
+		fmt.Printf("published:     %s\n", formatTime(st.Published))
+	}
+	if st.Stage != DONE {
+		fmt.Printf("next step:     rollover %s -dir %s\n", nextStep(st.Stage), dir)
+	}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adem-wg/adem-proto/pkg/args"
+	"github.com/adem-wg/adem-proto/pkg/bundle"
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/cose"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/adem-wg/adem-proto/pkg/util"
+	"github.com/adem-wg/adem-proto/pkg/vfy"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+var ErrNoRoot = errors.New("no endorsement with root key commitment (log claim) found")
+var ErrSeveralRoots = errors.New("endorsements with root key commitments are signed by several keys")
+var ErrSeveralIssuers = errors.New("endorsements with root key commitments state different issuers")
+
+// Stages of a rollover in the order they are passed.
+type stage int
+
+const (
+	STARTED stage = iota
+	CERTIFIED
+	COMMITTED
+	ENDORSED
+	PUBLISHED
+	DONE
+)
+
+var stageNames = []string{"started", "certified", "committed", "endorsed", "published", "done"}
+
+func (s stage) String() string {
+	return stageNames[s]
+}
+
+func (s stage) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *stage) UnmarshalJSON(bs []byte) error {
+	var name string
+	if err := json.Unmarshal(bs, &name); err != nil {
+		return err
+	}
+	for i, n := range stageNames {
+		if n == name {
+			*s = stage(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown stage: %s", name)
+}
+
+// Files in the state directory
+const stateFile = "state.json"
+
+// Tokens and keys of the setup before the rollover
+const tokensFile = "tokens.txt"
+
+// Private and public key of the new root key
+const keyFile = "root.pem"
+const pubKeyFile = "root.pub.jwk"
+
+// Configuration certificate chain of the new root key and the derived log
+// claim
+const certFile = "cert.pem"
+const logsFile = "logs.json"
+
+// Endorsements signed by the new root key
+const endorsementsFile = "endorsements.txt"
+
+type state struct {
+	Stage  stage  `json:"stage"`
+	Issuer string `json:"iss"`
+	Alg    string `json:"alg"`
+	OldKid string `json:"oldKid"`
+	NewKid string `json:"newKid"`
+	// Expiration time of the last token signed by the old root key
+	OldExpiry int64 `json:"oldExpiry"`
+	// When the new setup was published
+	Published int64 `json:"published,omitempty"`
+}
+
+func path(name string) string {
+	return filepath.Join(dir, name)
+}
+
+func loadState() *state {
+	var st state
+	if bs, err := os.ReadFile(path(stateFile)); err != nil {
+		log.Fatalf("could not read rollover state: %s", err)
+	} else if err := json.Unmarshal(bs, &st); err != nil {
+		log.Fatalf("could not parse rollover state: %s", err)
+	}
+	return &st
+}
+
+// Load the state and check that the rollover passed the given stage.
+func loadStateAt(min stage) *state {
+	st := loadState()
+	if st.Stage < min {
+		log.Fatalf("rollover is %s; run %s first", st.Stage, nextStep(st.Stage))
+	}
+	return st
+}
+
+func (st *state) save() {
+	if bs, err := json.MarshalIndent(st, "", "  "); err != nil {
+		log.Fatalf("could not encode rollover state: %s", err)
+	} else if err := os.WriteFile(path(stateFile), bs, 0600); err != nil {
+		log.Fatalf("could not write rollover state: %s", err)
+	}
+}
+
+// Advance to the given stage unless the rollover is already further.
+func (st *state) advance(to stage) {
+	if st.Stage < to {
+		st.Stage = to
+	}
+	st.save()
+}
+
+func writeFile(name string, bs []byte) {
+	if err := os.WriteFile(path(name), bs, 0600); err != nil {
+		log.Fatalf("could not write %s: %s", name, err)
+	}
+}
+
+func writeTokens(name string, ts [][]byte) {
+	out := []byte{}
+	for _, t := range ts {
+		out = append(append(out, t...), '\n')
+	}
+	writeFile(name, out)
+}
+
+func readTokens(name string) [][]byte {
+	if ts, err := args.ReadTokens(path(name)); err != nil {
+		log.Fatalf("could not read %s: %s", name, err)
+		return nil
+	} else {
+		return ts
+	}
+}
+
+func loadPublicKey() jwk.Key {
+	if bs, err := os.ReadFile(path(pubKeyFile)); err != nil {
+		log.Fatalf("could not read root key: %s", err)
+		return nil
+	} else if key, err := jwk.ParseKey(bs); err != nil {
+		log.Fatalf("could not parse root key: %s", err)
+		return nil
+	} else {
+		return key
+	}
+}
+
+func loadLogs() tokens.Log {
+	var logs tokens.Log
+	if bs, err := os.ReadFile(path(logsFile)); err != nil {
+		log.Fatalf("could not read log claim: %s", err)
+	} else if err := json.Unmarshal(bs, &logs); err != nil {
+		log.Fatalf("could not parse log claim: %s", err)
+	}
+	return logs
+}
+
+// The tokens and keys of a setup as published in DNS.
+type setup struct {
+	emblems [][]byte
+	// Tokens signed by the root key
+	rootSigned [][]byte
+	// All other tokens, e.g., endorsements by third parties
+	others [][]byte
+	keys   []jwk.Key
+	// Keys in their original encoding
+	rawKeys [][]byte
+}
+
+// Parse a key as published in adem-key records, i.e., as JWK or
+// base64url-encoded COSE_Key.
+func parseKey(raw []byte) (jwk.Key, bool) {
+	if key, err := jwk.ParseKey(raw); err == nil {
+		return key, true
+	} else if cose.IsCOSE(raw) {
+		return nil, false
+	} else if key, err := cose.ParseKey(raw); err == nil {
+		return key, true
+	} else {
+		return nil, false
+	}
+}
+
+// Split tokens into a setup given the KID of the root key.
+func splitSetup(ts [][]byte, rootKid string) *setup {
+	s := &setup{}
+	for _, raw := range ts {
+		if key, ok := parseKey(raw); ok {
+			s.keys = append(s.keys, key)
+			s.rawKeys = append(s.rawKeys, raw)
+		} else if cty, err := bundle.ContentType(raw); err != nil {
+			log.Fatalf("could not parse token: %s", err)
+		} else if cty == string(consts.EmblemCty) {
+			s.emblems = append(s.emblems, raw)
+		} else if kid, err := vfy.VerificationKID(raw); err == nil && kid == rootKid {
+			s.rootSigned = append(s.rootSigned, raw)
+		} else {
+			s.others = append(s.others, raw)
+		}
+	}
+	return s
+}
+
+// Find the KID and issuer of the root key. The root key is the key that signs
+// endorsements with a log claim.
+func findRoot(ts [][]byte) (string, string, error) {
+	kid, iss := "", ""
+	for _, raw := range ts {
+		if _, ok := parseKey(raw); ok {
+			continue
+		} else if t, err := vfy.ParseUnverified(raw); err != nil || !t.Has("log") {
+			continue
+		} else if tKid, err := vfy.VerificationKID(raw); err != nil {
+			return "", "", err
+		} else if tIss, _ := t.Issuer(); kid != "" && tIss != iss {
+			return "", "", ErrSeveralIssuers
+		} else if kid != "" && tKid != kid {
+			return "", "", ErrSeveralRoots
+		} else {
+			kid, iss = tKid, tIss
+		}
+	}
+	if kid == "" {
+		return "", "", ErrNoRoot
+	}
+	return kid, iss, nil
+}
+
+// Return the latest expiration time of the given tokens.
+func latestExpiry(ts [][]byte) int64 {
+	latest := int64(0)
+	for _, raw := range ts {
+		if t, err := vfy.ParseUnverified(raw); err != nil {
+			continue
+		} else if exp, ok := t.Expiration(); ok && exp.Unix() > latest {
+			latest = exp.Unix()
+		}
+	}
+	return latest
+}
+
+// Verify a setup for every emblem it contains. Verifiers cannot process
+// several emblems at once. Returns whether all emblems verify as
+// ORGANIZATIONAL.
+func verifySetup(s *setup, endorsements [][]byte, keys [][]byte) bool {
+	if len(s.emblems) == 0 {
+		log.Print("setup contains no emblem; cannot verify endorsements")
+		return false
+	}
+
+	ok := true
+	for _, emblem := range s.emblems {
+		ts := append([][]byte{emblem}, s.others...)
+		ts = append(ts, endorsements...)
+		ts = append(ts, keys...)
+		results := vfy.VerifyTokens(ts, jwk.NewSet())
+		results.Print()
+		if !util.Contains(results.Results(), vfy.ORGANIZATIONAL) || util.Contains(results.Results(), vfy.INVALID) {
+			ok = false
+		}
+	}
+	return ok
+}
+
+func formatTime(unix int64) string {
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
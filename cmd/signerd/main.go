@@ -0,0 +1,157 @@
+/*
+This tool is a signer daemon implementing the remote signer protocol (see
+package signer). It holds signing keys in a separate process so that tools
+like emblemgen never see them (see emblemgen's -signer flag).
+
+Usage:
+
+	signerd -socket PATH -keys FILE [-keys-jwk] [-pass SRC] [-audit FILE]
+		[-cty CTY,...] [-iss OI,...] [-max-lifetime SECONDS]
+		[-tlog DIR -tlog-key FILE]
+
+Keys may be encrypted; they are decrypted in memory using the passphrase from
+-pass. Every sign request is logged to -audit as JSON line including the
+token's claims, whether it was signed or refused. Requests are refused if the
+token's content type or issuer is not allowed, or if the token is valid for
+longer than -max-lifetime. The socket is only accessible by the daemon's user.
+
+If -tlog is given, the messages of signed tokens are appended to the token log
+in DIR (see package tokenlog), and signatures are only returned once logged.
+Clients should then not log the tokens again.
+*/
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/adem-wg/adem-proto/pkg/args"
+	"github.com/adem-wg/adem-proto/pkg/gen"
+	"github.com/adem-wg/adem-proto/pkg/signer"
+)
+
+var ErrCtyNotAllowed = errors.New("content type not allowed")
+var ErrIssNotAllowed = errors.New("issuer not allowed")
+var ErrLifetime = errors.New("token lifetime exceeds maximum")
+var ErrNoTimeClaims = errors.New("token misses nbf or exp")
+
+var socketPath string
+var keysPath string
+var keysJWK bool
+var pass string
+var auditPath string
+var allowedCty string
+var allowedIss string
+var maxLifetime int64
+
+func init() {
+	flag.StringVar(&socketPath, "socket", "", "path of the Unix socket to listen on")
+	flag.StringVar(&keysPath, "keys", "", "path to the signing keys")
+	flag.BoolVar(&keysJWK, "keys-jwk", false, "are the signing keys encoded as JWK? Default is PEM")
+	flag.StringVar(&pass, "pass", "prompt", "passphrase source for encrypted keys: prompt, env:NAME, or fd:N")
+	flag.StringVar(&auditPath, "audit", "", "path to append the audit log to; defaults to stdout")
+	flag.StringVar(&allowedCty, "cty", "", "comma-separated content types that may be signed; defaults to all")
+	flag.StringVar(&allowedIss, "iss", "", "comma-separated issuers that tokens may state; defaults to all")
+	flag.Int64Var(&maxLifetime, "max-lifetime", 0, "maximum validity period (exp - nbf) of signed tokens in seconds; 0 for no limit")
+	args.AddTokenLogArgs()
+}
+
+func main() {
+	flag.Parse()
+	if socketPath == "" {
+		log.Fatal("no -socket given")
+	}
+
+	keys, err := args.LoadSecretKeys(keysPath, keysJWK, args.PassphraseFrom(pass, "Passphrase for "+keysPath, false))
+	if err != nil {
+		log.Fatalf("could not load keys: %s", err)
+	}
+
+	var audit io.Writer = os.Stdout
+	if auditPath != "" {
+		if f, err := os.OpenFile(auditPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600); err != nil {
+			log.Fatalf("could not open audit log: %s", err)
+		} else {
+			defer f.Close()
+			audit = f
+		}
+	}
+
+	server, err := signer.NewServer(keys, policy(), audit)
+	if err != nil {
+		log.Fatalf("could not load keys: %s", err)
+	} else if l := args.LoadTokenLog(); l != nil {
+		server.LogTo(l)
+	}
+
+	// Create the socket accessible by our user only
+	oldMask := syscall.Umask(0077)
+	l, err := net.Listen("unix", socketPath)
+	syscall.Umask(oldMask)
+	if err != nil {
+		log.Fatalf("could not listen: %s", err)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		l.Close()
+	}()
+
+	for _, kid := range server.KIDs() {
+		log.Printf("serving key %s", kid)
+	}
+	log.Printf("listening on %s", socketPath)
+	if err := server.Serve(l); err != nil && !errors.Is(err, net.ErrClosed) {
+		log.Fatal(err)
+	}
+}
+
+func splitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Build the signing policy from the command line flags.
+func policy() signer.Policy {
+	ctys := splitList(allowedCty)
+	issuers := splitList(allowedIss)
+	return func(kid string, req *gen.SigningRequest) error {
+		if len(ctys) > 0 && !slices.Contains(ctys, string(req.Cty)) {
+			return fmt.Errorf("%w: %s", ErrCtyNotAllowed, req.Cty)
+		}
+
+		if len(issuers) > 0 {
+			if iss, ok := req.Claims.Issuer(); !ok || !slices.Contains(issuers, iss) {
+				return fmt.Errorf("%w: %s", ErrIssNotAllowed, iss)
+			}
+		}
+
+		if maxLifetime > 0 {
+			if nbf, ok := req.Claims.NotBefore(); !ok {
+				return ErrNoTimeClaims
+			} else if exp, ok := req.Claims.Expiration(); !ok {
+				return ErrNoTimeClaims
+			} else if exp.Sub(nbf) > time.Duration(maxLifetime)*time.Second {
+				return ErrLifetime
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,268 @@
+/*
+This tool maintains and audits transparency logs of issued tokens (see package
+tokenlog). Logs are directories in the static tlog layout; serve them with any
+static web server.
+
+	tokenlog init -log DIR -origin NAME -key-out FILE
+	tokenlog add -log DIR -key FILE TOKENS...
+	tokenlog checkpoint -log DIR|URL -vkey VKEY
+	tokenlog list -log DIR|URL -vkey VKEY [-start N]
+	tokenlog prove -log DIR|URL -vkey VKEY TOKENS...
+	tokenlog consistency -log DIR|URL -vkey VKEY -old FILE
+
+init creates an empty log, writes the note signer key of its checkpoints to
+-key-out, and prints the verifier key. Publish the verifier key; monitors need
+it to check checkpoints. Tokens are logged by emblemgen, renewd, and signerd
+(see their -tlog flags); add appends tokens signed otherwise. Token files hold
+newline-separated tokens or a bundle.
+
+checkpoint prints the log's latest checkpoint after checking its signature.
+list prints the tokens in the log from entry -start on. Monitors should check
+that each token was legitimately issued, e.g., that its assets belong to the
+issuer. prove proves that the given tokens are included in the log. consistency
+proves that the log extends the log at the checkpoint in -old, i.e., that no
+entries were removed or changed since, and prints the current checkpoint.
+Monitors store it as -old for the next run.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/adem-wg/adem-proto/pkg/args"
+	"github.com/adem-wg/adem-proto/pkg/signer"
+	"github.com/adem-wg/adem-proto/pkg/tokenlog"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"golang.org/x/mod/sumdb/note"
+)
+
+var logPath string
+var origin string
+var keyOut string
+var keyPath string
+var vkey string
+var start uint64
+var oldPath string
+
+func init() {
+	flag.StringVar(&logPath, "log", "", "directory of the log; checkpoint, list, prove, and consistency also accept an HTTP(S) URL")
+	flag.StringVar(&origin, "origin", "", "unique name of the log, e.g., example.com/adem-log (init only)")
+	flag.StringVar(&keyOut, "key-out", "", "path to write the log's note signer key to (init only)")
+	flag.StringVar(&keyPath, "key", "", "path to the log's note signer key (add only)")
+	flag.StringVar(&vkey, "vkey", "", "note verifier key of the log")
+	flag.Uint64Var(&start, "start", 0, "index of the first entry to list (list only)")
+	flag.StringVar(&oldPath, "old", "", "path to a previously fetched checkpoint (consistency only)")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		log.Fatal("no subcommand given (expected init, add, checkpoint, list, prove, or consistency)")
+	}
+	cmd := os.Args[1]
+	if err := flag.CommandLine.Parse(os.Args[2:]); err != nil {
+		log.Fatal(err)
+	} else if logPath == "" {
+		log.Fatal("no -log given")
+	}
+
+	switch cmd {
+	case "init":
+		create()
+	case "add":
+		add()
+	case "checkpoint":
+		checkpoint()
+	case "list":
+		list()
+	case "prove":
+		prove()
+	case "consistency":
+		consistency()
+	default:
+		log.Fatalf("unknown subcommand: %s", cmd)
+	}
+}
+
+func create() {
+	if origin == "" {
+		log.Fatal("no -origin given")
+	} else if keyOut == "" {
+		log.Fatal("no -key-out given")
+	}
+
+	skey, verifierKey, err := tokenlog.GenerateKey(origin)
+	if err != nil {
+		log.Fatalf("could not generate key: %s", err)
+	} else if f, err := os.OpenFile(keyOut, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600); err != nil {
+		log.Fatalf("could not create key file: %s", err)
+	} else if _, err := fmt.Fprintln(f, skey); err != nil {
+		log.Fatalf("could not write key: %s", err)
+	} else if err := f.Close(); err != nil {
+		log.Fatalf("could not write key: %s", err)
+	} else if _, err := tokenlog.Create(logPath, skey); err != nil {
+		log.Fatalf("could not create log: %s", err)
+	}
+	fmt.Println(verifierKey)
+}
+
+// Read the log entries of the tokens in the given files. Keys in the files are
+// skipped.
+func readEntries(paths []string) [][]byte {
+	if len(paths) == 0 {
+		log.Fatal("no token files given")
+	}
+
+	entries := [][]byte{}
+	for _, path := range paths {
+		ts, err := args.ReadTokens(path)
+		if err != nil {
+			log.Fatalf("could not read %s: %s", path, err)
+		}
+		for _, t := range ts {
+			if _, err := jwk.ParseKey(t); err == nil {
+				continue
+			} else if es, err := tokenlog.Entries(t); err != nil {
+				log.Fatalf("could not read token in %s: %s", path, err)
+			} else {
+				entries = append(entries, es...)
+			}
+		}
+	}
+	return entries
+}
+
+func add() {
+	if keyPath == "" {
+		log.Fatal("no -key given")
+	}
+
+	entries := readEntries(flag.Args())
+	if skey, err := os.ReadFile(keyPath); err != nil {
+		log.Fatalf("could not read key: %s", err)
+	} else if l, err := tokenlog.Open(logPath, strings.TrimSpace(string(skey))); err != nil {
+		log.Fatalf("could not open log: %s", err)
+	} else if index, err := l.Append(entries...); err != nil {
+		log.Fatalf("could not append to log: %s", err)
+	} else {
+		log.Printf("appended %d entries at index %d", len(entries), index)
+	}
+}
+
+func client() *tokenlog.Client {
+	if vkey == "" {
+		log.Fatal("no -vkey given")
+	}
+	verifier, err := note.NewVerifier(vkey)
+	if err != nil {
+		log.Fatalf("could not parse -vkey: %s", err)
+	}
+
+	if strings.HasPrefix(logPath, "http://") || strings.HasPrefix(logPath, "https://") {
+		return tokenlog.NewClient(tokenlog.HTTPFetcher(logPath, nil), verifier)
+	}
+	return tokenlog.NewClient(tokenlog.DirFetcher(logPath), verifier)
+}
+
+func latest(c *tokenlog.Client) (*tokenlog.Checkpoint, []byte) {
+	if cp, signed, err := c.Checkpoint(); err != nil {
+		log.Fatalf("could not fetch checkpoint: %s", err)
+		return nil, nil
+	} else {
+		return cp, signed
+	}
+}
+
+func checkpoint() {
+	_, signed := latest(client())
+	fmt.Print(string(signed))
+}
+
+func list() {
+	c := client()
+	cp, _ := latest(c)
+	for from := start; from < cp.Size; from += 256 {
+		entries, err := c.Entries(from, min(from+256, cp.Size), cp.Size)
+		if err != nil {
+			log.Fatalf("could not fetch entries: %s", err)
+		}
+		for i, entry := range entries {
+			fmt.Println(describe(from+uint64(i), entry))
+		}
+	}
+}
+
+// Describe a log entry by its index, content type, issuer, expiration, and, for
+// emblems, its assets.
+func describe(index uint64, entry []byte) string {
+	req, err := signer.ParseMessage(tokenlog.EntryFormat(entry), entry)
+	if err != nil {
+		return fmt.Sprintf("%d\tundecodable entry: %s", index, err)
+	}
+
+	iss, _ := req.Claims.Issuer()
+	exp := "-"
+	if t, ok := req.Claims.Expiration(); ok {
+		exp = t.UTC().Format(time.RFC3339)
+	}
+	line := fmt.Sprintf("%d\t%s\t%s\t%s\t%s", index, req.Format, req.Cty, iss, exp)
+	var assets tokens.Assets
+	if err := req.Claims.Get("assets", &assets); err == nil {
+		names := make([]string, 0, len(assets))
+		for _, ai := range assets {
+			names = append(names, ai.String())
+		}
+		line += "\t" + strings.Join(names, ",")
+	}
+	return line
+}
+
+func prove() {
+	entries := readEntries(flag.Args())
+	c := client()
+	cp, _ := latest(c)
+	failed := false
+	for i, entry := range entries {
+		if index, err := c.FindEntry(entry, cp); err != nil {
+			log.Printf("token %d: %s", i, err)
+			failed = true
+		} else if err := c.ProveInclusion(index, entry, cp); err != nil {
+			log.Printf("could not prove inclusion of entry %d: %s", index, err)
+			failed = true
+		} else {
+			fmt.Println(describe(index, entry))
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+	log.Printf("all %d entries included in log of size %d", len(entries), cp.Size)
+}
+
+func consistency() {
+	if oldPath == "" {
+		log.Fatal("no -old given")
+	}
+
+	c := client()
+	var old *tokenlog.Checkpoint
+	if bs, err := os.ReadFile(oldPath); err != nil {
+		log.Fatalf("could not read old checkpoint: %s", err)
+	} else if old, err = tokenlog.OpenCheckpoint(bs, c.Verifier()); err != nil {
+		log.Fatalf("could not open old checkpoint: %s", err)
+	}
+
+	cp, signed := latest(c)
+	if cp.Size < old.Size {
+		log.Fatalf("log shrunk from %d to %d entries", old.Size, cp.Size)
+	} else if err := c.ProveConsistency(old, cp); err != nil {
+		log.Fatalf("could not prove consistency: %s", err)
+	}
+	log.Printf("log of size %d extends log of size %d", cp.Size, old.Size)
+	fmt.Print(string(signed))
+}
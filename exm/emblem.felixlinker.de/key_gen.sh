@@ -5,12 +5,12 @@ fi
 
 for f in "emblem" "auth.felixlinker.de" "emblem.felixlinker.de"; do
   if [ ! -f "keys/$f.pem" ]; then
-    openssl ecparam -genkey -name secp521r1 -noout -out "keys/$f.pem"
+    go run github.com/adem-wg/adem-proto/cmd/keys gen -alg ES512 > "keys/$f.pem"
   fi
   if [ ! -f "certs/$f.pub.pem" ]; then
-    openssl ec -in "keys/$f.pem" -pubout > "certs/$f.pub.pem"
+    go run github.com/adem-wg/adem-proto/cmd/keys convert -pk-alg ES512 -to pem -pub "keys/$f.pem" > "certs/$f.pub.pem"
   fi
   if [ ! -f "certs/$f.pub.json" ]; then
-    go run github.com/adem-wg/adem-proto/cmd/kid -cmd gen-kid -pk "keys/$f.pem" -pk-alg ES512 > "certs/$f.pub.json"
+    go run github.com/adem-wg/adem-proto/cmd/keys convert -pk-alg ES512 -pub "keys/$f.pem" > "certs/$f.pub.json"
   fi
 done
@@ -1,6 +1,6 @@
 # Generate private key for signing if not exists
 if [ ! -f private_emb.pem ]; then
-  openssl ecparam -genkey -name secp521r1 -noout -out private_emb.pem
+  go run github.com/adem-wg/adem-proto/cmd/keys gen -alg ES512 > private_emb.pem
 fi
 
 go run github.com/adem-wg/adem-proto/cmd/emblemgen \
@@ -1,6 +1,6 @@
 # Generate private key for signing if not exists
 if [ ! -f private_end.pem ]; then
-  openssl ecparam -genkey -name secp521r1 -noout -out private_end.pem
+  go run github.com/adem-wg/adem-proto/cmd/keys gen -alg ES512 > private_end.pem
 fi
 
 go run github.com/adem-wg/adem-proto/cmd/emblemgen \
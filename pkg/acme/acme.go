@@ -0,0 +1,178 @@
+/*
+This package obtains configuration certificates of root keys from ACME (RFC
+8555) certificate authorities. Challenges are fulfilled by solvers, e.g., hook
+commands that publish DNS-01 records or a built-in HTTP-01 responder.
+*/
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	xacme "golang.org/x/crypto/acme"
+)
+
+var ErrNoSolver = errors.New("no challenge solver")
+var ErrNoNames = errors.New("CSR contains no DNS names")
+var ErrNoChallenge = errors.New("CA offers no challenge of the solver's type")
+
+// Configuration of an ACME client.
+type Config struct {
+	// URL of the CA's ACME directory
+	DirectoryURL string
+	// Key of the ACME account. Unknown keys are registered as new account and
+	// agree to the CA's terms of service.
+	AccountKey crypto.Signer
+	// Contact URLs of the account, e.g., "mailto:admin@example.com"
+	Contact []string
+	Solver  Solver
+	// HTTP client to talk to the CA with, e.g., to trust a test CA. If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+}
+
+// Generate a certificate signing request for the given names, e.g., as
+// returned by [roots.ConfigurationNames]. The CSR is signed by a fresh P-256
+// key. Returns the DER-encoded CSR and its key.
+func NewCSR(names []string) ([]byte, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	template := &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: names[0]},
+		DNSNames: names,
+	}
+	if der, err := x509.CreateCertificateRequest(rand.Reader, template, key); err != nil {
+		return nil, nil, err
+	} else {
+		return der, key, nil
+	}
+}
+
+func register(ctx context.Context, client *xacme.Client, contact []string) error {
+	acct := &xacme.Account{Contact: contact}
+	if _, err := client.Register(ctx, acct, xacme.AcceptTOS); err != nil && !errors.Is(err, xacme.ErrAccountAlreadyExists) {
+		return err
+	}
+	return nil
+}
+
+// Build the challenge description a solver needs to fulfill chal for domain.
+func describe(client *xacme.Client, domain string, chal *xacme.Challenge) (*Challenge, error) {
+	c := &Challenge{Type: chal.Type, Domain: domain, Token: chal.Token}
+	var err error
+	switch chal.Type {
+	case ChallengeDNS01:
+		c.Name = "_acme-challenge." + domain
+		c.Value, err = client.DNS01ChallengeRecord(chal.Token)
+	case ChallengeHTTP01:
+		c.Name = client.HTTP01ChallengePath(chal.Token)
+		c.Value, err = client.HTTP01ChallengeResponse(chal.Token)
+	default:
+		err = fmt.Errorf("unsupported challenge type: %s", chal.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Fulfill the authorization at the given URL with the solver.
+func authorize(ctx context.Context, client *xacme.Client, solver Solver, url string) error {
+	authz, err := client.GetAuthorization(ctx, url)
+	if err != nil {
+		return err
+	} else if authz.Status == xacme.StatusValid {
+		return nil
+	}
+
+	var chal *xacme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == solver.Type() {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("%w: %s for %s", ErrNoChallenge, solver.Type(), authz.Identifier.Value)
+	}
+
+	c, err := describe(client, authz.Identifier.Value, chal)
+	if err != nil {
+		return err
+	} else if err := solver.Present(ctx, c); err != nil {
+		return err
+	}
+	defer func() {
+		if err := solver.CleanUp(ctx, c); err != nil {
+			log.Printf("could not clean up challenge for %s: %s", c.Domain, err)
+		}
+	}()
+
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return err
+	} else if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Request a certificate for the DNS names of the given DER-encoded CSR.
+// Returns the PEM-encoded certificate chain, leaf first.
+func Obtain(ctx context.Context, cfg *Config, csr []byte) ([]byte, error) {
+	if cfg.Solver == nil {
+		return nil, ErrNoSolver
+	}
+	req, err := x509.ParseCertificateRequest(csr)
+	if err != nil {
+		return nil, err
+	} else if len(req.DNSNames) == 0 {
+		return nil, ErrNoNames
+	}
+
+	client := &xacme.Client{
+		Key:          cfg.AccountKey,
+		DirectoryURL: cfg.DirectoryURL,
+		HTTPClient:   cfg.HTTPClient,
+		UserAgent:    "adem-proto",
+	}
+	if err := register(ctx, client, cfg.Contact); err != nil {
+		return nil, fmt.Errorf("could not register account: %w", err)
+	}
+
+	order, err := client.AuthorizeOrder(ctx, xacme.DomainIDs(req.DNSNames...))
+	if err != nil {
+		return nil, fmt.Errorf("could not create order: %w", err)
+	}
+	for _, url := range order.AuthzURLs {
+		if err := authorize(ctx, client, cfg.Solver, url); err != nil {
+			return nil, fmt.Errorf("could not authorize: %w", err)
+		}
+	}
+
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, err
+	}
+	der, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("could not finalize order: %w", err)
+	}
+
+	chain := []byte{}
+	for _, cert := range der {
+		chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})...)
+	}
+	return chain, nil
+}
@@ -0,0 +1,329 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adem-wg/adem-proto/pkg/roots"
+)
+
+func TestHTTPSolver(t *testing.T) {
+	solver := NewHTTPSolver()
+	server := httptest.NewServer(solver)
+	defer server.Close()
+
+	c := &Challenge{Type: ChallengeHTTP01, Domain: "example.com", Name: "/.well-known/acme-challenge/token", Value: "token.thumbprint"}
+	get := func() (int, string) {
+		resp, err := http.Get(server.URL + c.Name)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	if status, _ := get(); status != http.StatusNotFound {
+		t.Errorf("expected 404 before presenting, got %d", status)
+	}
+	solver.Present(context.Background(), c)
+	if status, body := get(); status != http.StatusOK || body != c.Value {
+		t.Errorf("expected challenge response, got %d %q", status, body)
+	}
+	solver.CleanUp(context.Background(), c)
+	if status, _ := get(); status != http.StatusNotFound {
+		t.Errorf("expected 404 after clean up, got %d", status)
+	}
+}
+
+func TestHookSolver(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "calls")
+	hook := filepath.Join(dir, "hook.sh")
+	if err := os.WriteFile(hook, []byte("#!/bin/sh\necho \"$@\" >> "+out+"\n"), 0700); err != nil {
+		t.Fatalf("write hook: %v", err)
+	}
+
+	solver, err := NewHookSolver(ChallengeDNS01, hook)
+	if err != nil {
+		t.Fatalf("new hook solver: %v", err)
+	}
+	c := &Challenge{Type: ChallengeDNS01, Domain: "example.com", Name: "_acme-challenge.example.com", Value: "digest"}
+	if err := solver.Present(context.Background(), c); err != nil {
+		t.Fatalf("present: %v", err)
+	} else if err := solver.CleanUp(context.Background(), c); err != nil {
+		t.Fatalf("clean up: %v", err)
+	}
+
+	expected := "present example.com _acme-challenge.example.com digest\ncleanup example.com _acme-challenge.example.com digest\n"
+	if bs, err := os.ReadFile(out); err != nil {
+		t.Fatalf("read calls: %v", err)
+	} else if string(bs) != expected {
+		t.Errorf("unexpected hook calls: %q", bs)
+	}
+
+	if _, err := NewHookSolver("tls-alpn-01", hook); err == nil {
+		t.Error("expected unsupported challenge type to be rejected")
+	}
+}
+
+// Obtain a certificate from a Pebble test CA. Requires Pebble to be running,
+// e.g., with PEBBLE_VA_ALWAYS_VALID=1:
+//
+//	ADEM_PEBBLE_DIRECTORY  directory URL, e.g., https://localhost:14000/dir
+//	ADEM_PEBBLE_CA         path to Pebble's TLS root certificate
+//	ADEM_PEBBLE_HTTP       address to answer HTTP-01 challenges on (default :5002)
+func TestPebble(t *testing.T) {
+	directory := os.Getenv("ADEM_PEBBLE_DIRECTORY")
+	if directory == "" {
+		t.Skip("ADEM_PEBBLE_DIRECTORY not set")
+	}
+	addr := os.Getenv("ADEM_PEBBLE_HTTP")
+	if addr == "" {
+		addr = ":5002"
+	}
+
+	pool := x509.NewCertPool()
+	if bs, err := os.ReadFile(os.Getenv("ADEM_PEBBLE_CA")); err != nil {
+		t.Fatalf("read CA: %v", err)
+	} else if !pool.AppendCertsFromPEM(bs) {
+		t.Fatal("could not parse CA")
+	}
+
+	solver := NewHTTPSolver()
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer l.Close()
+	go solver.Serve(l)
+
+	accountKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate account key: %v", err)
+	}
+	names, err := roots.ConfigurationNames("https://adem.localhost", "testkid")
+	if err != nil {
+		t.Fatalf("configuration names: %v", err)
+	}
+	csr, _, err := NewCSR(names)
+	if err != nil {
+		t.Fatalf("new CSR: %v", err)
+	}
+
+	cfg := &Config{
+		DirectoryURL: directory,
+		AccountKey:   accountKey,
+		Solver:       solver,
+		HTTPClient:   &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	chain, err := Obtain(ctx, cfg, csr)
+	if err != nil {
+		t.Fatalf("obtain: %v", err)
+	}
+
+	certs, err := roots.ParseCerts(chain)
+	if err != nil {
+		t.Fatalf("parse chain: %v", err)
+	} else if strings.Join(certs[0].DNSNames, ",") != strings.Join(names, ",") {
+		t.Errorf("unexpected names: %v", certs[0].DNSNames)
+	}
+}
+
+// Minimal ACME CA that validates HTTP-01 challenges by fetching them from
+// solverURL. Request signatures are not verified.
+type fakeCA struct {
+	t         *testing.T
+	url       string
+	solverURL string
+	caKey     *ecdsa.PrivateKey
+	names     []string
+	valid     []bool
+	cert      []byte
+}
+
+func (ca *fakeCA) reply(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (ca *fakeCA) payload(r *http.Request, v any) {
+	var msg struct {
+		Payload string `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		ca.t.Errorf("decode request: %v", err)
+	} else if bs, err := base64.RawURLEncoding.DecodeString(msg.Payload); err != nil {
+		ca.t.Errorf("decode payload: %v", err)
+	} else if len(bs) > 0 && v != nil {
+		json.Unmarshal(bs, v)
+	}
+}
+
+func (ca *fakeCA) order() map[string]any {
+	authzs := []string{}
+	status := "ready"
+	for i, valid := range ca.valid {
+		authzs = append(authzs, fmt.Sprintf("%s/authz/%d", ca.url, i))
+		if !valid {
+			status = "pending"
+		}
+	}
+	o := map[string]any{"status": status, "authorizations": authzs, "finalize": ca.url + "/finalize"}
+	if ca.cert != nil {
+		o["status"] = "valid"
+		o["certificate"] = ca.url + "/cert"
+	}
+	return o
+}
+
+func (ca *fakeCA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", time.Now().UnixNano()))
+	var i int
+	switch {
+	case r.URL.Path == "/dir":
+		ca.reply(w, http.StatusOK, map[string]string{
+			"newNonce":   ca.url + "/nonce",
+			"newAccount": ca.url + "/account",
+			"newOrder":   ca.url + "/order",
+		})
+	case r.URL.Path == "/nonce":
+		w.WriteHeader(http.StatusOK)
+	case r.URL.Path == "/account":
+		ca.payload(r, nil)
+		w.Header().Set("Location", ca.url+"/account/1")
+		ca.reply(w, http.StatusCreated, map[string]string{"status": "valid"})
+	case r.URL.Path == "/order":
+		var req struct {
+			Identifiers []struct{ Value string } `json:"identifiers"`
+		}
+		ca.payload(r, &req)
+		for _, id := range req.Identifiers {
+			ca.names = append(ca.names, id.Value)
+			ca.valid = append(ca.valid, false)
+		}
+		w.Header().Set("Location", ca.url+"/order/1")
+		ca.reply(w, http.StatusCreated, ca.order())
+	case r.URL.Path == "/order/1":
+		ca.payload(r, nil)
+		ca.reply(w, http.StatusOK, ca.order())
+	case fmtScan(r.URL.Path, "/authz/%d", &i):
+		ca.payload(r, nil)
+		status := "pending"
+		if ca.valid[i] {
+			status = "valid"
+		}
+		ca.reply(w, http.StatusOK, map[string]any{
+			"status":     status,
+			"identifier": map[string]string{"type": "dns", "value": ca.names[i]},
+			"challenges": []map[string]string{
+				{"type": ChallengeDNS01, "url": fmt.Sprintf("%s/chal/dns/%d", ca.url, i), "token": fmt.Sprintf("dns%d", i), "status": "pending"},
+				{"type": ChallengeHTTP01, "url": fmt.Sprintf("%s/chal/%d", ca.url, i), "token": fmt.Sprintf("token%d", i), "status": status},
+			},
+		})
+	case fmtScan(r.URL.Path, "/chal/%d", &i):
+		ca.payload(r, nil)
+		token := fmt.Sprintf("token%d", i)
+		if resp, err := http.Get(ca.solverURL + "/.well-known/acme-challenge/" + token); err != nil {
+			ca.t.Errorf("fetch challenge: %v", err)
+		} else if body, _ := io.ReadAll(resp.Body); !strings.HasPrefix(string(body), token+".") {
+			ca.t.Errorf("unexpected challenge response: %q", body)
+		} else {
+			ca.valid[i] = true
+		}
+		ca.reply(w, http.StatusOK, map[string]string{"type": ChallengeHTTP01, "url": r.URL.String(), "token": token, "status": "processing"})
+	case r.URL.Path == "/finalize":
+		var req struct {
+			CSR string `json:"csr"`
+		}
+		ca.payload(r, &req)
+		ca.issue(req.CSR)
+		w.Header().Set("Location", ca.url+"/order/1")
+		ca.reply(w, http.StatusOK, ca.order())
+	case r.URL.Path == "/cert":
+		ca.payload(r, nil)
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.cert}))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func fmtScan(path string, format string, i *int) bool {
+	n, err := fmt.Sscanf(path, format, i)
+	return err == nil && n == 1 && fmt.Sprintf(format, *i) == path
+}
+
+func (ca *fakeCA) issue(b64 string) {
+	der, _ := base64.RawURLEncoding.DecodeString(b64)
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		ca.t.Fatalf("parse CSR: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      csr.Subject,
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	if ca.cert, err = x509.CreateCertificate(rand.Reader, template, template, csr.PublicKey, ca.caKey); err != nil {
+		ca.t.Fatalf("issue certificate: %v", err)
+	}
+}
+
+func TestObtain(t *testing.T) {
+	solver := NewHTTPSolver()
+	solverServer := httptest.NewServer(solver)
+	defer solverServer.Close()
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := &fakeCA{t: t, solverURL: solverServer.URL, caKey: caKey}
+	caServer := httptest.NewServer(ca)
+	defer caServer.Close()
+	ca.url = caServer.URL
+
+	names, _ := roots.ConfigurationNames("https://example.com", "testkid")
+	csr, _, err := NewCSR(names)
+	if err != nil {
+		t.Fatalf("new CSR: %v", err)
+	}
+	accountKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	cfg := &Config{DirectoryURL: caServer.URL + "/dir", AccountKey: accountKey, Solver: solver}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	chain, err := Obtain(ctx, cfg, csr)
+	if err != nil {
+		t.Fatalf("obtain: %v", err)
+	} else if certs, err := roots.ParseCerts(chain); err != nil {
+		t.Fatalf("parse chain: %v", err)
+	} else if strings.Join(certs[0].DNSNames, ",") != strings.Join(names, ",") {
+		t.Errorf("unexpected names: %v", certs[0].DNSNames)
+	}
+
+	if _, err := Obtain(ctx, &Config{DirectoryURL: caServer.URL + "/dir", AccountKey: accountKey}, csr); err != ErrNoSolver {
+		t.Errorf("expected ErrNoSolver, got %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+package acme
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"sync"
+)
+
+const ChallengeDNS01 = "dns-01"
+const ChallengeHTTP01 = "http-01"
+
+var ErrIllegalChallenge = errors.New("illegal challenge type; expected dns-01 or http-01")
+
+// A challenge to fulfill for a domain.
+type Challenge struct {
+	Type   string
+	Domain string
+	Token  string
+	// For DNS-01, the name of the TXT record to publish, i.e.,
+	// "_acme-challenge.<domain>". For HTTP-01, the URL path to serve the
+	// response at.
+	Name string
+	// For DNS-01, the TXT record contents. For HTTP-01, the response body.
+	Value string
+}
+
+// Solver fulfills ACME challenges of a single type.
+type Solver interface {
+	// The challenge type, i.e., [ChallengeDNS01] or [ChallengeHTTP01].
+	Type() string
+	// Make the challenge response available to the CA. Present returns once the
+	// response can be looked up, e.g., once DNS records have propagated.
+	Present(ctx context.Context, c *Challenge) error
+	// Remove the challenge response.
+	CleanUp(ctx context.Context, c *Challenge) error
+}
+
+// Solver that delegates challenges to a hook command. The command is called as
+//
+//	COMMAND present|cleanup DOMAIN NAME VALUE
+//
+// where NAME and VALUE are the fields of [Challenge], e.g., to publish DNS-01
+// TXT records with a DNS provider's API. The command must only return once the
+// challenge response is available.
+type HookSolver struct {
+	ChallengeType string
+	Command       string
+}
+
+func NewHookSolver(challengeType string, command string) (*HookSolver, error) {
+	if challengeType != ChallengeDNS01 && challengeType != ChallengeHTTP01 {
+		return nil, ErrIllegalChallenge
+	}
+	return &HookSolver{ChallengeType: challengeType, Command: command}, nil
+}
+
+func (s *HookSolver) Type() string {
+	return s.ChallengeType
+}
+
+func (s *HookSolver) run(ctx context.Context, action string, c *Challenge) error {
+	cmd := exec.CommandContext(ctx, s.Command, action, c.Domain, c.Name, c.Value)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (s *HookSolver) Present(ctx context.Context, c *Challenge) error {
+	return s.run(ctx, "present", c)
+}
+
+func (s *HookSolver) CleanUp(ctx context.Context, c *Challenge) error {
+	return s.run(ctx, "cleanup", c)
+}
+
+// Solver that answers HTTP-01 challenges itself. It can be served by
+// [HTTPSolver.Serve] or mounted into an existing web server as handler.
+type HTTPSolver struct {
+	lock      sync.Mutex
+	responses map[string]string
+}
+
+func NewHTTPSolver() *HTTPSolver {
+	return &HTTPSolver{responses: make(map[string]string)}
+}
+
+func (s *HTTPSolver) Type() string {
+	return ChallengeHTTP01
+}
+
+func (s *HTTPSolver) Present(ctx context.Context, c *Challenge) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.responses[c.Name] = c.Value
+	return nil
+}
+
+func (s *HTTPSolver) CleanUp(ctx context.Context, c *Challenge) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.responses, c.Name)
+	return nil
+}
+
+func (s *HTTPSolver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	response, ok := s.responses[r.URL.Path]
+	s.lock.Unlock()
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(response))
+}
+
+// Answer challenges on the given listener until it is closed.
+func (s *HTTPSolver) Serve(l net.Listener) error {
+	err := http.Serve(l, s)
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
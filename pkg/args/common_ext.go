@@ -0,0 +1,47 @@
+package args
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+)
+
+var extClaims string
+var critClaims string
+
+func AddClaimExtensionArgs() {
+	flag.StringVar(&extClaims, "ext", "", "comma-separated names of custom claims to accept")
+}
+
+func AddCriticalClaimArgs() {
+	flag.StringVar(&critClaims, "crit", "", "comma-separated names of custom claims to accept and to mark as critical")
+}
+
+func splitNames(names string) []string {
+	split := []string{}
+	for _, name := range strings.Split(names, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			split = append(split, name)
+		}
+	}
+	return split
+}
+
+// Register the custom claims given by -ext and -crit as untyped claim
+// extensions. Must be called before loading or verifying tokens.
+func LoadClaimExtensions() {
+	for _, name := range append(splitNames(extClaims), splitNames(critClaims)...) {
+		if tokens.IsClaimExtension(name) {
+			continue
+		} else if err := tokens.RegisterClaim(tokens.ClaimExtension{Name: name}); err != nil {
+			log.Fatalf("could not register claim: %s", err)
+		}
+	}
+	for _, name := range splitNames(critClaims) {
+		if err := tokens.MarkCritical(name); err != nil {
+			log.Fatalf("could not mark claim as critical: %s", err)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package args
+
+import (
+	"flag"
+	"log"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+)
+
+var format string
+
+func AddFormatArgs() {
+	flag.StringVar(&format, "format", string(consts.FormatJWS), "token encoding; either jws or cose")
+}
+
+func LoadFormat() consts.Format {
+	switch consts.Format(format) {
+	case consts.FormatJWS:
+		return consts.FormatJWS
+	case consts.FormatCOSE:
+		return consts.FormatCOSE
+	default:
+		log.Fatalf(`"-format %s" unknown format`, format)
+		return ""
+	}
+}
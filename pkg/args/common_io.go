@@ -5,6 +5,8 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+
+	"github.com/adem-wg/adem-proto/pkg/bundle"
 )
 
 var SafetyWindow int64
@@ -33,6 +35,12 @@ func LoadEndorsements() ([][]byte, error) {
 	for _, fpath := range matches {
 		if bs, err := os.ReadFile(fpath); err != nil {
 			log.Printf("could not parse file %s", fpath)
+		} else if ts, ok, err := bundle.Expand(bs); ok {
+			if err != nil {
+				log.Printf("could not parse bundle %s: %s", fpath, err)
+			} else {
+				endorsements = append(endorsements, ts...)
+			}
 		} else {
 			endorsements = append(endorsements, bs)
 		}
@@ -0,0 +1,90 @@
+package args
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/adem-wg/adem-proto/pkg/keystore"
+	"golang.org/x/term"
+)
+
+var ErrIllegalPassSource = errors.New("illegal passphrase source; expected prompt, env:NAME, or fd:N")
+var ErrPassMismatch = errors.New("passphrases do not match")
+
+const passSourceUsage = "passphrase source for encrypted keys: prompt, env:NAME, or fd:N"
+
+// Return a passphrase provider for the given source. Sources are "prompt"
+// (read from the terminal without echo), "env:NAME" (read from the
+// environment variable NAME), and "fd:N" (read the first line from file
+// descriptor N). If confirm is set, prompted passphrases must be entered
+// twice.
+func PassphraseFrom(source string, prompt string, confirm bool) keystore.Passphrase {
+	return func() ([]byte, error) {
+		kind, arg, _ := strings.Cut(source, ":")
+		switch kind {
+		case "", "prompt":
+			return promptPassphrase(prompt, confirm)
+		case "env":
+			if pass, ok := os.LookupEnv(arg); !ok {
+				return nil, fmt.Errorf("environment variable %s not set", arg)
+			} else {
+				return []byte(pass), nil
+			}
+		case "fd":
+			if fd, err := strconv.Atoi(arg); err != nil {
+				return nil, ErrIllegalPassSource
+			} else {
+				return readPassphraseFd(fd)
+			}
+		default:
+			return nil, ErrIllegalPassSource
+		}
+	}
+}
+
+func readPassphraseFd(fd int) ([]byte, error) {
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+	if f == nil {
+		return nil, fmt.Errorf("illegal file descriptor %d", fd)
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, err
+	}
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+func promptPassphrase(prompt string, confirm bool) ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot prompt for passphrase: %w", err)
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "%s: ", prompt)
+	pass, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	if err != nil || !confirm {
+		return pass, err
+	}
+
+	fmt.Fprintf(tty, "Repeat %s: ", strings.ToLower(prompt[:1])+prompt[1:])
+	repeated, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	defer clear(repeated)
+	if err != nil {
+		clear(pass)
+		return nil, err
+	} else if !bytes.Equal(pass, repeated) {
+		clear(pass)
+		return nil, ErrPassMismatch
+	}
+	return pass, nil
+}
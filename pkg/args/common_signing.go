@@ -5,8 +5,15 @@ import (
 	"flag"
 	"log"
 	"os"
+	"path/filepath"
+	"runtime"
 
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/gen"
+	"github.com/adem-wg/adem-proto/pkg/schema"
+	"github.com/adem-wg/adem-proto/pkg/signer"
 	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/cert"
 	"github.com/lestrrat-go/jwx/v3/jwa"
 	"github.com/lestrrat-go/jwx/v3/jwk"
 	"github.com/lestrrat-go/jwx/v3/jwt"
@@ -16,21 +23,52 @@ var alg string
 var lifetime int64
 var skeyFile string
 var skeyJWK bool
+var skeyKid string
+var skeyPass string
 var protoPath string
 var logsPath string
 var publicKeyPath string
 var publicKeyJWK bool
 var publicKeyAlg string
 var headerKeyFmt string
+var unsigned bool
+var checkOnly bool
+var againstPattern string
+var embedKey bool
+var cosignPath string
+var x5cPath string
+var signerSocket string
+var batchPath string
+var jobs int
 
 func AddSigningArgs() {
+	AddSignerArgs()
+	AddProtoArgs()
+	flag.StringVar(&logsPath, "logs", "", "path to key commitment information")
+	flag.BoolVar(&unsigned, "unsigned", false, "generate an unsigned emblem; -skey and -alg will be ignored")
+	flag.BoolVar(&checkOnly, "check", false, "only check the claims prototype against the schema; do not sign")
+	flag.BoolVar(&embedKey, "embed-key", false, "embed the full endorsed key (-pk) in endorsements in addition to its kid")
+	flag.StringVar(&cosignPath, "cosign", "", "path to an endorsement to add a signature to; the issuer is taken from -proto, if given, and the root key commitment from -logs")
+	flag.StringVar(&batchPath, "batch", "", "path to a batch specification to sign one token per instance from; see emblemgen's documentation")
+	flag.IntVar(&jobs, "jobs", runtime.NumCPU(), "number of tokens to sign in parallel in batch mode")
+	flag.StringVar(&againstPattern, "against", "", "glob of endorsement files (newline-separated tokens or bundles) to check a new emblem against before output")
+}
+
+// Add the arguments that select the signer of tokens (see [LoadSigner]).
+func AddSignerArgs() {
 	flag.StringVar(&alg, "alg", "", "signing algorithm")
-	flag.Int64Var(&lifetime, "lifetime", 172800, "emblem validity period; will be ignored if proto specifies exp")
 	flag.StringVar(&skeyFile, "skey", "", "path to secret key file")
 	flag.BoolVar(&skeyJWK, "skey-jwk", false, "is the signing key encoded as JWK? Default is PEM")
-	flag.StringVar(&protoPath, "proto", "", "path to claims prototype")
-	flag.StringVar(&logsPath, "logs", "", "path to key commitment information")
+	flag.StringVar(&skeyPass, "skey-pass", "prompt", passSourceUsage)
+	flag.StringVar(&skeyKid, "skey-kid", "", "kid of the signing key to use if -skey or -signer hold several keys")
+	flag.StringVar(&signerSocket, "signer", "", "path to the Unix socket of a remote signer to sign with instead of -skey")
 	flag.StringVar(&headerKeyFmt, "key-fmt", "kid", "should the verification key in the header be included as full key (jwk) or by reference (kid)? Default is kid.")
+	flag.StringVar(&x5cPath, "x5c", "", "path to PEM certificate chain for the signing key (leaf first) to include as x5c header")
+}
+
+func AddProtoArgs() {
+	flag.StringVar(&protoPath, "proto", "", "path to claims prototype")
+	flag.Int64Var(&lifetime, "lifetime", 172800, "emblem validity period; will be ignored if proto specifies exp")
 }
 
 func AddPublicKeyArgs() {
@@ -38,6 +76,34 @@ func AddPublicKeyArgs() {
 	flag.BoolVar(&publicKeyJWK, "pk-jwk", false, "are the keys encoded as JWK? If not set, PEM is assumed.")
 }
 
+// Load the endorsement to co-sign. Returns nil if none was given.
+func LoadCosign() []byte {
+	if cosignPath == "" {
+		return nil
+	} else if bs, err := os.ReadFile(cosignPath); err != nil {
+		log.Fatalf("could not read endorsement to co-sign: %s", err)
+		return nil
+	} else {
+		return bs
+	}
+}
+
+// Load the path of the batch specification. Returns "" if none was given.
+func LoadBatch() string {
+	return batchPath
+}
+
+func LoadJobs() int {
+	if jobs < 1 {
+		log.Fatal("-jobs must be at least 1")
+	}
+	return jobs
+}
+
+func LoadEmbedKey() bool {
+	return embedKey
+}
+
 func AddPublicKeyAlgArgs() {
 	flag.StringVar(&publicKeyAlg, "pk-alg", "", "public key alg (if omitted, will use -alg)")
 }
@@ -75,30 +141,145 @@ func LoadLifetime() int64 {
 	return lifetime
 }
 
+// Load the signing key. Encrypted keys are decrypted in memory using the
+// passphrase from -skey-pass.
 func LoadPrivateKey() jwk.Key {
-	if ks, err := LoadKeys(skeyFile, skeyJWK); err != nil {
+	ks, err := LoadSecretKeys(skeyFile, skeyJWK, PassphraseFrom(skeyPass, "Passphrase for "+skeyFile, false))
+	if err != nil {
 		log.Fatalf("could not load skey: %s", err)
 		return nil
-	} else if k, ok := ks.Key(0); !ok {
+	}
+
+	var k jwk.Key
+	var ok bool
+	if skeyKid != "" {
+		// Keys without algorithm are matched using -alg, if given
+		a, ok := jwa.LookupSignatureAlgorithm(alg)
+		if !ok {
+			a = jwa.NoSignature()
+		}
+		if k, err = tokens.SelectKey(ks, skeyKid, a); err != nil {
+			log.Fatalf("could not select skey: %s", err)
+			return nil
+		}
+	} else if k, ok = ks.Key(0); !ok {
 		log.Fatalf("to little or too many keys in file")
 		return nil
+	} else if ks.Len() > 1 {
+		log.Fatalf("file contains %d keys; select one with -skey-kid", ks.Len())
+		return nil
+	}
+
+	if chain := LoadX5C(); chain == nil {
+		return k
+	} else if err := tokens.SetX5C(k, chain); err != nil {
+		log.Fatalf("could not attach certificate chain: %s", err)
+		return nil
 	} else {
 		return k
 	}
 }
 
-func LoadClaimsProto() jwt.Token {
+// Load the signer of tokens. This is either the remote signer given by
+// -signer or the signing key (see [LoadPrivateKey]).
+func LoadSigner() gen.Signer {
+	if signerSocket == "" {
+		if keySigner, err := gen.KeySigner(LoadPrivateKey()); err != nil {
+			log.Fatalf("could not load skey: %s", err)
+			return nil
+		} else {
+			return keySigner
+		}
+	}
+
+	client, err := signer.Dial(signerSocket, skeyKid)
+	if err != nil {
+		log.Fatalf("could not connect to signer: %s", err)
+		return nil
+	}
+	if chain := LoadX5C(); chain != nil {
+		if err := client.SetX5C(chain); err != nil {
+			log.Fatalf("could not attach certificate chain: %s", err)
+			return nil
+		}
+	}
+	return client
+}
+
+// Load the certificate chain of the signing key. Returns nil if none was
+// given.
+func LoadX5C() *cert.Chain {
+	if x5cPath == "" {
+		return nil
+	} else if bs, err := os.ReadFile(x5cPath); err != nil {
+		log.Fatalf("could not read certificate chain: %s", err)
+		return nil
+	} else if chain, err := tokens.ParseCertChain(bs); err != nil {
+		log.Fatalf("could not parse certificate chain: %s", err)
+		return nil
+	} else {
+		return chain
+	}
+}
+
+// Load the claims prototype if one was given. Returns nil otherwise.
+func LoadClaimsProtoOpt(cty consts.CTY) jwt.Token {
+	if protoPath == "" {
+		return nil
+	}
+	return LoadClaimsProto(cty)
+}
+
+// Load the claims prototype of a token with the given content type. The
+// prototype is checked against the prototype schema before parsing.
+func LoadClaimsProto(cty consts.CTY) jwt.Token {
 	if protoPath == "" {
 		log.Fatal("no --proto arg")
 	}
 
-	claimsProto, err := jwt.ReadFile(protoPath, jwt.WithVerify(false), jwt.WithValidate(false))
+	bs, err := os.ReadFile(protoPath)
+	if err != nil {
+		log.Fatalf("cannot read proto file: %s", err)
+	} else if err := schema.ValidateProto(cty, bs); err != nil {
+		log.Fatalf("%s: %s", protoPath, err)
+	}
+
+	claimsProto, err := jwt.Parse(bs, jwt.WithVerify(false), jwt.WithValidate(false))
 	if err != nil {
 		log.Fatalf("cannot parse proto file: %s", err)
 	}
 	return claimsProto
 }
 
+// Load the endorsements to check new emblems against. Returns nil if no
+// endorsements were given.
+func LoadAgainst() [][]byte {
+	if againstPattern == "" {
+		return nil
+	}
+
+	matches, err := filepath.Glob(againstPattern)
+	if err != nil {
+		log.Fatalf("cannot expand endorsements glob: %s", err)
+	} else if len(matches) == 0 {
+		log.Fatalf("no endorsements match %s", againstPattern)
+	}
+
+	endorsements := [][]byte{}
+	for _, fpath := range matches {
+		if ts, err := ReadTokens(fpath); err != nil {
+			log.Fatalf("could not read endorsements: %s", err)
+		} else {
+			endorsements = append(endorsements, ts...)
+		}
+	}
+	return endorsements
+}
+
+func LoadCheckOnly() bool {
+	return checkOnly
+}
+
 func LoadLogs() tokens.Log {
 	var logs tokens.Log
 	if logsPath == "" {
@@ -128,6 +309,10 @@ func LoadPublicKey() jwk.Key {
 	}
 }
 
+func LoadUnsigned() bool {
+	return unsigned
+}
+
 func LoadHeaderKeyJWK() bool {
 	switch headerKeyFmt {
 	case "jwk":
@@ -0,0 +1,52 @@
+package args
+
+import (
+	"flag"
+	"log"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+)
+
+// Size budgets of encoded tokens per distribution channel in bytes. UDP
+// datagrams must fit the IPv6 minimum MTU of 1280 bytes without IPv6 and UDP
+// headers to avoid fragmentation. DNS responses should fit the EDNS(0) buffer
+// size of 1232 bytes recommended by DNS Flag Day 2020. The DNS budget leaves
+// room for the message header, the queried name, the "adem-token=" prefix, and
+// the length octets of the record's 255-byte strings.
+var sizeBudgets = map[string]int{
+	consts.DNS: 1000,
+	consts.UDP: 1232,
+}
+
+var channel string
+var maxSize int
+var split bool
+
+func AddSizeArgs() {
+	flag.StringVar(&channel, "channel", "", "distribution channel whose size budget tokens should fit; either dns or udp")
+	flag.IntVar(&maxSize, "max-size", 0, "size budget of encoded tokens in bytes; overrides -channel")
+	flag.BoolVar(&split, "split", false, "split the assets of an emblem over several emblems that each fit the size budget")
+}
+
+// Load the size budget of encoded tokens. Returns 0 if no budget was given.
+func LoadSizeBudget() int {
+	if maxSize < 0 {
+		log.Fatal("-max-size must not be negative")
+	} else if maxSize > 0 {
+		return maxSize
+	} else if channel == "" {
+		return 0
+	} else if budget, ok := sizeBudgets[channel]; !ok {
+		log.Fatalf(`"-channel %s" unknown channel`, channel)
+	} else {
+		return budget
+	}
+	return 0
+}
+
+func LoadSplit() bool {
+	if split && LoadSizeBudget() == 0 {
+		log.Fatal("-split requires -channel or -max-size")
+	}
+	return split
+}
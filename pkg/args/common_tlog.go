@@ -0,0 +1,36 @@
+package args
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/adem-wg/adem-proto/pkg/tokenlog"
+)
+
+var tlogDir string
+var tlogKeyPath string
+
+func AddTokenLogArgs() {
+	flag.StringVar(&tlogDir, "tlog", "", "directory of a token log to append signed tokens to")
+	flag.StringVar(&tlogKeyPath, "tlog-key", "", "path to the note signer key of the token log")
+}
+
+// Load the token log to append to. Returns nil if no log was given.
+func LoadTokenLog() *tokenlog.Log {
+	if tlogDir == "" {
+		return nil
+	} else if tlogKeyPath == "" {
+		log.Fatal("-tlog requires -tlog-key")
+	}
+
+	if skey, err := os.ReadFile(tlogKeyPath); err != nil {
+		log.Fatalf("could not read token log key: %s", err)
+	} else if l, err := tokenlog.Open(tlogDir, strings.TrimSpace(string(skey))); err != nil {
+		log.Fatalf("could not open token log: %s", err)
+	} else {
+		return l
+	}
+	return nil
+}
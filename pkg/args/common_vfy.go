@@ -6,6 +6,7 @@ import (
 	"log"
 	"os"
 
+	"github.com/adem-wg/adem-proto/pkg/ident"
 	"github.com/adem-wg/adem-proto/pkg/roots"
 	"github.com/lestrrat-go/jwx/v3/jwa"
 	"github.com/lestrrat-go/jwx/v3/jwk"
@@ -18,11 +19,19 @@ var trustedKeyPath string
 var trustedKeyJWK bool
 var trustedKeyAlg string
 var tokensFilePath string
+var assetStr string
+var x5cAnchorsPattern string
 
 func AddCTArgs() {
+	AddCTProviderArgs()
+	flag.StringVar(&CTProviderPattern, "logs", "", "trust CT logs from files")
+}
+
+// Register the CT log provider arguments except for log files. For tools
+// that use -logs for other purposes.
+func AddCTProviderArgs() {
 	flag.BoolVar(&CTProviderGoogle, "google", true, "trust CT logs known to Google")
 	flag.BoolVar(&CTProviderApple, "apple", true, "trust CT logs known to Apple")
-	flag.StringVar(&CTProviderPattern, "logs", "", "trust CT logs from files")
 }
 
 func AddVerificationArgs() {
@@ -31,10 +40,40 @@ func AddVerificationArgs() {
 	flag.StringVar(&trustedKeyAlg, "trusted-pk-alg", "", "algorithm of trusted public keys")
 }
 
+func AddX5CAnchorArgs() {
+	flag.StringVar(&x5cAnchorsPattern, "x5c-anchors", "", "trust anchors for x5c certificate chains from PEM files")
+}
+
+// Load the trust anchors for x5c certificate chains, if any were given.
+func LoadX5CAnchors() {
+	if x5cAnchorsPattern == "" {
+		return
+	} else if err := roots.ReadX5CAnchors(x5cAnchorsPattern); err != nil {
+		log.Fatalf("could not load x5c trust anchors: %s", err)
+	}
+}
+
 func AddVerificationLocalArgs() {
 	flag.StringVar(&tokensFilePath, "tokens", "", "file that contains new-line separated tokens (if omitted, will read from stdin)")
 }
 
+func AddAssetArgs() {
+	flag.StringVar(&assetStr, "asset", "", "check whether the emblem protects the given asset, e.g., [192.0.2.1]:443")
+}
+
+// Load the asset to match verified emblems against. Returns nil if no asset
+// was given.
+func LoadAsset() *ident.AI {
+	if assetStr == "" {
+		return nil
+	} else if ai, err := ident.ParseAI(assetStr); err != nil {
+		log.Fatalf("could not parse asset: %s", err)
+		return nil
+	} else {
+		return ai
+	}
+}
+
 var ErrNoLogProvider = errors.New("no log providers")
 
 func FetchKnownLogs() error {
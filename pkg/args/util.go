@@ -1,9 +1,13 @@
 package args
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"os"
 
+	"github.com/adem-wg/adem-proto/pkg/bundle"
+	"github.com/adem-wg/adem-proto/pkg/keystore"
 	"github.com/lestrrat-go/jwx/v3/jwk"
 )
 
@@ -20,3 +24,36 @@ func LoadKeys(path string, isJWK bool) (jwk.Set, error) {
 		return key, nil
 	}
 }
+
+// Load secret keys that may be encrypted (see [keystore.Parse]).
+func LoadSecretKeys(path string, isJWK bool, passphrase keystore.Passphrase) (jwk.Set, error) {
+	if path == "" {
+		return nil, ErrEmptyPath
+	} else if bs, err := os.ReadFile(path); err != nil {
+		return nil, err
+	} else {
+		return keystore.Parse(bs, isJWK, passphrase)
+	}
+}
+
+// Read the tokens in a file. Files either hold a bundle or newline-separated
+// tokens and keys.
+func ReadTokens(path string) ([][]byte, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	} else if ts, ok, err := bundle.Expand(bs); ok {
+		if err != nil {
+			return nil, fmt.Errorf("could not parse bundle %s: %w", path, err)
+		}
+		return ts, nil
+	}
+
+	ts := [][]byte{}
+	for _, line := range bytes.Split(bs, []byte("\n")) {
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			ts = append(ts, line)
+		}
+	}
+	return ts, nil
+}
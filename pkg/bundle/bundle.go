@@ -0,0 +1,201 @@
+/*
+This package implements a single-file format for ADEM token setups. A bundle
+holds an emblem, the endorsements it depends on, and the verification keys as
+JWK set. Bundles carry a content hash that is checked when they are parsed. A
+bundle holds exactly one emblem; emblems split to fit a size budget cannot be
+bundled.
+*/
+package bundle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/cose"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+)
+
+const Version = "adem-bundle-v1"
+
+var ErrIllegalVersion = errors.New("illegal bundle version")
+var ErrHashMismatch = errors.New("bundle content hash mismatch")
+var ErrNoEmblem = errors.New("bundle contains no emblem")
+var ErrMultipleEmblems = errors.New("bundle contains multiple emblems; split emblems cannot be bundled")
+var ErrNoCty = errors.New("token has no content type")
+
+type Bundle struct {
+	Ver          string   `json:"ver"`
+	Emblem       string   `json:"emblem"`
+	Endorsements []string `json:"endorsements,omitempty"`
+	Keys         jwk.Set  `json:"keys,omitempty"`
+	Hash         string   `json:"hash"`
+}
+
+// Create a new bundle from the given tokens and keys. Tokens are sorted into
+// emblem and endorsements by their content type. Exactly one token must be an
+// emblem.
+func New(rawTokens [][]byte, keys jwk.Set) (*Bundle, error) {
+	b := Bundle{Ver: Version, Keys: keys}
+	for _, raw := range rawTokens {
+		raw = bytes.TrimSpace(raw)
+		if cty, err := ContentType(raw); err != nil {
+			return nil, err
+		} else if cty == string(consts.EndorsementCty) {
+			b.Endorsements = append(b.Endorsements, string(raw))
+		} else if b.Emblem != "" {
+			return nil, ErrMultipleEmblems
+		} else {
+			b.Emblem = string(raw)
+		}
+	}
+
+	if b.Emblem == "" {
+		return nil, ErrNoEmblem
+	} else if hash, err := b.ContentHash(); err != nil {
+		return nil, err
+	} else {
+		b.Hash = hash
+		return &b, nil
+	}
+}
+
+// Calculate the bundle's content hash. The hash is the base64url-encoded
+// SHA-256 digest over the newline-separated tokens and canonical JSON
+// encodings of keys. It does not depend on the formatting of the bundle file.
+func (b *Bundle) ContentHash() (string, error) {
+	h := sha256.New()
+	write := func(bs []byte) {
+		h.Write(bs)
+		h.Write([]byte{'\n'})
+	}
+
+	write([]byte(b.Ver))
+	write([]byte(b.Emblem))
+	for _, end := range b.Endorsements {
+		write([]byte(end))
+	}
+	if b.Keys != nil {
+		for i := range b.Keys.Len() {
+			if k, ok := b.Keys.Key(i); !ok {
+				panic("index out of bounds")
+			} else if bs, err := json.Marshal(k); err != nil {
+				return "", err
+			} else {
+				write(bs)
+			}
+		}
+	}
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+func (b *Bundle) UnmarshalJSON(bs []byte) error {
+	type bundle Bundle
+	var raw struct {
+		bundle
+		Keys json.RawMessage `json:"keys,omitempty"`
+	}
+	if err := json.Unmarshal(bs, &raw); err != nil {
+		return err
+	}
+
+	*b = Bundle(raw.bundle)
+	if len(raw.Keys) > 0 {
+		if keys, err := jwk.Parse(raw.Keys); err != nil {
+			return err
+		} else {
+			b.Keys = keys
+		}
+	}
+	return nil
+}
+
+// Parse a bundle and check its content hash.
+func Parse(bs []byte) (*Bundle, error) {
+	var b Bundle
+	if err := json.Unmarshal(bs, &b); err != nil {
+		return nil, err
+	} else if b.Ver != Version {
+		return nil, ErrIllegalVersion
+	} else if b.Emblem == "" {
+		return nil, ErrNoEmblem
+	} else if hash, err := b.ContentHash(); err != nil {
+		return nil, err
+	} else if hash != b.Hash {
+		return nil, ErrHashMismatch
+	} else {
+		return &b, nil
+	}
+}
+
+// Check if the given bytes look like a bundle, i.e., a JSON object with the
+// bundle version. Does not check the bundle's integrity.
+func IsBundle(bs []byte) bool {
+	var probe struct {
+		Ver string `json:"ver"`
+	}
+	trimmed := bytes.TrimSpace(bs)
+	return len(trimmed) > 0 && trimmed[0] == '{' && json.Unmarshal(trimmed, &probe) == nil && probe.Ver == Version
+}
+
+// Return the bundle's tokens and keys in the form expected by
+// [vfy.VerifyTokens], i.e., tokens as bytes and keys as JWK JSON.
+func (b *Bundle) Tokens() ([][]byte, error) {
+	ts := [][]byte{[]byte(b.Emblem)}
+	for _, end := range b.Endorsements {
+		ts = append(ts, []byte(end))
+	}
+	if b.Keys != nil {
+		for i := range b.Keys.Len() {
+			if k, ok := b.Keys.Key(i); !ok {
+				panic("index out of bounds")
+			} else if bs, err := json.Marshal(k); err != nil {
+				return nil, err
+			} else {
+				ts = append(ts, bs)
+			}
+		}
+	}
+	return ts, nil
+}
+
+// Return a token's content type, irrespective of whether it is encoded as JWS
+// or COSE.
+func ContentType(raw []byte) (string, error) {
+	if cose.IsCOSE(raw) {
+		if msg, err := cose.Parse(raw); err != nil {
+			return "", err
+		} else if cty, ok := msg.ContentType(); !ok {
+			return "", ErrNoCty
+		} else {
+			return cty, nil
+		}
+	} else if msg, err := jws.Parse(raw); err != nil {
+		return "", err
+	} else if len(msg.Signatures()) == 0 {
+		return "", ErrNoCty
+	} else if cty, ok := msg.Signatures()[0].ProtectedHeaders().ContentType(); !ok {
+		return "", ErrNoCty
+	} else {
+		return cty, nil
+	}
+}
+
+// If the given bytes hold a bundle, parse it and return its tokens and keys
+// as in [Bundle.Tokens]. The second return value is false if the bytes do not
+// hold a bundle.
+func Expand(bs []byte) ([][]byte, bool, error) {
+	if !IsBundle(bs) {
+		return nil, false, nil
+	} else if b, err := Parse(bs); err != nil {
+		return nil, true, err
+	} else if ts, err := b.Tokens(); err != nil {
+		return nil, true, err
+	} else {
+		return ts, true, nil
+	}
+}
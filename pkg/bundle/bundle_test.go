@@ -0,0 +1,60 @@
+package bundle
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/gen"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+func mkUnsignedEmblem(t *testing.T) []byte {
+	t.Helper()
+	proto := jwt.New()
+	if err := proto.Set("ver", string(consts.V1)); err != nil {
+		t.Fatalf("set ver: %v", err)
+	} else if err := proto.Set("assets", []string{"example.com"}); err != nil {
+		t.Fatalf("set assets: %v", err)
+	} else if _, emblem, err := gen.MkUnsignedEmblem(proto, 60); err != nil {
+		t.Fatalf("generate emblem: %v", err)
+	} else {
+		return emblem
+	}
+	return nil
+}
+
+func TestBundleRoundtrip(t *testing.T) {
+	emblem := mkUnsignedEmblem(t)
+	if b, err := New([][]byte{emblem}, nil); err != nil {
+		t.Fatalf("create bundle: %v", err)
+	} else if bs, err := json.MarshalIndent(b, "", "  "); err != nil {
+		t.Fatalf("marshal bundle: %v", err)
+	} else if !IsBundle(bs) {
+		t.Fatalf("expected bundle to be detected")
+	} else if parsed, err := Parse(bs); err != nil {
+		t.Fatalf("parse bundle: %v", err)
+	} else if parsed.Emblem != string(emblem) {
+		t.Fatalf("unexpected bundle contents: %+v", parsed)
+	}
+}
+
+func TestBundleTampered(t *testing.T) {
+	b, err := New([][]byte{mkUnsignedEmblem(t)}, nil)
+	if err != nil {
+		t.Fatalf("create bundle: %v", err)
+	}
+
+	b.Emblem = string(mkUnsignedEmblem(t)) + "x"
+	if bs, err := json.Marshal(b); err != nil {
+		t.Fatalf("marshal bundle: %v", err)
+	} else if _, err := Parse(bs); err != ErrHashMismatch {
+		t.Fatalf("expected ErrHashMismatch, got %v", err)
+	}
+}
+
+func TestBundleMultipleEmblems(t *testing.T) {
+	if _, err := New([][]byte{mkUnsignedEmblem(t), mkUnsignedEmblem(t)}, nil); err != ErrMultipleEmblems {
+		t.Fatalf("expected ErrMultipleEmblems, got %v", err)
+	}
+}
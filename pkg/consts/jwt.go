@@ -5,6 +5,11 @@ type CTY string
 const EmblemCty CTY = "adem-emb"
 const EndorsementCty CTY = "adem-end"
 
+type Format string
+
+const FormatJWS Format = "jws"
+const FormatCOSE Format = "cose"
+
 type Version string
 
 const V1 Version = "v1"
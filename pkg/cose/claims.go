@@ -0,0 +1,162 @@
+package cose
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var ErrIllegalClaimKey = errors.New("illegal claim key")
+var ErrDuplicateClaim = errors.New("duplicate claim")
+
+// Integer claim keys registered for CBOR Web Tokens (see [RFC 8392]). All
+// other ADEM claims are encoded with their JWT claim names as text keys.
+//
+// [RFC 8392]: https://www.rfc-editor.org/rfc/rfc8392#section-3.1
+var cwtKeys = map[string]int64{
+	jwt.IssuerKey:     1,
+	jwt.SubjectKey:    2,
+	jwt.AudienceKey:   3,
+	jwt.ExpirationKey: 4,
+	jwt.NotBeforeKey:  5,
+	jwt.IssuedAtKey:   6,
+}
+
+var cwtNames = func() map[int64]string {
+	names := make(map[int64]string, len(cwtKeys))
+	for name, key := range cwtKeys {
+		names[key] = name
+	}
+	return names
+}()
+
+// Encode the claims of the given token as CBOR map. Registered JWT claims use
+// the integer keys of CWTs.
+func EncodeClaims(t jwt.Token) ([]byte, error) {
+	var claims map[string]any
+	if bs, err := json.Marshal(t); err != nil {
+		return nil, err
+	} else if err := unmarshalJSON(bs, &claims); err != nil {
+		return nil, err
+	}
+
+	cwt := make(map[any]any, len(claims))
+	for name, val := range claims {
+		if key, ok := cwtKeys[name]; ok {
+			cwt[key] = fromJSON(val)
+		} else {
+			cwt[name] = fromJSON(val)
+		}
+	}
+	return encMode.Marshal(cwt)
+}
+
+// Decode a CBOR-encoded claims map into a JWT. The token is neither verified
+// nor validated. Claims must occur only once, i.e., neither as duplicate key
+// nor under both their integer key and their JWT claim name.
+func DecodeClaims(bs []byte) (jwt.Token, error) {
+	var cwt map[any]any
+	if err := decMode.Unmarshal(bs, &cwt); err != nil {
+		return nil, err
+	}
+
+	claims := make(map[string]any, len(cwt))
+	for key, val := range cwt {
+		var name string
+		switch k := key.(type) {
+		case string:
+			name = k
+		case uint64:
+			if n, ok := cwtNames[int64(k)]; !ok {
+				return nil, fmt.Errorf("%w: %d", ErrIllegalClaimKey, k)
+			} else {
+				name = n
+			}
+		default:
+			return nil, ErrIllegalClaimKey
+		}
+
+		if _, ok := claims[name]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateClaim, name)
+		} else if conv, err := toJSON(val); err != nil {
+			return nil, err
+		} else {
+			claims[name] = conv
+		}
+	}
+
+	if bs, err := json.Marshal(claims); err != nil {
+		return nil, err
+	} else {
+		return jwt.Parse(bs, jwt.WithVerify(false), jwt.WithValidate(false))
+	}
+}
+
+func unmarshalJSON(bs []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(bs))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// Convert a value decoded from JSON such that integers are encoded as CBOR
+// integers rather than floating point numbers.
+func fromJSON(val any) any {
+	switch v := val.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		} else if f, err := v.Float64(); err == nil {
+			return f
+		} else {
+			return v.String()
+		}
+	case map[string]any:
+		conv := make(map[string]any, len(v))
+		for k, elem := range v {
+			conv[k] = fromJSON(elem)
+		}
+		return conv
+	case []any:
+		conv := make([]any, 0, len(v))
+		for _, elem := range v {
+			conv = append(conv, fromJSON(elem))
+		}
+		return conv
+	default:
+		return v
+	}
+}
+
+// Convert a value decoded from CBOR such that it can be encoded as JSON. Maps
+// nested in claims must have text keys.
+func toJSON(val any) (any, error) {
+	switch v := val.(type) {
+	case map[any]any:
+		conv := make(map[string]any, len(v))
+		for k, elem := range v {
+			if key, ok := k.(string); !ok {
+				return nil, ErrIllegalClaimKey
+			} else if c, err := toJSON(elem); err != nil {
+				return nil, err
+			} else {
+				conv[key] = c
+			}
+		}
+		return conv, nil
+	case []any:
+		conv := make([]any, 0, len(v))
+		for _, elem := range v {
+			if c, err := toJSON(elem); err != nil {
+				return nil, err
+			} else {
+				conv = append(conv, c)
+			}
+		}
+		return conv, nil
+	default:
+		return v, nil
+	}
+}
@@ -0,0 +1,336 @@
+/*
+This package implements the COSE encoding of ADEM tokens. Tokens are encoded
+as COSE_Sign1 messages (see [RFC 9052]) whose payload is a CBOR-encoded claims
+set in the style of CBOR Web Tokens (see [RFC 8392]). Verification keys are
+referenced by KID only. For text-based channels, e.g., DNS TXT records, tokens
+and keys are base64url-encoded without padding.
+
+[RFC 9052]: https://www.rfc-editor.org/rfc/rfc9052
+[RFC 8392]: https://www.rfc-editor.org/rfc/rfc8392
+*/
+package cose
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+	gocose "github.com/veraison/go-cose"
+)
+
+var ErrUnsupportedAlg = errors.New("algorithm not supported for COSE")
+var ErrNoSigner = errors.New("key cannot be used for signing")
+var ErrNoKid = errors.New("message misses kid")
+var ErrAlgMismatch = errors.New("algorithm of key and message do not match")
+var ErrNoSign1 = errors.New("not the Sig_structure of a COSE_Sign1 message")
+var ErrIllegalCritical = errors.New("illegal adem-crit header")
+
+var encMode = func() cbor.EncMode {
+	if mode, err := cbor.CoreDetEncOptions().EncMode(); err != nil {
+		panic(err)
+	} else {
+		return mode
+	}
+}()
+
+// Claims maps must not contain duplicate keys; decoding rejects them rather
+// than letting the last occurrence win.
+var decMode = func() cbor.DecMode {
+	if mode, err := (cbor.DecOptions{DupMapKey: cbor.DupMapKeyEnforcedAPF}).DecMode(); err != nil {
+		panic(err)
+	} else {
+		return mode
+	}
+}()
+
+// COSE requires content types to be full media types whereas JWS drops the
+// "application/" prefix (see RFC 7515, Section 4.1.10).
+const ctyPrefix = "application/"
+
+// Tag number of COSE_Sign1 messages.
+const sign1Tag byte = 0xd2
+
+// Map a JWS algorithm to its COSE counterpart.
+func coseAlg(alg jwa.SignatureAlgorithm) (gocose.Algorithm, error) {
+	switch alg {
+	case jwa.ES256():
+		return gocose.AlgorithmES256, nil
+	case jwa.ES384():
+		return gocose.AlgorithmES384, nil
+	case jwa.ES512():
+		return gocose.AlgorithmES512, nil
+	case jwa.EdDSA():
+		return gocose.AlgorithmEdDSA, nil
+	default:
+		return gocose.AlgorithmReserved, ErrUnsupportedAlg
+	}
+}
+
+// Map a COSE algorithm to its JWS counterpart.
+func jwsAlg(alg gocose.Algorithm) (jwa.SignatureAlgorithm, error) {
+	switch alg {
+	case gocose.AlgorithmES256:
+		return jwa.ES256(), nil
+	case gocose.AlgorithmES384:
+		return jwa.ES384(), nil
+	case gocose.AlgorithmES512:
+		return jwa.ES512(), nil
+	case gocose.AlgorithmEdDSA:
+		return jwa.EdDSA(), nil
+	default:
+		return jwa.NoSignature(), ErrUnsupportedAlg
+	}
+}
+
+// Sign the given token as COSE_Sign1 message. The message references the
+// verification key by its KID. Returns the tagged CBOR encoding.
+func Sign(t jwt.Token, cty consts.CTY, alg jwa.SignatureAlgorithm, signingKey jwk.Key) ([]byte, error) {
+	var raw any
+	if coseAlg, err := coseAlg(alg); err != nil {
+		return nil, err
+	} else if verifKey, err := signingKey.PublicKey(); err != nil {
+		return nil, err
+	} else if err := verifKey.Set("alg", alg.String()); err != nil {
+		return nil, err
+	} else if kid, err := tokens.GetKID(verifKey); err != nil {
+		return nil, err
+	} else if err := jwk.Export(signingKey, &raw); err != nil {
+		return nil, err
+	} else if cryptoSigner, ok := raw.(crypto.Signer); !ok {
+		return nil, ErrNoSigner
+	} else if signer, err := gocose.NewSigner(coseAlg, cryptoSigner); err != nil {
+		return nil, err
+	} else {
+		return sign1(t, cty, kid, signer)
+	}
+}
+
+// SignFunc signs the given Sig_structure (see RFC 9052, Section 4.4). The
+// signature must be encoded as defined for the algorithm in RFC 9053, i.e.,
+// ECDSA signatures as fixed-length concatenation of r and s.
+type SignFunc func(toBeSigned []byte) ([]byte, error)
+
+// Sign the given token as COSE_Sign1 message using an external signing
+// function. The message references the verification key by the given KID.
+// Returns the tagged CBOR encoding.
+func SignWith(t jwt.Token, cty consts.CTY, alg jwa.SignatureAlgorithm, kid string, sign SignFunc) ([]byte, error) {
+	if coseAlg, err := coseAlg(alg); err != nil {
+		return nil, err
+	} else {
+		return sign1(t, cty, kid, &funcSigner{alg: coseAlg, sign: sign})
+	}
+}
+
+func sign1(t jwt.Token, cty consts.CTY, kid string, signer gocose.Signer) ([]byte, error) {
+	payload, err := EncodeClaims(t)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := gocose.Headers{
+		Protected: gocose.ProtectedHeader{
+			gocose.HeaderLabelAlgorithm:   signer.Algorithm(),
+			gocose.HeaderLabelContentType: ctyPrefix + string(cty),
+			gocose.HeaderLabelKeyID:       []byte(kid),
+		},
+	}
+	// Like JWS, list critical claims in the "adem-crit" header and mark that
+	// header as critical.
+	if crit := tokens.CriticalClaims(t); len(crit) > 0 {
+		headers.Protected[tokens.CriticalHeader] = crit
+		headers.Protected[gocose.HeaderLabelCritical] = []any{tokens.CriticalHeader}
+	}
+	return gocose.Sign1(rand.Reader, signer, headers, payload, nil)
+}
+
+// Adapter from [SignFunc] to go-cose signers.
+type funcSigner struct {
+	alg  gocose.Algorithm
+	sign SignFunc
+}
+
+func (s *funcSigner) Algorithm() gocose.Algorithm {
+	return s.alg
+}
+
+func (s *funcSigner) Sign(_ io.Reader, content []byte) ([]byte, error) {
+	return s.sign(content)
+}
+
+// Sig_structure of COSE_Sign1 messages (see RFC 9052, Section 4.4).
+type sigStructure struct {
+	_           struct{} `cbor:",toarray"`
+	Context     string
+	Protected   cbor.RawMessage
+	ExternalAAD []byte
+	Payload     []byte
+}
+
+// Parse the Sig_structure of a COSE_Sign1 message, i.e., the bytes signed by a
+// [SignFunc]. The returned message carries the protected headers and payload
+// but no signature; it allows signers to inspect what they sign.
+func ParseToBeSigned(toBeSigned []byte) (*Message, error) {
+	var s sigStructure
+	var m Message
+	if err := cbor.Unmarshal(toBeSigned, &s); err != nil {
+		return nil, err
+	} else if s.Context != "Signature1" {
+		return nil, ErrNoSign1
+	} else if err := m.msg.Headers.Protected.UnmarshalCBOR(s.Protected); err != nil {
+		return nil, err
+	}
+	m.msg.Payload = s.Payload
+	return &m, nil
+}
+
+// Return the Sig_structure of the message, i.e., the bytes its signature was
+// computed over (cf. [ParseToBeSigned]).
+func (m *Message) ToBeSigned() ([]byte, error) {
+	if protected, err := m.msg.Headers.MarshalProtected(); err != nil {
+		return nil, err
+	} else {
+		return encMode.Marshal(sigStructure{
+			Context:     "Signature1",
+			Protected:   protected,
+			ExternalAAD: []byte{},
+			Payload:     m.msg.Payload,
+		})
+	}
+}
+
+// A parsed, but not yet verified, COSE-encoded ADEM token.
+type Message struct {
+	msg gocose.Sign1Message
+}
+
+// Check whether the given token is encoded as COSE_Sign1 message, either in
+// binary or base64url-encoded.
+func IsCOSE(raw []byte) bool {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return false
+	} else if raw[0] == sign1Tag {
+		return true
+	} else if bytes.ContainsAny(raw, ".{") {
+		// JWS compact serialization or JSON
+		return false
+	} else if bs, err := base64.RawURLEncoding.DecodeString(string(raw)); err != nil {
+		return false
+	} else {
+		return len(bs) > 0 && bs[0] == sign1Tag
+	}
+}
+
+// Encode a binary COSE structure for text-based channels.
+func EncodeText(raw []byte) []byte {
+	return []byte(base64.RawURLEncoding.EncodeToString(raw))
+}
+
+// Parse a COSE_Sign1 message, either in binary or base64url-encoded.
+func Parse(raw []byte) (*Message, error) {
+	// Binary messages must not be trimmed as they may end in whitespace bytes
+	if len(raw) == 0 || raw[0] != sign1Tag {
+		if bs, err := base64.RawURLEncoding.DecodeString(string(bytes.TrimSpace(raw))); err != nil {
+			return nil, err
+		} else {
+			raw = bs
+		}
+	}
+
+	var m Message
+	if err := m.msg.UnmarshalCBOR(raw); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Return the KID that references the message's verification key.
+func (m *Message) KeyID() (string, bool) {
+	if kid, ok := m.msg.Headers.Protected[gocose.HeaderLabelKeyID].([]byte); !ok {
+		return "", false
+	} else {
+		return string(kid), true
+	}
+}
+
+// Return the message's content type in the short form used by JWS.
+func (m *Message) ContentType() (string, bool) {
+	if cty, ok := m.msg.Headers.Protected[gocose.HeaderLabelContentType].(string); !ok {
+		return "", false
+	} else {
+		return strings.TrimPrefix(cty, ctyPrefix), true
+	}
+}
+
+// Return the message's signing algorithm as JWS algorithm.
+func (m *Message) Algorithm() (jwa.SignatureAlgorithm, error) {
+	if alg, err := m.msg.Headers.Protected.Algorithm(); err != nil {
+		return jwa.NoSignature(), err
+	} else {
+		return jwsAlg(alg)
+	}
+}
+
+// Return the labels of the protected header parameters that the message marks
+// as critical.
+func (m *Message) Critical() ([]any, error) {
+	return m.msg.Headers.Protected.Critical()
+}
+
+// Return the claims listed in the message's "adem-crit" header.
+func (m *Message) CriticalClaims() ([]string, bool, error) {
+	raw, ok := m.msg.Headers.Protected[tokens.CriticalHeader]
+	if !ok {
+		return nil, false, nil
+	}
+
+	values, ok := raw.([]any)
+	if !ok {
+		return nil, true, ErrIllegalCritical
+	}
+	crit := make([]string, 0, len(values))
+	for _, v := range values {
+		if name, ok := v.(string); !ok {
+			return nil, true, ErrIllegalCritical
+		} else {
+			crit = append(crit, name)
+		}
+	}
+	return crit, true, nil
+}
+
+// Decode the message's claims. Claims are neither verified nor validated.
+func (m *Message) Claims() (jwt.Token, error) {
+	return DecodeClaims(m.msg.Payload)
+}
+
+// Verify the message's signature with the given key. The key's algorithm must
+// match the message's algorithm.
+func (m *Message) Verify(key jwk.Key) error {
+	var raw any
+	if alg, err := m.Algorithm(); err != nil {
+		return err
+	} else if keyAlg, ok := key.Algorithm(); !ok || keyAlg.String() != alg.String() {
+		return ErrAlgMismatch
+	} else if coseAlg, err := coseAlg(alg); err != nil {
+		return err
+	} else if pk, err := key.PublicKey(); err != nil {
+		return err
+	} else if err := jwk.Export(pk, &raw); err != nil {
+		return err
+	} else if verifier, err := gocose.NewVerifier(coseAlg, raw); err != nil {
+		return err
+	} else {
+		return m.msg.Verify(nil, verifier)
+	}
+}
@@ -0,0 +1,160 @@
+package cose
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+func mkKey(t *testing.T) jwk.Key {
+	t.Helper()
+	if raw, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatalf("generate key: %v", err)
+		return nil
+	} else if key, err := jwk.Import(raw); err != nil {
+		t.Fatalf("import key: %v", err)
+		return nil
+	} else if err := key.Set("alg", jwa.ES256()); err != nil {
+		t.Fatalf("set alg: %v", err)
+		return nil
+	} else {
+		return key
+	}
+}
+
+func mkEmblem(t *testing.T, now time.Time) jwt.Token {
+	t.Helper()
+	emblem := jwt.New()
+	var emb tokens.EmblemConstraints
+	if err := emblem.Set("ver", string(consts.V1)); err != nil {
+		t.Fatalf("set ver: %v", err)
+	} else if err := emblem.Set(jwt.IssuerKey, "https://example.com"); err != nil {
+		t.Fatalf("set iss: %v", err)
+	} else if err := emblem.Set(jwt.NotBeforeKey, now); err != nil {
+		t.Fatalf("set nbf: %v", err)
+	} else if err := emblem.Set(jwt.ExpirationKey, now.Add(time.Hour)); err != nil {
+		t.Fatalf("set exp: %v", err)
+	} else if err := emblem.Set("emb", emb); err != nil {
+		t.Fatalf("set emb: %v", err)
+	} else if err := emblem.Set("assets", []string{"example.com"}); err != nil {
+		t.Fatalf("set assets: %v", err)
+	}
+	return emblem
+}
+
+func TestClaimsRoundtrip(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	emblem := mkEmblem(t, now)
+	if bs, err := EncodeClaims(emblem); err != nil {
+		t.Fatalf("encode claims: %v", err)
+	} else if decoded, err := DecodeClaims(bs); err != nil {
+		t.Fatalf("decode claims: %v", err)
+	} else if err := jwt.Validate(decoded, jwt.WithValidator(tokens.EmblemValidator)); err != nil {
+		t.Fatalf("decoded emblem does not validate: %v", err)
+	} else if iss, _ := decoded.Issuer(); iss != "https://example.com" {
+		t.Fatalf("unexpected issuer %q", iss)
+	} else if exp, _ := decoded.Expiration(); !exp.Equal(now.Add(time.Hour)) {
+		t.Fatalf("unexpected exp %v", exp)
+	}
+}
+
+func TestDecodeClaimsDuplicates(t *testing.T) {
+	// {1: "a", 1: "b"}
+	dup := []byte{0xa2, 0x01, 0x61, 'a', 0x01, 0x61, 'b'}
+	var dupErr *cbor.DupMapKeyError
+	if _, err := DecodeClaims(dup); !errors.As(err, &dupErr) {
+		t.Errorf("expected duplicate key to be rejected, got %v", err)
+	}
+
+	both, err := encMode.Marshal(map[any]any{int64(1): "https://a.example", jwt.IssuerKey: "https://b.example"})
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := DecodeClaims(both); !errors.Is(err, ErrDuplicateClaim) {
+		t.Errorf("expected claim under integer key and name to be rejected, got %v", err)
+	}
+}
+
+func TestSignParseVerify(t *testing.T) {
+	key := mkKey(t)
+	kid, err := tokens.CalcKID(key)
+	if err != nil {
+		t.Fatalf("calc kid: %v", err)
+	}
+
+	signed, err := Sign(mkEmblem(t, time.Now()), consts.EmblemCty, jwa.ES256(), key)
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	} else if !IsCOSE(signed) || !IsCOSE(EncodeText(signed)) {
+		t.Fatalf("expected signed token to be detected as COSE")
+	}
+
+	msg, err := Parse(EncodeText(signed))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	} else if msgKid, ok := msg.KeyID(); !ok || msgKid != kid {
+		t.Fatalf("expected kid %s, got %s", kid, msgKid)
+	} else if cty, ok := msg.ContentType(); !ok || cty != string(consts.EmblemCty) {
+		t.Fatalf("unexpected content type %q", cty)
+	} else if pk, err := key.PublicKey(); err != nil {
+		t.Fatalf("public key: %v", err)
+	} else if err := msg.Verify(pk); err != nil {
+		t.Fatalf("verify: %v", err)
+	} else if err := msg.Verify(mkKey(t)); err == nil {
+		t.Fatalf("expected verification with other key to fail")
+	}
+}
+
+func TestToBeSigned(t *testing.T) {
+	var signedMsg []byte
+	signed, err := SignWith(mkEmblem(t, time.Now()), consts.EmblemCty, jwa.ES256(), "kid", func(toBeSigned []byte) ([]byte, error) {
+		signedMsg = toBeSigned
+		return make([]byte, 64), nil
+	})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if msg, err := Parse(signed); err != nil {
+		t.Fatalf("parse: %v", err)
+	} else if toBeSigned, err := msg.ToBeSigned(); err != nil {
+		t.Fatalf("to be signed: %v", err)
+	} else if !bytes.Equal(toBeSigned, signedMsg) {
+		t.Fatalf("expected Sig_structure to match signed bytes")
+	} else if parsed, err := ParseToBeSigned(toBeSigned); err != nil {
+		t.Fatalf("parse Sig_structure: %v", err)
+	} else if roundtrip, err := parsed.ToBeSigned(); err != nil {
+		t.Fatalf("to be signed: %v", err)
+	} else if !bytes.Equal(roundtrip, signedMsg) {
+		t.Fatalf("expected parsed Sig_structure to roundtrip")
+	}
+}
+
+func TestIsCOSEJWS(t *testing.T) {
+	if IsCOSE([]byte("eyJhbGciOiJub25lIn0.e30.")) {
+		t.Fatalf("expected JWS to not be detected as COSE")
+	}
+}
+
+func TestKeyRoundtrip(t *testing.T) {
+	key := mkKey(t)
+	if kid, err := tokens.CalcKID(key); err != nil {
+		t.Fatalf("calc kid: %v", err)
+	} else if bs, err := EncodeKey(key); err != nil {
+		t.Fatalf("encode key: %v", err)
+	} else if parsed, err := ParseKey(EncodeText(bs)); err != nil {
+		t.Fatalf("parse key: %v", err)
+	} else if parsedKid, _ := parsed.KeyID(); parsedKid != kid {
+		t.Fatalf("expected kid %s, got %s", kid, parsedKid)
+	}
+}
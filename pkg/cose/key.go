@@ -0,0 +1,66 @@
+package cose
+
+import (
+	"bytes"
+	"encoding/base64"
+
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	gocose "github.com/veraison/go-cose"
+)
+
+// Encode the public part of the given key as COSE_Key. The key's KID is
+// calculated as for JWKs and included in the encoding.
+func EncodeKey(key jwk.Key) ([]byte, error) {
+	var raw any
+	if pk, err := key.PublicKey(); err != nil {
+		return nil, err
+	} else if kid, err := tokens.CalcKID(key); err != nil {
+		return nil, err
+	} else if err := jwk.Export(pk, &raw); err != nil {
+		return nil, err
+	} else if coseKey, err := gocose.NewKeyFromPublic(raw); err != nil {
+		return nil, err
+	} else {
+		if alg, ok := key.Algorithm(); !ok {
+			return nil, tokens.ErrAlgMissing
+		} else if sigAlg, ok := jwa.LookupSignatureAlgorithm(alg.String()); !ok {
+			return nil, ErrUnsupportedAlg
+		} else if coseAlg, err := coseAlg(sigAlg); err != nil {
+			return nil, err
+		} else {
+			coseKey.Algorithm = coseAlg
+		}
+		coseKey.ID = []byte(kid)
+		return coseKey.MarshalCBOR()
+	}
+}
+
+// Parse a COSE_Key, either in binary or base64url-encoded, as JWK. The
+// returned key's KID is recalculated.
+func ParseKey(raw []byte) (jwk.Key, error) {
+	raw = bytes.TrimSpace(raw)
+	if bs, err := base64.RawURLEncoding.DecodeString(string(raw)); err == nil {
+		raw = bs
+	}
+
+	var coseKey gocose.Key
+	if err := coseKey.UnmarshalCBOR(raw); err != nil {
+		return nil, err
+	} else if pk, err := coseKey.PublicKey(); err != nil {
+		return nil, err
+	} else if alg, err := coseKey.AlgorithmOrDefault(); err != nil {
+		return nil, err
+	} else if jwsAlg, err := jwsAlg(alg); err != nil {
+		return nil, err
+	} else if key, err := jwk.Import(pk); err != nil {
+		return nil, err
+	} else if err := key.Set("alg", jwsAlg); err != nil {
+		return nil, err
+	} else if _, err := tokens.SetKID(key, true); err != nil {
+		return nil, err
+	} else {
+		return key, nil
+	}
+}
@@ -1,6 +1,7 @@
 package gen
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/adem-wg/adem-proto/pkg/consts"
@@ -18,31 +19,44 @@ type TokenGenerator interface {
 }
 
 type EmblemConfig struct {
-	sk           jwk.Key
+	signer       Signer
 	headerKeyJwk bool
 	alg          jwa.SignatureAlgorithm
 	proto        jwt.Token
 	lifetime     int64
+	unsigned     bool
 }
 
-func MkEmblemCfg(sk jwk.Key, alg jwa.SignatureAlgorithm, proto jwt.Token, lifetime int64) *EmblemConfig {
-	return &EmblemConfig{sk: sk, alg: alg, proto: proto, lifetime: lifetime}
+func MkEmblemCfg(signer Signer, alg jwa.SignatureAlgorithm, proto jwt.Token, lifetime int64) *EmblemConfig {
+	return &EmblemConfig{signer: signer, alg: alg, proto: proto, lifetime: lifetime}
+}
+
+// Create a config that generates unsigned emblems.
+func MkUnsignedEmblemCfg(proto jwt.Token, lifetime int64) *EmblemConfig {
+	return &EmblemConfig{proto: proto, lifetime: lifetime, unsigned: true}
 }
 
 type EndorsementConfig struct {
 	EmblemConfig
 	endorse    jwk.Key
 	endorseAlg jwa.SignatureAlgorithm
+	embedKey   bool
 }
 
-func MkEndorsementCfg(sk jwk.Key, alg jwa.SignatureAlgorithm, proto jwt.Token, endorse jwk.Key, endorseAlg jwa.SignatureAlgorithm, lifetime int64) *EndorsementConfig {
+func MkEndorsementCfg(signer Signer, alg jwa.SignatureAlgorithm, proto jwt.Token, endorse jwk.Key, endorseAlg jwa.SignatureAlgorithm, lifetime int64) *EndorsementConfig {
 	return &EndorsementConfig{
-		EmblemConfig: *MkEmblemCfg(sk, alg, proto, lifetime),
+		EmblemConfig: *MkEmblemCfg(signer, alg, proto, lifetime),
 		endorse:      endorse,
 		endorseAlg:   endorseAlg,
 	}
 }
 
+// Embed the full endorsed key in generated endorsements.
+func (cfg *EndorsementConfig) EmbedKey() *EndorsementConfig {
+	cfg.embedKey = true
+	return cfg
+}
+
 func prepToken(t jwt.Token, lifetime int64) error {
 	iat := time.Now().Unix()
 	if err := t.Set("iat", iat); err != nil {
@@ -66,14 +80,29 @@ func prepToken(t jwt.Token, lifetime int64) error {
 	return nil
 }
 
-func signWithHeaders(t jwt.Token, cty consts.CTY, alg jwa.SignatureAlgorithm, signingKey jwk.Key, headerKeyJwk bool) ([]byte, error) {
+func signWithHeaders(t jwt.Token, cty consts.CTY, alg jwa.SignatureAlgorithm, signer Signer, headerKeyJwk bool) ([]byte, error) {
+	if headers, err := mkHeaders(t, cty, alg, signer, headerKeyJwk); err != nil {
+		return nil, err
+	} else if err := headers.Set(jws.TypeKey, "JWT"); err != nil {
+		return nil, err
+	} else if payload, err := json.Marshal(t); err != nil {
+		return nil, err
+	} else {
+		req := &SigningRequest{Alg: alg, Format: consts.FormatJWS, Cty: cty, Claims: t}
+		return signCompact(signer, payload, headers, req)
+	}
+}
+
+// Create the protected headers of a token signed by the given signer. If the
+// signer's verification key carries an x5c certificate chain, the chain is
+// included as well.
+func mkHeaders(t jwt.Token, cty consts.CTY, alg jwa.SignatureAlgorithm, signer Signer, headerKeyJwk bool) (jws.Headers, error) {
 	headers := jws.NewHeaders()
+	headers.Set(jws.AlgorithmKey, alg)
 	headers.Set("cty", string(cty))
-	verifKey, err := signingKey.PublicKey()
+	verifKey, err := verificationKey(signer, alg)
 	if err != nil {
 		return nil, err
-	} else if err := verifKey.Set("alg", alg.String()); err != nil {
-		return nil, err
 	} else if headerKeyJwk {
 		headers.Set("jwk", verifKey)
 	} else if kid, err := tokens.GetKID(verifKey); err != nil {
@@ -82,5 +111,39 @@ func signWithHeaders(t jwt.Token, cty consts.CTY, alg jwa.SignatureAlgorithm, si
 		headers.Set("kid", kid)
 	}
 
-	return jwt.Sign(t, jwt.WithKey(alg, signingKey, jws.WithProtectedHeaders(headers)))
+	if chain, ok := verifKey.X509CertChain(); ok && chain != nil {
+		if err := headers.Set(jws.X509CertChainKey, chain); err != nil {
+			return nil, err
+		}
+	}
+	if err := setCritical(headers, t); err != nil {
+		return nil, err
+	}
+	return headers, nil
+}
+
+// Encode the given token as unsecured JWS (alg "none") in compact
+// serialization.
+func encodeUnsigned(t jwt.Token, cty consts.CTY) ([]byte, error) {
+	headers := jws.NewHeaders()
+	headers.Set("cty", string(cty))
+	if err := setCritical(headers, t); err != nil {
+		return nil, err
+	} else if payload, err := json.Marshal(t); err != nil {
+		return nil, err
+	} else {
+		return jws.Sign(payload, jws.WithInsecureNoSignature(jws.WithProtectedHeaders(headers)))
+	}
+}
+
+// List the critical claim extensions of the given token in the "adem-crit"
+// header, and mark that header as critical.
+func setCritical(headers jws.Headers, t jwt.Token) error {
+	if crit := tokens.CriticalClaims(t); len(crit) == 0 {
+		return nil
+	} else if err := headers.Set(tokens.CriticalHeader, crit); err != nil {
+		return err
+	} else {
+		return headers.Set(jws.CriticalKey, []string{tokens.CriticalHeader})
+	}
 }
@@ -0,0 +1,71 @@
+package gen
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var ErrCosignNoEndorsement = errors.New("only endorsements can be co-signed")
+var ErrCosignNoIss = errors.New("co-signers must state their issuer")
+
+// Add a signature of a further authority to an endorsement, given in compact
+// or JWS JSON serialization. The co-signer's issuer and root key commitment,
+// if any, are stated in the protected header of its signature; verifiers do not
+// take them from the payload. Returns the endorsement in JWS JSON general
+// serialization.
+func Cosign(endorsement []byte, signer Signer, headerKeyJwk bool, alg jwa.SignatureAlgorithm, iss string, logs tokens.Log) ([]byte, error) {
+	if iss == "" {
+		return nil, ErrCosignNoIss
+	}
+	general, err := tokens.ParseGeneralJWS(endorsement)
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := jws.Parse(general.Compact()[0])
+	if err != nil {
+		return nil, err
+	} else if cty, _ := msg.Signatures()[0].ProtectedHeaders().ContentType(); cty != string(consts.EndorsementCty) {
+		return nil, ErrCosignNoEndorsement
+	}
+
+	body, err := jwt.Parse(msg.Payload(), jwt.WithVerify(false), jwt.WithValidate(false))
+	if err != nil {
+		return nil, err
+	}
+
+	headers, err := mkHeaders(body, consts.EndorsementCty, alg, signer, headerKeyJwk)
+	if err != nil {
+		return nil, err
+	} else if err := headers.Set(jwt.IssuerKey, iss); err != nil {
+		return nil, err
+	}
+	// Signers see the claims as verifiers will see them for this signature
+	if err := body.Set(jwt.IssuerKey, iss); err != nil {
+		return nil, err
+	} else if err := body.Remove("log"); err != nil {
+		return nil, err
+	}
+	if logs != nil {
+		if err := headers.Set("log", logs); err != nil {
+			return nil, err
+		} else if err := body.Set("log", logs); err != nil {
+			return nil, err
+		}
+	}
+
+	req := &SigningRequest{Alg: alg, Format: consts.FormatJWS, Cty: consts.EndorsementCty, Claims: body}
+	if compact, err := signCompact(signer, msg.Payload(), headers, req); err != nil {
+		return nil, err
+	} else if err := general.AddCompact(compact); err != nil {
+		return nil, err
+	} else {
+		return json.Marshal(general)
+	}
+}
@@ -3,20 +3,50 @@ package gen
 import (
 	"github.com/adem-wg/adem-proto/pkg/consts"
 	"github.com/lestrrat-go/jwx/v3/jwa"
-	"github.com/lestrrat-go/jwx/v3/jwk"
 	"github.com/lestrrat-go/jwx/v3/jwt"
 )
 
 func (cfg *EmblemConfig) SignToken() (jwt.Token, []byte, error) {
-	return SignEmblem(cfg.sk, cfg.headerKeyJwk, cfg.alg, cfg.proto, cfg.lifetime)
+	if cfg.unsigned {
+		return MkUnsignedEmblem(cfg.proto, cfg.lifetime)
+	}
+	return SignEmblem(cfg.signer, cfg.headerKeyJwk, cfg.alg, cfg.proto, cfg.lifetime)
+}
+
+func SignEmblem(signer Signer, headerKeyJwk bool, alg jwa.SignatureAlgorithm, token jwt.Token, lifetime int64) (jwt.Token, []byte, error) {
+	if err := prepToken(token, lifetime); err != nil {
+		return nil, nil, err
+	}
+
+	compact, err := signWithHeaders(token, consts.EmblemCty, alg, signer, headerKeyJwk)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, compact, nil
+}
+
+// Sign an emblem as COSE_Sign1 message. Returns the tagged CBOR encoding of the
+// message.
+func SignEmblemCOSE(signer Signer, alg jwa.SignatureAlgorithm, token jwt.Token, lifetime int64) (jwt.Token, []byte, error) {
+	if err := prepToken(token, lifetime); err != nil {
+		return nil, nil, err
+	}
+
+	signed, err := signCOSE(signer, token, consts.EmblemCty, alg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return token, signed, nil
 }
 
-func SignEmblem(secretKey jwk.Key, headerKeyJwk bool, alg jwa.SignatureAlgorithm, token jwt.Token, lifetime int64) (jwt.Token, []byte, error) {
+// Generate an unsigned emblem. The emblem is encoded as unsecured JWS, i.e.,
+// with algorithm "none" and an empty signature.
+func MkUnsignedEmblem(token jwt.Token, lifetime int64) (jwt.Token, []byte, error) {
 	if err := prepToken(token, lifetime); err != nil {
 		return nil, nil, err
 	}
 
-	compact, err := signWithHeaders(token, consts.EmblemCty, alg, secretKey, headerKeyJwk)
+	compact, err := encodeUnsigned(token, consts.EmblemCty)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -9,32 +9,60 @@ import (
 )
 
 func (cfg *EndorsementConfig) SignToken() (jwt.Token, []byte, error) {
-	return SignEndorsement(cfg.sk, cfg.headerKeyJwk, cfg.alg, cfg.proto, cfg.endorse, cfg.endorseAlg, cfg.lifetime)
+	return SignEndorsement(cfg.signer, cfg.headerKeyJwk, cfg.alg, cfg.proto, cfg.endorse, cfg.endorseAlg, cfg.embedKey, cfg.lifetime)
 }
 
-func SignEndorsement(secretKey jwk.Key, headerKeyJwk bool, signingAlg jwa.SignatureAlgorithm, token jwt.Token, endorseKey jwk.Key, pkAlg jwa.SignatureAlgorithm, lifetime int64) (jwt.Token, []byte, error) {
-	if err := prepToken(token, lifetime); err != nil {
+// Sign an endorsement for the given key. If embedKey is set, the endorsement
+// carries the full endorsed key in its "jwk" claim in addition to the key's
+// KID.
+func SignEndorsement(signer Signer, headerKeyJwk bool, signingAlg jwa.SignatureAlgorithm, token jwt.Token, endorseKey jwk.Key, pkAlg jwa.SignatureAlgorithm, embedKey bool, lifetime int64) (jwt.Token, []byte, error) {
+	if err := prepEndorsement(token, endorseKey, pkAlg, embedKey, lifetime); err != nil {
 		return nil, nil, err
 	}
 
-	endorseKey, err := endorseKey.PublicKey()
+	compact, err := signWithHeaders(token, consts.EndorsementCty, signingAlg, signer, headerKeyJwk)
 	if err != nil {
 		return nil, nil, err
-	} else if err := endorseKey.Set("alg", pkAlg.String()); err != nil {
-		return nil, nil, err
-	} else if _, err := tokens.SetKID(endorseKey, false); err != nil {
-		return nil, nil, err
 	}
+	return token, compact, nil
+}
 
-	if kid, err := tokens.GetKID(endorseKey); err == nil {
-		token.Set("key", kid)
-	} else {
+// Sign an endorsement as COSE_Sign1 message. Returns the tagged CBOR encoding
+// of the message.
+func SignEndorsementCOSE(signer Signer, signingAlg jwa.SignatureAlgorithm, token jwt.Token, endorseKey jwk.Key, pkAlg jwa.SignatureAlgorithm, embedKey bool, lifetime int64) (jwt.Token, []byte, error) {
+	if err := prepEndorsement(token, endorseKey, pkAlg, embedKey, lifetime); err != nil {
 		return nil, nil, err
 	}
 
-	compact, err := signWithHeaders(token, consts.EndorsementCty, signingAlg, secretKey, headerKeyJwk)
+	signed, err := signCOSE(signer, token, consts.EndorsementCty, signingAlg)
 	if err != nil {
 		return nil, nil, err
 	}
-	return token, compact, nil
+	return token, signed, nil
+}
+
+// Set an endorsement's time claims and the KID of the endorsed key. Embeds the
+// endorsed key itself if embedKey is set.
+func prepEndorsement(token jwt.Token, endorseKey jwk.Key, pkAlg jwa.SignatureAlgorithm, embedKey bool, lifetime int64) error {
+	if err := prepToken(token, lifetime); err != nil {
+		return err
+	}
+
+	endorseKey, err := endorseKey.PublicKey()
+	if err != nil {
+		return err
+	} else if err := endorseKey.Set("alg", pkAlg.String()); err != nil {
+		return err
+	} else if _, err := tokens.SetKID(endorseKey, false); err != nil {
+		return err
+	}
+
+	if kid, err := tokens.GetKID(endorseKey); err != nil {
+		return err
+	} else if err := token.Set("key", kid); err != nil {
+		return err
+	} else if embedKey {
+		return token.Set("jwk", tokens.EmbeddedKey{Key: endorseKey})
+	}
+	return nil
 }
@@ -0,0 +1,77 @@
+package gen
+
+import (
+	"errors"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/cose"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var ErrResignNonCompact = errors.New("only tokens with a single signature can be re-signed")
+var ErrResignNoCty = errors.New("token to re-sign has no content type")
+
+// Sign an existing token anew with the given signer. The token keeps its
+// claims, content type, and encoding, but is assigned fresh time claims valid
+// for lifetime seconds. If update is not nil, it may modify the claims before
+// signing. Returns the new token and its encoding; COSE-encoded tokens are
+// base64url-encoded like their input.
+func Resign(signer Signer, alg jwa.SignatureAlgorithm, raw []byte, lifetime int64, update func(jwt.Token) error) (jwt.Token, []byte, error) {
+	var t jwt.Token
+	var cty string
+	headerKeyJwk := false
+	isCOSE := cose.IsCOSE(raw)
+	if isCOSE {
+		if msg, err := cose.Parse(raw); err != nil {
+			return nil, nil, err
+		} else if claims, err := msg.Claims(); err != nil {
+			return nil, nil, err
+		} else {
+			t = claims
+			cty, _ = msg.ContentType()
+		}
+	} else if tokens.IsGeneralJWS(raw) {
+		return nil, nil, ErrResignNonCompact
+	} else if msg, err := jws.Parse(raw); err != nil {
+		return nil, nil, err
+	} else if len(msg.Signatures()) != 1 {
+		return nil, nil, ErrResignNonCompact
+	} else if claims, err := jwt.Parse(msg.Payload(), jwt.WithVerify(false), jwt.WithValidate(false)); err != nil {
+		return nil, nil, err
+	} else {
+		headers := msg.Signatures()[0].ProtectedHeaders()
+		t = claims
+		cty, _ = headers.ContentType()
+		headerKey, ok := headers.JWK()
+		headerKeyJwk = ok && headerKey != nil
+	}
+
+	if cty == "" {
+		return nil, nil, ErrResignNoCty
+	}
+	for _, claim := range []string{jwt.IssuedAtKey, jwt.NotBeforeKey, jwt.ExpirationKey} {
+		if err := t.Remove(claim); err != nil {
+			return nil, nil, err
+		}
+	}
+	if update != nil {
+		if err := update(t); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := prepToken(t, lifetime); err != nil {
+		return nil, nil, err
+	}
+
+	if !isCOSE {
+		signed, err := signWithHeaders(t, consts.CTY(cty), alg, signer, headerKeyJwk)
+		return t, signed, err
+	} else if signed, err := signCOSE(signer, t, consts.CTY(cty), alg); err != nil {
+		return nil, nil, err
+	} else {
+		return t, cose.EncodeText(signed), nil
+	}
+}
@@ -0,0 +1,211 @@
+package gen
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/cose"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var ErrNoSigner = errors.New("key cannot be used for signing")
+var ErrIllegalSignature = errors.New("signer returned an illegal signature")
+
+// Signer signs tokens. Signers need not hold private key material in this
+// process; they may, e.g., forward signing requests to a separate, hardened
+// process or an HSM. When signing tokens, the opts passed to Sign are a
+// [*SigningRequest] and the digest is the hash of its message. ECDSA
+// signatures must be ASN.1-encoded as for [crypto.Signer].
+type Signer interface {
+	crypto.Signer
+	// Return the verification key. The key may carry an x5c certificate chain
+	// (see [tokens.SetX5C]), which is included in the headers of JWS-encoded
+	// tokens.
+	PublicKey() (jwk.Key, error)
+}
+
+// SigningRequest describes the token that a signature is requested for.
+// Signers may use it to enforce their own signing policy or to keep an audit
+// log.
+type SigningRequest struct {
+	Alg    jwa.SignatureAlgorithm
+	Format consts.Format
+	Cty    consts.CTY
+	// Claims of the token to sign.
+	Claims jwt.Token
+	// The bytes to sign, i.e., the JWS signing input or the COSE
+	// Sig_structure. Both embed the encoded claims.
+	Message []byte
+}
+
+// Return the hash function of the request's algorithm; 0 for EdDSA.
+func (r *SigningRequest) HashFunc() crypto.Hash {
+	hash, _ := tokens.SignatureHash(r.Alg)
+	return hash
+}
+
+// Signer that holds private key material in memory.
+type keySigner struct {
+	key    jwk.Key
+	signer crypto.Signer
+}
+
+// Create a signer from a private key.
+func KeySigner(key jwk.Key) (Signer, error) {
+	var raw any
+	if err := jwk.Export(key, &raw); err != nil {
+		return nil, err
+	} else if signer, ok := raw.(crypto.Signer); !ok {
+		return nil, ErrNoSigner
+	} else {
+		return &keySigner{key: key, signer: signer}, nil
+	}
+}
+
+func (s *keySigner) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+func (s *keySigner) Sign(random io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.signer.Sign(random, digest, opts.HashFunc())
+}
+
+func (s *keySigner) PublicKey() (jwk.Key, error) {
+	return s.key.PublicKey()
+}
+
+// Signer that does not sign but returns placeholder signatures of the length
+// of the wrapped signer's signatures. Signatures of a given algorithm have fixed
+// length once encoded (see [rawSignature]). Hence, tokens "signed" by the
+// signer can be used to measure the size of signed tokens without signing them.
+type dryRunSigner struct {
+	Signer
+}
+
+// Wrap a signer as signer that only returns placeholder signatures.
+func DryRunSigner(signer Signer) Signer {
+	return &dryRunSigner{signer}
+}
+
+func (s *dryRunSigner) Sign(_ io.Reader, _ []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if req, ok := opts.(*SigningRequest); !ok {
+		return nil, ErrNoSigner
+	} else if _, ok := ecdsaSizes[req.Alg.String()]; ok {
+		return asn1.Marshal(struct{ R, S *big.Int }{big.NewInt(1), big.NewInt(1)})
+	} else if req.Alg == jwa.EdDSA() {
+		return make([]byte, ed25519.SignatureSize), nil
+	} else {
+		return nil, fmt.Errorf("%w: %s", tokens.ErrUnsupportedAlg, req.Alg)
+	}
+}
+
+// Return the signer's verification key with the given algorithm.
+func verificationKey(signer Signer, alg jwa.SignatureAlgorithm) (jwk.Key, error) {
+	if pk, err := signer.PublicKey(); err != nil {
+		return nil, err
+	} else if err := pk.Set("alg", alg.String()); err != nil {
+		return nil, err
+	} else {
+		return pk, nil
+	}
+}
+
+// Sign the request's message. Returns the signature in the encoding shared by
+// JWS and COSE, i.e., ECDSA signatures as fixed-length concatenation of r and
+// s.
+func sign(signer Signer, req *SigningRequest) ([]byte, error) {
+	hash, err := tokens.SignatureHash(req.Alg)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := req.Message
+	if hash != 0 {
+		h := hash.New()
+		h.Write(req.Message)
+		digest = h.Sum(nil)
+	}
+
+	sig, err := signer.Sign(rand.Reader, digest, req)
+	if err != nil {
+		return nil, err
+	}
+	return rawSignature(req.Alg, sig)
+}
+
+// Sizes of the integers r and s of ECDSA signatures by algorithm.
+var ecdsaSizes = map[string]int{
+	jwa.ES256().String(): 32,
+	jwa.ES384().String(): 48,
+	jwa.ES512().String(): 66,
+}
+
+// Convert ASN.1-encoded ECDSA signatures to the concatenation of r and s (see
+// RFC 7518, Section 3.4). Other signatures are returned as is.
+func rawSignature(alg jwa.SignatureAlgorithm, sig []byte) ([]byte, error) {
+	size, ok := ecdsaSizes[alg.String()]
+	if !ok {
+		return sig, nil
+	}
+
+	var parsed struct{ R, S *big.Int }
+	if rest, err := asn1.Unmarshal(sig, &parsed); err != nil || len(rest) > 0 {
+		return nil, ErrIllegalSignature
+	} else if parsed.R.Sign() <= 0 || parsed.S.Sign() <= 0 || parsed.R.BitLen() > size*8 || parsed.S.BitLen() > size*8 {
+		return nil, ErrIllegalSignature
+	}
+	raw := make([]byte, 2*size)
+	parsed.R.FillBytes(raw[:size])
+	parsed.S.FillBytes(raw[size:])
+	return raw, nil
+}
+
+// Sign the given payload as JWS with the given protected headers. Returns the
+// JWS in compact serialization.
+func signCompact(signer Signer, payload []byte, headers jws.Headers, req *SigningRequest) ([]byte, error) {
+	hdrs, err := json.Marshal(headers)
+	if err != nil {
+		return nil, err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(hdrs) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	req.Message = []byte(input)
+	if sig, err := sign(signer, req); err != nil {
+		return nil, err
+	} else {
+		return []byte(input + "." + base64.RawURLEncoding.EncodeToString(sig)), nil
+	}
+}
+
+// Sign the given token as COSE_Sign1 message. Returns the tagged CBOR
+// encoding.
+func signCOSE(signer Signer, t jwt.Token, cty consts.CTY, alg jwa.SignatureAlgorithm) ([]byte, error) {
+	if verifKey, err := verificationKey(signer, alg); err != nil {
+		return nil, err
+	} else if kid, err := tokens.GetKID(verifKey); err != nil {
+		return nil, err
+	} else {
+		return cose.SignWith(t, cty, alg, kid, func(toBeSigned []byte) ([]byte, error) {
+			return sign(signer, &SigningRequest{
+				Alg:     alg,
+				Format:  consts.FormatCOSE,
+				Cty:     cty,
+				Claims:  t,
+				Message: toBeSigned,
+			})
+		})
+	}
+}
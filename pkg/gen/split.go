@@ -0,0 +1,93 @@
+package gen
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var ErrAssetExceedsBudget = errors.New("emblem exceeds size budget even for a single asset")
+var ErrSizeMismatch = errors.New("signed emblem is larger than measured")
+
+// Sign the emblem prototype as several emblems whose encodings each fit into
+// budget bytes. The prototype's assets are distributed over the emblems in
+// order; all other claims are copied. measure and sign are called with copies
+// of the prototype and must return the token and its final encoding, e.g.,
+// base64url-encoded COSE. measure is used to find the emblems' assets and
+// should not sign, e.g., by using a [DryRunSigner]; only the final emblems are
+// passed to sign. Returns the signed emblems and their encodings.
+func SplitEmblem(proto jwt.Token, budget int, measure func(jwt.Token) (jwt.Token, []byte, error), sign func(jwt.Token) (jwt.Token, []byte, error)) ([]jwt.Token, [][]byte, error) {
+	var assets tokens.Assets
+	if err := proto.Get("assets", &assets); err != nil {
+		return nil, nil, err
+	} else if len(assets) == 0 {
+		return nil, nil, tokens.ErrAssets
+	}
+
+	withAssets := func(part tokens.Assets) (jwt.Token, error) {
+		if t, err := proto.Clone(); err != nil {
+			return nil, err
+		} else if err := t.Set("assets", part); err != nil {
+			return nil, err
+		} else {
+			return t, nil
+		}
+	}
+	size := func(part tokens.Assets) (int, error) {
+		if t, err := withAssets(part); err != nil {
+			return 0, err
+		} else if _, raw, err := measure(t); err != nil {
+			return 0, err
+		} else {
+			return len(raw), nil
+		}
+	}
+
+	emblems := []jwt.Token{}
+	encoded := [][]byte{}
+	for start := 0; start < len(assets); {
+		// The encoding grows with the number of assets. Hence, we search for the
+		// largest number of assets that fits, starting with all remaining.
+		n, err := size(assets[start:])
+		if err != nil {
+			return nil, nil, err
+		}
+		end := len(assets)
+		if n > budget {
+			if n, err = size(assets[start : start+1]); err != nil {
+				return nil, nil, err
+			} else if n > budget {
+				return nil, nil, fmt.Errorf("%w: %s needs %d bytes", ErrAssetExceedsBudget, assets[start], n)
+			}
+			end = start + 1
+
+			lo, hi := start+2, len(assets)-1
+			for lo <= hi {
+				mid := (lo + hi) / 2
+				if midN, err := size(assets[start:mid]); err != nil {
+					return nil, nil, err
+				} else if midN <= budget {
+					n, end = midN, mid
+					lo = mid + 1
+				} else {
+					hi = mid - 1
+				}
+			}
+		}
+
+		if t, err := withAssets(assets[start:end]); err != nil {
+			return nil, nil, err
+		} else if t, raw, err := sign(t); err != nil {
+			return nil, nil, err
+		} else if len(raw) > budget {
+			return nil, nil, fmt.Errorf("%w: %d instead of %d bytes", ErrSizeMismatch, len(raw), n)
+		} else {
+			emblems = append(emblems, t)
+			encoded = append(encoded, raw)
+		}
+		start = end
+	}
+	return emblems, encoded, nil
+}
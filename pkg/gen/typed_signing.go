@@ -0,0 +1,35 @@
+package gen
+
+import (
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// Sign a typed emblem. Returns the emblem with the time claims it was signed
+// with.
+func SignTypedEmblem(signer Signer, headerKeyJwk bool, alg jwa.SignatureAlgorithm, emblem *tokens.Emblem, lifetime int64) (*tokens.Emblem, []byte, error) {
+	if t, err := emblem.Token(); err != nil {
+		return nil, nil, err
+	} else if signed, compact, err := SignEmblem(signer, headerKeyJwk, alg, t, lifetime); err != nil {
+		return nil, nil, err
+	} else if typed, err := tokens.EmblemFromToken(signed); err != nil {
+		return nil, nil, err
+	} else {
+		return typed, compact, nil
+	}
+}
+
+// Sign a typed endorsement for the given key. Returns the endorsement with the
+// endorsed KID and time claims it was signed with.
+func SignTypedEndorsement(signer Signer, headerKeyJwk bool, signingAlg jwa.SignatureAlgorithm, endorsement *tokens.Endorsement, endorseKey jwk.Key, pkAlg jwa.SignatureAlgorithm, lifetime int64) (*tokens.Endorsement, []byte, error) {
+	if t, err := endorsement.Token(); err != nil {
+		return nil, nil, err
+	} else if signed, compact, err := SignEndorsement(signer, headerKeyJwk, signingAlg, t, endorseKey, pkAlg, endorsement.EmbedKey, lifetime); err != nil {
+		return nil, nil, err
+	} else if typed, err := tokens.EndorsementFromToken(signed); err != nil {
+		return nil, nil, err
+	} else {
+		return typed, compact, nil
+	}
+}
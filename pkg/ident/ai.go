@@ -4,21 +4,93 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net"
+	"strconv"
 	"strings"
 
 	"github.com/adem-wg/adem-proto/pkg/util"
+	"golang.org/x/net/idna"
 )
 
 var ErrIllegalAI = errors.New("illegal asset identifier")
 var ErrNoAddress = errors.New("no address component")
 var ErrIllegalAddress = errors.New("illegal address component")
 var ErrWildcard = errors.New("illegal usage of domain name wildcards")
+var ErrIllegalDomain = errors.New("illegal domain name")
+var ErrIllegalPort = errors.New("illegal port component")
+
+// IDNA2008 profile to convert domain names to their canonical A-label form. It
+// case folds, enforces the LDH rule, and enforces label and name length limits
+// (see RFC 1035 and RFC 5890).
+var idnaProfile = idna.New(
+	idna.MapForLookup(),
+	idna.Transitional(false),
+	idna.StrictDomainName(true),
+	idna.VerifyDNSLength(true),
+	idna.BidiRule(),
+)
+
+// Convert a domain name to its canonical form, i.e., lowercase A-labels.
+func canonicalDomain(name string) (string, error) {
+	if ascii, err := idnaProfile.ToASCII(name); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrIllegalDomain, err)
+	} else {
+		return ascii, nil
+	}
+}
 
 type AI struct {
 	domain   []string
 	ipAddr   net.IP
 	ipPrefix *net.IPNet
+	// Ports the AI is restricted to. If nil, the AI covers all ports.
+	ports *PortRange
+}
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	Low  uint16
+	High uint16
+}
+
+// Check whether the range includes all ports of the other range.
+func (pr *PortRange) Contains(other *PortRange) bool {
+	return pr.Low <= other.Low && other.High <= pr.High
+}
+
+func (pr *PortRange) String() string {
+	if pr.Low == pr.High {
+		return strconv.Itoa(int(pr.Low))
+	} else {
+		return fmt.Sprintf("%d-%d", pr.Low, pr.High)
+	}
+}
+
+// Parse a port component of the form <port> or <low>-<high>. Returns nil if
+// the range includes all ports.
+func parsePorts(str string) (*PortRange, error) {
+	lowStr, highStr, isRange := strings.Cut(str, "-")
+	if !isRange {
+		highStr = lowStr
+	}
+
+	if low, err := strconv.ParseUint(lowStr, 10, 16); err != nil {
+		return nil, ErrIllegalPort
+	} else if high, err := strconv.ParseUint(highStr, 10, 16); err != nil {
+		return nil, ErrIllegalPort
+	} else if low > high {
+		return nil, ErrIllegalPort
+	} else if low == 0 && high == math.MaxUint16 {
+		return nil, nil
+	} else {
+		return &PortRange{Low: uint16(low), High: uint16(high)}, nil
+	}
+}
+
+// Return the ports the AI is restricted to, or nil if it covers all ports.
+func (ai *AI) Ports() *PortRange {
+	return ai.ports
 }
 
 func joinDomain(labels []string) string {
@@ -32,6 +104,15 @@ func joinDomain(labels []string) string {
 }
 
 func (ai *AI) MoreGeneral(than *AI) bool {
+	if ai.ports != nil && (than.ports == nil || !ai.ports.Contains(than.ports)) {
+		return false
+	}
+	return ai.moreGeneralAddress(than)
+}
+
+// Check whether the address component of ai covers the address component of
+// than, ignoring ports.
+func (ai *AI) moreGeneralAddress(than *AI) bool {
 	if ai.domain != nil {
 		if len(than.domain) == 0 {
 			return false
@@ -45,14 +126,25 @@ func (ai *AI) MoreGeneral(than *AI) bool {
 			return thanJoined == aiJoined
 		}
 	} else if ai.ipAddr != nil {
-		return ai.ipAddr.Equal(than.ipAddr)
+		if than.ipAddr != nil {
+			return ai.ipAddr.Equal(than.ipAddr)
+		} else if than.ipPrefix != nil {
+			// A host prefix, e.g., /32 for IPv4, denotes exactly one address.
+			ones, bits := than.ipPrefix.Mask.Size()
+			return ones == bits && isIPv4(ai.ipAddr) == isIPv4Prefix(than.ipPrefix) && ai.ipAddr.Equal(than.ipPrefix.IP)
+		} else {
+			return false
+		}
 	} else if ai.ipPrefix != nil {
 		if than.ipAddr != nil {
-			return ai.ipPrefix.Contains(than.ipAddr)
+			return isIPv4Prefix(ai.ipPrefix) == isIPv4(than.ipAddr) && ai.ipPrefix.Contains(than.ipAddr)
 		} else if than.ipPrefix != nil {
-			// TODO: Can something weird happen if than.IPPrefix.IP is actual shorter
-			// than ai.IPPrefix but has matching leading bytes?
-			return ai.ipPrefix.Contains(than.ipPrefix.IP)
+			// A prefix covers another prefix if both belong to the same address
+			// family, the other prefix is at least as long, and the other prefix's
+			// network address lies within the prefix.
+			aiOnes, aiBits := ai.ipPrefix.Mask.Size()
+			thanOnes, thanBits := than.ipPrefix.Mask.Size()
+			return aiBits == thanBits && aiOnes <= thanOnes && ai.ipPrefix.Contains(than.ipPrefix.IP)
 		} else {
 			return false
 		}
@@ -61,6 +153,40 @@ func (ai *AI) MoreGeneral(than *AI) bool {
 	}
 }
 
+// Check whether two AIs denote the same set of assets.
+func (ai *AI) Equal(other *AI) bool {
+	return ai.MoreGeneral(other) && other.MoreGeneral(ai)
+}
+
+func isIPv4(ip net.IP) bool {
+	return ip.To4() != nil
+}
+
+func isIPv4Prefix(prefix *net.IPNet) bool {
+	return len(prefix.IP) == net.IPv4len
+}
+
+// Convert IPv4-mapped IPv6 addresses and prefixes to plain IPv4 such that
+// IPv4 assets have a unique representation.
+func normalizeIP(ip net.IP) net.IP {
+	if v4 := ip.To4(); v4 != nil {
+		return v4
+	} else {
+		return ip
+	}
+}
+
+func normalizePrefix(prefix *net.IPNet) *net.IPNet {
+	ones, bits := prefix.Mask.Size()
+	if v4 := prefix.IP.To4(); v4 != nil && bits == 8*net.IPv6len && ones >= 8*(net.IPv6len-net.IPv4len) {
+		return &net.IPNet{IP: v4, Mask: net.CIDRMask(ones-8*(net.IPv6len-net.IPv4len), 8*net.IPv4len)}
+	} else if v4 != nil && bits == 8*net.IPv4len {
+		return &net.IPNet{IP: v4, Mask: prefix.Mask}
+	} else {
+		return prefix
+	}
+}
+
 func (ai *AI) UnmarshalJSON(bs []byte) error {
 	var str string
 	if err := json.Unmarshal(bs, &str); err != nil {
@@ -71,18 +197,49 @@ func (ai *AI) UnmarshalJSON(bs []byte) error {
 		ai.domain = parsed.domain
 		ai.ipAddr = parsed.ipAddr
 		ai.ipPrefix = parsed.ipPrefix
+		ai.ports = parsed.ports
 		return nil
 	}
 }
 
+// Split an AI into its address and port components. The boolean result
+// indicates whether there is a port component.
+func splitPort(aiStr string) (string, string, bool, error) {
+	if aiStr[0] == '[' {
+		if end := strings.IndexByte(aiStr, ']'); end < 0 {
+			return "", "", false, ErrIllegalAddress
+		} else if rest := aiStr[end+1:]; rest == "" {
+			return aiStr, "", false, nil
+		} else if rest[0] != ':' {
+			return "", "", false, ErrIllegalAI
+		} else {
+			return aiStr[:end+1], rest[1:], true, nil
+		}
+	} else {
+		addr, port, hasPort := strings.Cut(aiStr, ":")
+		return addr, port, hasPort, nil
+	}
+}
+
 func ParseAI(aiStr string) (*AI, error) {
-	addr := aiStr
+	if aiStr == "" {
+		return nil, ErrIllegalAI
+	}
 
-	if addr == "" {
+	addr, port, hasPort, err := splitPort(aiStr)
+	if err != nil {
+		return nil, err
+	} else if addr == "" {
 		return nil, ErrIllegalAI
 	}
 
 	ai := AI{}
+	if hasPort {
+		if ai.ports, err = parsePorts(port); err != nil {
+			return nil, err
+		}
+	}
+
 	if addr[0] == '[' {
 		// must be IPv6
 		var trimmed string
@@ -94,14 +251,13 @@ func ParseAI(aiStr string) (*AI, error) {
 		}
 
 		if ip := net.ParseIP(trimmed); ip != nil {
-			ai.ipAddr = ip
-		} else if _, net, err := net.ParseCIDR(trimmed); err == nil {
-			ai.ipPrefix = net
+			ai.ipAddr = normalizeIP(ip)
+		} else if _, prefix, err := net.ParseCIDR(trimmed); err == nil {
+			ai.ipPrefix = normalizePrefix(prefix)
 		} else {
 			return nil, ErrIllegalAddress
 		}
 	} else {
-		// TODO: I should check labels for allowed characters of domain names
 		// Only leftmost label may be wildcard
 		if strings.Contains(addr[1:], "*") {
 			return nil, ErrWildcard
@@ -114,8 +270,21 @@ func ParseAI(aiStr string) (*AI, error) {
 		} else if strings.Contains(labels[0], "*") && len(labels[0]) > 1 {
 			// If leftmost label is wildcard, leftmost label may be the wildcard only
 			return nil, ErrWildcard
-		} else {
+		} else if labels[0] == "*" && len(labels) == 1 {
 			ai.domain = labels
+		} else {
+			name := addr
+			if labels[0] == "*" {
+				name = strings.Join(labels[1:], ".")
+			}
+
+			if canonical, err := canonicalDomain(name); err != nil {
+				return nil, err
+			} else if labels[0] == "*" {
+				ai.domain = append([]string{"*"}, strings.Split(canonical, ".")...)
+			} else {
+				ai.domain = strings.Split(canonical, ".")
+			}
 		}
 	}
 
@@ -133,6 +302,9 @@ func (ai *AI) String() string {
 	} else {
 		panic("illegal state")
 	}
+	if ai.ports != nil {
+		addr = fmt.Sprintf("%s:%s", addr, ai.ports)
+	}
 	return addr
 }
 
@@ -1,6 +1,10 @@
 package ident
 
-import "testing"
+import (
+	"errors"
+	"strings"
+	"testing"
+)
 
 func TestParseAIDomain(t *testing.T) {
 	aiStr := "example.com"
@@ -59,3 +63,136 @@ func TestMoreGeneral(t *testing.T) {
 		t.Fatalf("expected network to cover address")
 	}
 }
+
+func TestParseAIDomainValidation(t *testing.T) {
+	tooLongLabel := strings.Repeat("a", 64) + ".com"
+	tooLongName := strings.Repeat(strings.Repeat("a", 63)+".", 4) + "com"
+	for _, illegal := range []string{"a_b.example.com", "-a.example.com", "a-.example.com", "ex ample.com", tooLongLabel, tooLongName} {
+		if _, err := ParseAI(illegal); !errors.Is(err, ErrIllegalDomain) {
+			t.Errorf("expected ErrIllegalDomain for %q, got %v", illegal, err)
+		}
+	}
+}
+
+func TestParseAICanonicalForm(t *testing.T) {
+	tests := map[string]string{
+		"Example.COM":      "example.com",
+		"*.Example.COM":    "*.example.com",
+		"bücher.example":   "xn--bcher-kva.example",
+		"BÜCHER.example":   "xn--bcher-kva.example",
+		"xn--bcher-kva.de": "xn--bcher-kva.de",
+	}
+	for in, expected := range tests {
+		if ai, err := ParseAI(in); err != nil {
+			t.Errorf("parse %q: %v", in, err)
+		} else if ai.String() != expected {
+			t.Errorf("expected %q to be canonicalized to %q, got %q", in, expected, ai.String())
+		}
+	}
+}
+
+func TestMoreGeneralCanonical(t *testing.T) {
+	upper, _ := ParseAI("Example.COM")
+	lower, _ := ParseAI("example.com")
+	wildcard, _ := ParseAI("*.EXAMPLE.com")
+	sub, _ := ParseAI("API.example.com")
+	if !upper.MoreGeneral(lower) || !lower.MoreGeneral(upper) {
+		t.Fatalf("expected domains differing in case to match")
+	} else if !wildcard.MoreGeneral(sub) {
+		t.Fatalf("expected wildcard to cover subdomain irrespective of case")
+	}
+}
+
+func TestMoreGeneralPrefixes(t *testing.T) {
+	tests := []struct {
+		general, specific string
+		expected          bool
+	}{
+		{"[10.0.0.0/8]", "[10.0.0.0/24]", true},
+		{"[10.0.0.0/24]", "[10.0.0.0/8]", false},
+		{"[10.0.0.0/24]", "[10.0.0.0/24]", true},
+		{"[10.0.0.0/24]", "[10.0.1.0/24]", false},
+		{"[::/0]", "[10.0.0.1]", false},
+		{"[0.0.0.0/0]", "[2001:db8::1]", false},
+		{"[10.0.0.0/8]", "[::ffff:10.1.2.3]", true},
+		{"[::ffff:10.0.0.0/104]", "[10.1.2.3]", true},
+		{"[10.1.2.3]", "[10.1.2.3/32]", true},
+		{"[10.1.2.3]", "[10.1.2.0/24]", false},
+		{"[2001:db8::/32]", "[2001:db8:1::/48]", true},
+		{"[2001:db8:1::/48]", "[2001:db8::/32]", false},
+	}
+	for _, test := range tests {
+		general, err := ParseAI(test.general)
+		if err != nil {
+			t.Fatalf("parse %s: %v", test.general, err)
+		}
+		specific, err := ParseAI(test.specific)
+		if err != nil {
+			t.Fatalf("parse %s: %v", test.specific, err)
+		}
+		if general.MoreGeneral(specific) != test.expected {
+			t.Errorf("expected %s more general than %s to be %v", test.general, test.specific, test.expected)
+		}
+	}
+}
+
+func TestParseAIMappedIPv4(t *testing.T) {
+	if ai, err := ParseAI("[::ffff:10.0.0.0/104]"); err != nil {
+		t.Fatalf("parse mapped prefix: %v", err)
+	} else if ai.String() != "[10.0.0.0/8]" {
+		t.Fatalf("unexpected mapped prefix string: %s", ai)
+	}
+}
+
+func TestParseAIPorts(t *testing.T) {
+	tests := map[string]string{
+		"example.com:443":         "example.com:443",
+		"*.Example.com:8000-8080": "*.example.com:8000-8080",
+		"[192.0.2.1]:443":         "[192.0.2.1]:443",
+		"[2001:db8::/32]:1-1024":  "[2001:db8::/32]:1-1024",
+		"[2001:db8::1]:0-65535":   "[2001:db8::1]",
+		"example.com:0080":        "example.com:80",
+	}
+	for in, expected := range tests {
+		if ai, err := ParseAI(in); err != nil {
+			t.Errorf("parse %q: %v", in, err)
+		} else if ai.String() != expected {
+			t.Errorf("expected %q to be printed as %q, got %q", in, expected, ai.String())
+		}
+	}
+
+	for _, illegal := range []string{"example.com:", "example.com:65536", "example.com:90-80", "example.com:a", "[192.0.2.1]443", "example.com:1:2"} {
+		if _, err := ParseAI(illegal); err == nil {
+			t.Errorf("expected error for %q", illegal)
+		}
+	}
+}
+
+func TestMoreGeneralPorts(t *testing.T) {
+	tests := []struct {
+		general, specific string
+		expected          bool
+	}{
+		{"[192.0.2.0/24]", "[192.0.2.1]:443", true},
+		{"[192.0.2.0/24]:443", "[192.0.2.1]:443", true},
+		{"[192.0.2.0/24]:443", "[192.0.2.1]", false},
+		{"[192.0.2.1]:443", "[192.0.2.1]:80", false},
+		{"[192.0.2.1]:1-1024", "[192.0.2.1]:443", true},
+		{"[192.0.2.1]:1-1024", "[192.0.2.1]:1000-2000", false},
+		{"*.example.com:443", "api.example.com:443", true},
+		{"api.example.com:443", "api.example.com", false},
+	}
+	for _, test := range tests {
+		general, err := ParseAI(test.general)
+		if err != nil {
+			t.Fatalf("parse %s: %v", test.general, err)
+		}
+		specific, err := ParseAI(test.specific)
+		if err != nil {
+			t.Fatalf("parse %s: %v", test.specific, err)
+		}
+		if general.MoreGeneral(specific) != test.expected {
+			t.Errorf("expected %s more general than %s to be %v", test.general, test.specific, test.expected)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package ident
+
+import (
+	"math"
+	"net"
+	"slices"
+	"strings"
+)
+
+// AssetSet is a set of asset identifiers. It denotes the union of the assets
+// that its elements denote. Set operations are computed on the denoted assets,
+// not on the syntactic AIs, e.g., {*.example.com} is a superset of
+// {api.example.com}, and {[10.0.0.0/25], [10.0.0.128/25]} equals
+// {[10.0.0.0/24]}.
+type AssetSet []*AI
+
+// Construct a new asset set. The result is not minimized.
+func NewAssetSet(ais ...*AI) AssetSet {
+	return append(AssetSet{}, ais...)
+}
+
+// Check whether the given AI's assets are entirely included in the set.
+func (s AssetSet) Covers(ai *AI) bool {
+	return s.covers(ai, portRanges(ai.ports))
+}
+
+// Check whether the set includes the assets of ai's address on the given
+// ports. Addresses form a laminar family, hence, each element either includes
+// ai's address, lies within it, or is disjoint from it. The ports that are not
+// covered by the former must be covered by the elements within ai's address.
+// Only IP prefixes can be covered by smaller addresses, namely, by covering
+// both halves of the prefix. Domain wildcards denote infinitely many names and
+// can only be covered by elements that include them.
+func (s AssetSet) covers(ai *AI, ports []PortRange) bool {
+	inner := AssetSet{}
+	for _, elem := range s {
+		if elem.moreGeneralAddress(ai) {
+			ports = subtractPorts(ports, elem.ports)
+		} else if ai.moreGeneralAddress(elem) {
+			inner = append(inner, elem)
+		}
+	}
+
+	if len(ports) == 0 {
+		return true
+	} else if halves := splitPrefix(ai); len(inner) == 0 || halves == nil {
+		return false
+	} else {
+		return inner.covers(halves[0], ports) && inner.covers(halves[1], ports)
+	}
+}
+
+// Check whether all assets of s are included in other.
+func (s AssetSet) Subset(other AssetSet) bool {
+	for _, ai := range s {
+		if !other.Covers(ai) {
+			return false
+		}
+	}
+	return true
+}
+
+// Check whether s and other denote the same assets.
+func (s AssetSet) Equal(other AssetSet) bool {
+	return s.Subset(other) && other.Subset(s)
+}
+
+// Return the minimal cover of the union of s and other.
+func (s AssetSet) Union(other AssetSet) AssetSet {
+	return append(NewAssetSet(s...), other...).MinimalCover()
+}
+
+// Return the minimal cover of the assets included in both s and other.
+func (s AssetSet) Intersect(other AssetSet) AssetSet {
+	// Address components (domain names and wildcards as well as IP prefixes)
+	// form a laminar family: Two addresses either are disjoint or one includes
+	// the other. Port ranges intersect to a port range. Hence, pairwise
+	// intersection of the minimal covers is exact.
+	intersection := AssetSet{}
+	for _, a := range s.MinimalCover() {
+		for _, b := range other.MinimalCover() {
+			if ai := intersectAI(a, b); ai != nil {
+				intersection = append(intersection, ai)
+			}
+		}
+	}
+	return intersection.MinimalCover()
+}
+
+// Return a set of AIs that denotes the same assets as s. AIs that the other
+// AIs cover are dropped, IP prefixes or addresses that together form a larger
+// prefix are merged into that prefix, and adjacent port ranges of the same
+// address are merged into one range. The order of the remaining AIs is
+// preserved. The result is irredundant but not necessarily the smallest such
+// set, e.g., when port ranges overlap across prefixes.
+func (s AssetSet) MinimalCover() AssetSet {
+	cover := NewAssetSet(s...)
+	for changed := true; changed; {
+		changed = false
+		cover = cover.dropRedundant()
+		for i := 0; i < len(cover) && !changed; i++ {
+			for j := i + 1; j < len(cover) && !changed; j++ {
+				if merged := merge(cover[i], cover[j]); merged != nil {
+					cover[i] = merged
+					cover = append(cover[:j], cover[j+1:]...)
+					changed = true
+				}
+			}
+		}
+	}
+	return cover
+}
+
+// Drop AIs that the other AIs cover. Of equal AIs, only the first one is kept.
+func (s AssetSet) dropRedundant() AssetSet {
+	kept := NewAssetSet(s...)
+	for i := len(kept) - 1; i >= 0; i-- {
+		if others := append(NewAssetSet(kept[:i]...), kept[i+1:]...); others.Covers(kept[i]) {
+			kept = others
+		}
+	}
+	return kept
+}
+
+// Interpret an IP-based AI as prefix; addresses become host prefixes.
+func asPrefix(ai *AI) *net.IPNet {
+	if ai.ipPrefix != nil {
+		return ai.ipPrefix
+	} else if ai.ipAddr != nil {
+		bits := 8 * len(ai.ipAddr)
+		return &net.IPNet{IP: ai.ipAddr, Mask: net.CIDRMask(bits, bits)}
+	} else {
+		return nil
+	}
+}
+
+// Split an IP-based AI into the two halves of its prefix. Returns nil for
+// domains and single addresses.
+func splitPrefix(ai *AI) []*AI {
+	p := asPrefix(ai)
+	if p == nil {
+		return nil
+	}
+
+	ones, bits := p.Mask.Size()
+	if ones == bits {
+		return nil
+	}
+	mask := net.CIDRMask(ones+1, bits)
+	low := p.IP.Mask(mask)
+	high := slices.Clone(low)
+	high[ones/8] |= 0x80 >> (ones % 8)
+	return []*AI{
+		{ipPrefix: &net.IPNet{IP: low, Mask: mask}},
+		{ipPrefix: &net.IPNet{IP: high, Mask: mask}},
+	}
+}
+
+// Return the given port range as list of ranges; nil denotes all ports.
+func portRanges(ports *PortRange) []PortRange {
+	if ports == nil {
+		return []PortRange{{Low: 0, High: math.MaxUint16}}
+	} else {
+		return []PortRange{*ports}
+	}
+}
+
+// Remove the ports of sub from the given ranges; nil denotes all ports.
+func subtractPorts(ranges []PortRange, sub *PortRange) []PortRange {
+	if sub == nil {
+		return nil
+	}
+
+	rest := []PortRange{}
+	for _, r := range ranges {
+		if r.Low < sub.Low {
+			rest = append(rest, PortRange{Low: r.Low, High: min(r.High, sub.Low-1)})
+		}
+		if sub.High < r.High {
+			rest = append(rest, PortRange{Low: max(r.Low, sub.High+1), High: r.High})
+		}
+	}
+	return rest
+}
+
+func samePorts(a, b *AI) bool {
+	if a.ports == nil || b.ports == nil {
+		return a.ports == b.ports
+	} else {
+		return *a.ports == *b.ports
+	}
+}
+
+// Return a copy of ai restricted to the given ports.
+func withPorts(ai *AI, ports *PortRange) *AI {
+	cpy := *ai
+	if ports != nil && ports.Low == 0 && ports.High == math.MaxUint16 {
+		cpy.ports = nil
+	} else {
+		cpy.ports = ports
+	}
+	return &cpy
+}
+
+// Return an AI that denotes exactly the assets of a and b, or nil if there is
+// no such AI.
+func merge(a, b *AI) *AI {
+	if samePorts(a, b) {
+		return siblingParent(a, b)
+	} else if a.ports == nil || b.ports == nil {
+		return nil
+	} else if !a.moreGeneralAddress(b) || !b.moreGeneralAddress(a) {
+		return nil
+	} else if pa, pb := a.ports, b.ports; uint32(pa.High)+1 < uint32(pb.Low) || uint32(pb.High)+1 < uint32(pa.Low) {
+		// Port ranges are neither overlapping nor adjacent
+		return nil
+	} else {
+		return withPorts(a, &PortRange{Low: min(pa.Low, pb.Low), High: max(pa.High, pb.High)})
+	}
+}
+
+// Return the AI that denotes the assets that both a and b denote, or nil if
+// there are none.
+func intersectAI(a, b *AI) *AI {
+	var addr *AI
+	if a.moreGeneralAddress(b) {
+		addr = b
+	} else if b.moreGeneralAddress(a) {
+		addr = a
+	} else {
+		return nil
+	}
+
+	if a.ports == nil {
+		return withPorts(addr, b.ports)
+	} else if b.ports == nil {
+		return withPorts(addr, a.ports)
+	} else if low, high := max(a.ports.Low, b.ports.Low), min(a.ports.High, b.ports.High); low > high {
+		return nil
+	} else {
+		return withPorts(addr, &PortRange{Low: low, High: high})
+	}
+}
+
+// If a and b are the two halves of a prefix, return that prefix. Return nil
+// otherwise. Ports of a and b must be equal and are retained.
+func siblingParent(a, b *AI) *AI {
+	pa, pb := asPrefix(a), asPrefix(b)
+	if pa == nil || pb == nil {
+		return nil
+	}
+
+	onesA, bitsA := pa.Mask.Size()
+	onesB, bitsB := pb.Mask.Size()
+	if bitsA != bitsB || onesA != onesB || onesA == 0 || pa.IP.Equal(pb.IP) {
+		return nil
+	}
+
+	mask := net.CIDRMask(onesA-1, bitsA)
+	if parent := pa.IP.Mask(mask); parent.Equal(pb.IP.Mask(mask)) {
+		return &AI{ipPrefix: &net.IPNet{IP: parent, Mask: mask}, ports: a.ports}
+	} else {
+		return nil
+	}
+}
+
+func (s AssetSet) String() string {
+	strs := make([]string, 0, len(s))
+	for _, ai := range s {
+		strs = append(strs, ai.String())
+	}
+	return strings.Join(strs, ", ")
+}
@@ -0,0 +1,96 @@
+package ident
+
+import "testing"
+
+func mkSet(t *testing.T, ais ...string) AssetSet {
+	t.Helper()
+	set := AssetSet{}
+	for _, str := range ais {
+		if ai, err := ParseAI(str); err != nil {
+			t.Fatalf("parse %s: %v", str, err)
+		} else {
+			set = append(set, ai)
+		}
+	}
+	return set
+}
+
+func TestMinimalCover(t *testing.T) {
+	set := mkSet(t, "api.example.com", "*.example.com", "example.com", "[10.0.0.0/25]", "[10.0.0.128/26]", "[10.0.0.192/26]", "[10.0.0.5]")
+	if cover := set.MinimalCover(); cover.String() != "*.example.com, [10.0.0.0/24]" {
+		t.Fatalf("unexpected minimal cover: %s", cover)
+	}
+
+	hosts := mkSet(t, "[192.0.2.0]", "[192.0.2.1]", "[192.0.2.1]")
+	if cover := hosts.MinimalCover(); cover.String() != "[192.0.2.0/31]" {
+		t.Fatalf("unexpected minimal cover of hosts: %s", cover)
+	}
+}
+
+func TestSubset(t *testing.T) {
+	halves := mkSet(t, "[10.0.0.0/25]", "[10.0.0.128/25]")
+	whole := mkSet(t, "[10.0.0.0/24]")
+	if !whole.Subset(halves) || !halves.Subset(whole) || !halves.Equal(whole) {
+		t.Fatalf("expected halves to equal whole prefix")
+	} else if mkSet(t, "[10.0.0.0/8]").Subset(whole) {
+		t.Fatalf("expected shorter prefix not to be a subset")
+	} else if !mkSet(t, "a.example.com", "[10.0.0.7]").Subset(mkSet(t, "*.example.com", "[10.0.0.0/24]")) {
+		t.Fatalf("expected mixed set to be a subset")
+	} else if mkSet(t, "example.org").Subset(mkSet(t, "*.example.com")) {
+		t.Fatalf("expected unrelated domain not to be a subset")
+	}
+}
+
+func TestUnionIntersect(t *testing.T) {
+	a := mkSet(t, "*.example.com", "[10.0.0.0/24]")
+	b := mkSet(t, "api.example.com", "example.org", "[10.0.0.128/25]", "[2001:db8::/32]")
+	if union := a.Union(b); union.String() != "*.example.com, [10.0.0.0/24], example.org, [2001:db8::/32]" {
+		t.Fatalf("unexpected union: %s", union)
+	} else if intersection := a.Intersect(b); intersection.String() != "api.example.com, [10.0.0.128/25]" {
+		t.Fatalf("unexpected intersection: %s", intersection)
+	} else if empty := a.Intersect(mkSet(t, "example.net")); len(empty) != 0 {
+		t.Fatalf("expected empty intersection, got %s", empty)
+	}
+}
+
+func TestAssetSetPorts(t *testing.T) {
+	ranges := mkSet(t, "example.com:1-100", "example.com:101-200", "[10.0.0.0/25]:443", "[10.0.0.128/25]:443")
+	if cover := ranges.MinimalCover(); cover.String() != "example.com:1-200, [10.0.0.0/24]:443" {
+		t.Fatalf("unexpected minimal cover: %s", cover)
+	} else if !mkSet(t, "example.com:50-150").Subset(ranges) {
+		t.Fatalf("expected port range to be covered by adjacent ranges")
+	} else if mkSet(t, "[10.0.0.0/24]:80").Subset(ranges) {
+		t.Fatalf("expected other port not to be covered")
+	}
+
+	a := mkSet(t, "*.example.com:1-1024", "[10.0.0.0/24]")
+	b := mkSet(t, "api.example.com:443-8443", "[10.0.0.7]:22")
+	if intersection := a.Intersect(b); intersection.String() != "api.example.com:443-1024, [10.0.0.7]:22" {
+		t.Fatalf("unexpected intersection: %s", intersection)
+	}
+}
+
+func TestAssetSetSplitPorts(t *testing.T) {
+	split := mkSet(t, "[10.0.0.0/25]:80-81", "[10.0.0.128/25]:80")
+	if !split.Covers(mkSet(t, "[10.0.0.0/24]:80")[0]) {
+		t.Fatalf("expected prefix to be covered by its halves on a shared port")
+	} else if split.Covers(mkSet(t, "[10.0.0.0/24]:80-81")[0]) {
+		t.Fatalf("expected port of one half only not to be covered")
+	} else if !mkSet(t, "[10.0.0.0/24]:80", "[10.0.0.0/25]:81").Equal(split) {
+		t.Fatalf("expected sets to denote the same assets")
+	}
+
+	mixed := mkSet(t, "[10.0.0.0/24]:1-100", "[10.0.0.0/26]:101-200", "[10.0.0.64/26]", "[10.0.0.128/25]:50-300")
+	if !mixed.Covers(mkSet(t, "[10.0.0.0/24]:60-200")[0]) {
+		t.Fatalf("expected prefix to be covered by nested prefixes and ports")
+	} else if mixed.Covers(mkSet(t, "[10.0.0.0/24]:60-201")[0]) {
+		t.Fatalf("expected uncovered port not to be covered")
+	}
+
+	redundant := append(NewAssetSet(split...), mkSet(t, "[10.0.0.0/24]:80")[0])
+	if cover := redundant.MinimalCover(); cover.String() != split.String() {
+		t.Fatalf("unexpected minimal cover: %s", cover)
+	} else if mkSet(t, "*.example.com:80").Subset(mkSet(t, "*.example.com:1-79", "*.a.example.com:80", "example.com")) {
+		t.Fatalf("expected wildcard not to be covered by smaller domains")
+	}
+}
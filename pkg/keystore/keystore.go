@@ -0,0 +1,166 @@
+/*
+Package keystore encrypts and decrypts private keys at rest. Keys are either
+stored as encrypted PKCS#8 PEM blocks ("ENCRYPTED PRIVATE KEY") or as JWK sets
+encrypted as JWE using PBES2. Decrypted keys are only held in memory.
+*/
+package keystore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwe"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+var ErrDecryption = errors.New("could not decrypt key; wrong passphrase?")
+var ErrUnsupportedEncryption = errors.New("unsupported key encryption")
+var ErrIllegalEncryptedKey = errors.New("illegal encrypted key")
+var ErrEmptyPassphrase = errors.New("passphrase must not be empty")
+
+const pemTypeEncrypted = "ENCRYPTED PRIVATE KEY"
+
+// Content type of JWE-encrypted JWK sets (see RFC 7517, Section 8.6).
+const jwkSetCty = "jwk-set+json"
+
+// Passphrase provides the passphrase to unlock or lock keys. It is only called
+// if a passphrase is needed. Callers should not retain the returned slice, as
+// it is zeroed after use.
+type Passphrase func() ([]byte, error)
+
+// Check whether the given key file content is encrypted.
+func IsEncrypted(bs []byte) bool {
+	return isJWE(bs) || bytes.Contains(bs, []byte("-----BEGIN "+pemTypeEncrypted+"-----"))
+}
+
+// JWEs in compact serialization consist of five parts.
+func isJWE(bs []byte) bool {
+	bs = bytes.TrimSpace(bs)
+	return len(bs) > 0 && bs[0] != '{' && bytes.Count(bs, []byte(".")) == 4
+}
+
+// Parse a key set that may be encrypted. Unencrypted key files are parsed as
+// PEM or JWK depending on isJWK.
+func Parse(bs []byte, isJWK bool, passphrase Passphrase) (jwk.Set, error) {
+	if !IsEncrypted(bs) {
+		return jwk.Parse(bs, jwk.WithPEM(!isJWK))
+	}
+
+	pass, err := passphrase()
+	if err != nil {
+		return nil, err
+	}
+	defer clear(pass)
+
+	if isJWE(bs) {
+		return decryptJWK(bytes.TrimSpace(bs), pass)
+	}
+	return decryptPEM(bs, pass)
+}
+
+func decryptJWK(bs []byte, pass []byte) (jwk.Set, error) {
+	if payload, err := jwe.Decrypt(bs, jwe.WithKey(jwa.PBES2_HS512_A256KW(), pass)); err != nil {
+		return nil, ErrDecryption
+	} else {
+		defer clear(payload)
+		return jwk.Parse(payload)
+	}
+}
+
+func decryptPEM(bs []byte, pass []byte) (jwk.Set, error) {
+	set := jwk.NewSet()
+	for {
+		var block *pem.Block
+		if block, bs = pem.Decode(bs); block == nil {
+			break
+		} else if block.Type != pemTypeEncrypted {
+			if key, err := jwk.ParseKey(pem.EncodeToMemory(block), jwk.WithPEM(true)); err != nil {
+				return nil, err
+			} else if err := set.AddKey(key); err != nil {
+				return nil, err
+			}
+		} else if der, err := decryptPKCS8(block.Bytes, pass); err != nil {
+			return nil, err
+		} else if raw, err := x509.ParsePKCS8PrivateKey(der); err != nil {
+			clear(der)
+			return nil, ErrDecryption
+		} else if key, err := jwk.Import(raw); err != nil {
+			clear(der)
+			return nil, err
+		} else if err := set.AddKey(key); err != nil {
+			clear(der)
+			return nil, err
+		} else {
+			clear(der)
+		}
+	}
+	return set, nil
+}
+
+// Encrypt all keys of a set as PKCS#8 PEM blocks.
+func EncryptPEM(set jwk.Set, passphrase Passphrase) ([]byte, error) {
+	pass, err := getPassphrase(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(pass)
+
+	out := []byte{}
+	for i := range set.Len() {
+		var raw any
+		if key, ok := set.Key(i); !ok {
+			return nil, ErrIllegalEncryptedKey
+		} else if err := jwk.Export(key, &raw); err != nil {
+			return nil, err
+		} else if der, err := x509.MarshalPKCS8PrivateKey(raw); err != nil {
+			return nil, err
+		} else if encrypted, err := encryptPKCS8(der, pass); err != nil {
+			clear(der)
+			return nil, err
+		} else {
+			clear(der)
+			out = append(out, pem.EncodeToMemory(&pem.Block{Type: pemTypeEncrypted, Bytes: encrypted})...)
+		}
+	}
+	return out, nil
+}
+
+// Encrypt a key set as JWE in compact serialization.
+func EncryptJWK(set jwk.Set, passphrase Passphrase) ([]byte, error) {
+	pass, err := getPassphrase(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(pass)
+
+	headers := jwe.NewHeaders()
+	if err := headers.Set(jwe.ContentTypeKey, jwkSetCty); err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(set)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(payload)
+	return jwe.Encrypt(
+		payload,
+		jwe.WithKey(jwa.PBES2_HS512_A256KW(), pass),
+		jwe.WithContentEncryption(jwa.A256GCM()),
+		jwe.WithProtectedHeaders(headers),
+	)
+}
+
+func getPassphrase(passphrase Passphrase) ([]byte, error) {
+	if pass, err := passphrase(); err != nil {
+		return nil, err
+	} else if len(pass) == 0 {
+		return nil, ErrEmptyPassphrase
+	} else {
+		return pass, nil
+	}
+}
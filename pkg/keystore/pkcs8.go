@@ -0,0 +1,164 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"hash"
+)
+
+// Encryption of PKCS#8 private keys using PBES2 with PBKDF2 and AES-CBC (see
+// RFC 5958 and RFC 8018).
+
+var oidPBES2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+var oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+
+var prfs = map[string]func() hash.Hash{
+	asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}.String():  sha1.New,
+	asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}.String():  sha256.New,
+	asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}.String(): sha512.New384,
+	asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}.String(): sha512.New,
+}
+var oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+
+// Key lengths of AES-CBC by OID.
+var ciphers = map[string]int{
+	asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}.String():  16,
+	asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}.String(): 24,
+	asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}.String(): 32,
+}
+var oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+
+// Number of PBKDF2 iterations for newly encrypted keys.
+const pbkdf2Iterations = 600000
+
+// Upper bound of PBKDF2 iterations of keys to decrypt. Bounds the work that a
+// crafted key file can cause.
+const maxPBKDF2Iterations = 10 * pbkdf2Iterations
+
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+func marshalAlgorithm(oid asn1.ObjectIdentifier, params any) (pkix.AlgorithmIdentifier, error) {
+	if bs, err := asn1.Marshal(params); err != nil {
+		return pkix.AlgorithmIdentifier{}, err
+	} else {
+		return pkix.AlgorithmIdentifier{Algorithm: oid, Parameters: asn1.RawValue{FullBytes: bs}}, nil
+	}
+}
+
+// Encrypt a DER-encoded PKCS#8 private key. Returns the DER encoding of the
+// EncryptedPrivateKeyInfo.
+func encryptPKCS8(der []byte, passphrase []byte) ([]byte, error) {
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	} else if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+
+	key, err := pbkdf2.Key(sha256.New, string(passphrase), salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padLen := aes.BlockSize - len(der)%aes.BlockSize
+	encrypted := append(bytes.Clone(der), bytes.Repeat([]byte{byte(padLen)}, padLen)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	prf := pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue}
+	if kdf, err := marshalAlgorithm(oidPBKDF2, pbkdf2Params{Salt: salt, IterationCount: pbkdf2Iterations, PRF: prf}); err != nil {
+		return nil, err
+	} else if scheme, err := marshalAlgorithm(oidAES256CBC, iv); err != nil {
+		return nil, err
+	} else if algo, err := marshalAlgorithm(oidPBES2, pbes2Params{KeyDerivationFunc: kdf, EncryptionScheme: scheme}); err != nil {
+		return nil, err
+	} else {
+		return asn1.Marshal(encryptedPrivateKeyInfo{EncryptionAlgorithm: algo, EncryptedData: encrypted})
+	}
+}
+
+// Decrypt the DER encoding of an EncryptedPrivateKeyInfo. Returns the
+// DER-encoded PKCS#8 private key.
+func decryptPKCS8(der []byte, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	var params pbes2Params
+	var kdfParams pbkdf2Params
+	var iv []byte
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	} else if !info.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncryption, info.EncryptionAlgorithm.Algorithm)
+	} else if _, err := asn1.Unmarshal(info.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	} else if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncryption, params.KeyDerivationFunc.Algorithm)
+	} else if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, err
+	} else if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+
+	// PRF defaults to HMAC-SHA1
+	prf := sha1.New
+	if len(kdfParams.PRF.Algorithm) > 0 {
+		var ok bool
+		if prf, ok = prfs[kdfParams.PRF.Algorithm.String()]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncryption, kdfParams.PRF.Algorithm)
+		}
+	}
+	keyLen, ok := ciphers[params.EncryptionScheme.Algorithm.String()]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedEncryption, params.EncryptionScheme.Algorithm)
+	} else if len(iv) != aes.BlockSize || len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, ErrIllegalEncryptedKey
+	} else if kdfParams.IterationCount < 1 || kdfParams.IterationCount > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("%w: %d PBKDF2 iterations", ErrIllegalEncryptedKey, kdfParams.IterationCount)
+	} else if kdfParams.KeyLength != 0 && kdfParams.KeyLength != keyLen {
+		// The key length is optional but must match the cipher if present
+		return nil, fmt.Errorf("%w: key length %d", ErrIllegalEncryptedKey, kdfParams.KeyLength)
+	}
+
+	key, err := pbkdf2.Key(prf, string(passphrase), kdfParams.Salt, kdfParams.IterationCount, keyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	decrypted := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, info.EncryptedData)
+
+	padLen := int(decrypted[len(decrypted)-1])
+	if padLen == 0 || padLen > aes.BlockSize || !bytes.Equal(decrypted[len(decrypted)-padLen:], bytes.Repeat([]byte{byte(padLen)}, padLen)) {
+		return nil, ErrDecryption
+	}
+	return decrypted[:len(decrypted)-padLen], nil
+}
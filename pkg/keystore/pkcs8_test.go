@@ -0,0 +1,46 @@
+package keystore
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"testing"
+)
+
+// Encode an EncryptedPrivateKeyInfo with the given PBKDF2 parameters and an
+// AES-256-CBC encryption scheme.
+func mkEncryptedInfo(t *testing.T, kdfParams pbkdf2Params) []byte {
+	t.Helper()
+	iv := make([]byte, 16)
+	if kdf, err := marshalAlgorithm(oidPBKDF2, kdfParams); err != nil {
+		t.Fatal(err)
+	} else if scheme, err := marshalAlgorithm(oidAES256CBC, iv); err != nil {
+		t.Fatal(err)
+	} else if algo, err := marshalAlgorithm(oidPBES2, pbes2Params{KeyDerivationFunc: kdf, EncryptionScheme: scheme}); err != nil {
+		t.Fatal(err)
+	} else if der, err := asn1.Marshal(encryptedPrivateKeyInfo{EncryptionAlgorithm: algo, EncryptedData: make([]byte, 32)}); err != nil {
+		t.Fatal(err)
+	} else {
+		return der
+	}
+	return nil
+}
+
+func TestDecryptIllegalParams(t *testing.T) {
+	prf := pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue}
+	tests := []pbkdf2Params{
+		{Salt: make([]byte, 16), IterationCount: maxPBKDF2Iterations + 1, PRF: prf},
+		{Salt: make([]byte, 16), IterationCount: 0, PRF: prf},
+		{Salt: make([]byte, 16), IterationCount: 1, KeyLength: 16, PRF: prf},
+	}
+	for _, test := range tests {
+		if _, err := decryptPKCS8(mkEncryptedInfo(t, test), []byte("adem")); !errors.Is(err, ErrIllegalEncryptedKey) {
+			t.Errorf("iterations %d, key length %d: expected illegal key, got %v", test.IterationCount, test.KeyLength, err)
+		}
+	}
+
+	valid := pbkdf2Params{Salt: make([]byte, 16), IterationCount: 1, KeyLength: 32, PRF: prf}
+	if _, err := decryptPKCS8(mkEncryptedInfo(t, valid), []byte("adem")); !errors.Is(err, ErrDecryption) {
+		t.Errorf("expected decryption to fail on padding, got %v", err)
+	}
+}
@@ -23,12 +23,33 @@ type CTQueryResult struct {
 	subjects []string
 }
 
+// Return the DNS labels that identify the configuration certificate of the
+// root key with the given KID, i.e., "<kid>.adem-configuration". The labels
+// are prepended to the issuer OI's hostname.
+func ConfigurationLabel(kid string) string {
+	return kid + ".adem-configuration"
+}
+
+// Return the DNS names the configuration certificate of the root key with the
+// given KID must be valid for, i.e., the issuer OI's hostname and
+// "<kid>.adem-configuration.<hostname>".
+func ConfigurationNames(issuer string, kid string) ([]string, error) {
+	if issuerUrl, err := url.Parse(issuer); err != nil {
+		return nil, err
+	} else if issuerUrl.Hostname() == "" {
+		return nil, ErrIssNoHostName
+	} else {
+		host := issuerUrl.Hostname()
+		return []string{host, fmt.Sprintf("%s.%s", ConfigurationLabel(kid), host)}, nil
+	}
+}
+
 // Verify that the given key was correctly committed to the Certificate
 // Transparency infrastructure for the given issuer.
 func VerifyBindingCerts(iss string, key jwk.Key, logs []*tokens.LogConfig) []CTQueryResult {
 	verified := VerifyInclusionConfig(logs)
-	for _, queryResult := range verified {
-		queryResult.Ok = VerifyBinding(queryResult, iss, key) == nil
+	for i := range verified {
+		verified[i].Ok = verified[i].Ok && VerifyBinding(verified[i], iss, key) == nil
 	}
 	return verified
 }
@@ -51,7 +72,7 @@ func VerifyBinding(q CTQueryResult, issuer string, rootKey jwk.Key) error {
 
 	if !util.Contains(q.subjects, issuerUrl.Hostname()) {
 		return ErrCertNotForIss
-	} else if !util.Contains(q.subjects, fmt.Sprintf("%s.adem-configuration.%s", kid, issuerUrl.Hostname())) {
+	} else if !util.Contains(q.subjects, fmt.Sprintf("%s.%s", ConfigurationLabel(kid), issuerUrl.Hostname())) {
 		return ErrCertNotForKey
 	}
 	return nil
@@ -0,0 +1,102 @@
+package roots
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+
+	"filippo.io/sunlight"
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	ct "github.com/google/certificate-transparency-go"
+	"github.com/google/certificate-transparency-go/tls"
+	"github.com/google/certificate-transparency-go/x509"
+)
+
+var ErrNoPEM = errors.New("could not decode PEM")
+
+// Parse a PEM-encoded certificate chain, leaf first.
+func ParseCerts(bs []byte) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0)
+	var block *pem.Block
+	var rest []byte
+	for rest == nil || len(rest) > 0 {
+		if block, rest = pem.Decode(bs); block == nil {
+			return nil, ErrNoPEM
+		} else {
+			bs = rest
+			if cert, err := x509.ParseCertificate(block.Bytes); err != nil {
+				return nil, err
+			} else {
+				certs = append(certs, cert)
+			}
+		}
+	}
+	return certs, nil
+}
+
+// Convert the SCTs embedded in the leaf of a certificate chain into log
+// configs for the "log" claim of endorsements. For RFC 6962 SCTs, the configs
+// hold leaf hashes; for Static CT SCTs, the leaf index advertised in the SCT
+// extension. Returns the errors of SCTs that could not be converted.
+func LogConfigs(certChain []*x509.Certificate) (tokens.Log, []error) {
+	logs := tokens.Log{}
+	errs := []error{}
+	for _, serializedSct := range certChain[0].SCTList.SCTList {
+		var sct ct.SignedCertificateTimestamp
+		if _, err := tls.Unmarshal(serializedSct.Val, &sct); err != nil {
+			errs = append(errs, err)
+		} else if cfg, err := mkCfg(certChain, &sct); err != nil {
+			errs = append(errs, err)
+		} else {
+			logs = append(logs, cfg)
+		}
+	}
+	return logs, errs
+}
+
+func mkV1Cfg(logID []byte, leaf *ct.MerkleTreeLeaf) (*tokens.LogConfig, error) {
+	if hash, err := ct.LeafHashForLeaf(leaf); err != nil {
+		return nil, err
+	} else {
+		cfg := tokens.LogConfig{
+			Ver: consts.LogVersionV1,
+			Id:  base64.StdEncoding.EncodeToString(logID),
+			Hash: &tokens.LeafHash{
+				B64: base64.StdEncoding.EncodeToString(hash[:]),
+			},
+		}
+		return &cfg, nil
+	}
+}
+
+func mkStaticCfg(logID []byte, sct *ct.SignedCertificateTimestamp) (*tokens.LogConfig, error) {
+	if ext, err := sunlight.ParseExtensions(sct.Extensions); err != nil {
+		return nil, err
+	} else {
+		return &tokens.LogConfig{
+			Ver:   consts.LogVersionStatic,
+			Id:    base64.StdEncoding.EncodeToString(logID),
+			Index: &ext.LeafIndex,
+		}, nil
+	}
+}
+
+func mkV1Leaf(certChain []*x509.Certificate, timestamp uint64) (*ct.MerkleTreeLeaf, error) {
+	cert := certChain[0]
+	if len(cert.SCTList.SCTList) > 0 {
+		return ct.MerkleTreeLeafForEmbeddedSCT(certChain, timestamp)
+	} else {
+		return ct.MerkleTreeLeafFromChain(certChain, ct.X509LogEntryType, timestamp)
+	}
+}
+
+func mkCfg(certChain []*x509.Certificate, sct *ct.SignedCertificateTimestamp) (*tokens.LogConfig, error) {
+	if len(sct.Extensions) > 0 {
+		return mkStaticCfg(sct.LogID.KeyID[:], sct)
+	} else if leaf, err := mkV1Leaf(certChain, sct.Timestamp); err != nil {
+		return nil, err
+	} else {
+		return mkV1Cfg(sct.LogID.KeyID[:], leaf)
+	}
+}
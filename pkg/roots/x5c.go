@@ -0,0 +1,117 @@
+package roots
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/cert"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+var ErrNoX5CAnchors = errors.New("no x5c trust anchors configured")
+var ErrCertNoServerAuth = errors.New("leaf certificate not valid for server authentication")
+
+var x5cAnchors *x509.CertPool
+var x5cAnchorsLock sync.RWMutex = sync.RWMutex{}
+
+// Trust the given certificate as anchor for x5c certificate chains.
+func AddX5CAnchor(c *x509.Certificate) {
+	x5cAnchorsLock.Lock()
+	defer x5cAnchorsLock.Unlock()
+
+	if x5cAnchors == nil {
+		x5cAnchors = x509.NewCertPool()
+	}
+	x5cAnchors.AddCert(c)
+}
+
+// Remove all configured x5c trust anchors.
+func ResetX5CAnchors() {
+	x5cAnchorsLock.Lock()
+	defer x5cAnchorsLock.Unlock()
+
+	x5cAnchors = nil
+}
+
+// Read PEM-encoded x5c trust anchors from all files that match the given glob.
+func ReadX5CAnchors(pattern string) error {
+	if matches, err := filepath.Glob(pattern); err != nil {
+		return err
+	} else {
+		for _, path := range matches {
+			if bs, err := os.ReadFile(path); err != nil {
+				return err
+			} else if chain, err := tokens.ParseCertChain(bs); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			} else if certs, err := tokens.Certificates(chain); err != nil {
+				return fmt.Errorf("%s: %w", path, err)
+			} else {
+				for _, c := range certs {
+					AddX5CAnchor(c)
+				}
+			}
+		}
+		return nil
+	}
+}
+
+// Check whether any x5c trust anchors are configured.
+func HasX5CAnchors() bool {
+	x5cAnchorsLock.RLock()
+	defer x5cAnchorsLock.RUnlock()
+
+	return x5cAnchors != nil
+}
+
+// Verify that the given x5c certificate chain binds the key to the given
+// issuer, i.e., that the leaf certificate certifies the key, is valid for the
+// issuer OI's hostname and for TLS server authentication, and chains to a
+// configured trust anchor.
+func VerifyBindingX5C(iss string, key jwk.Key, chain *cert.Chain) error {
+	x5cAnchorsLock.RLock()
+	anchors := x5cAnchors
+	x5cAnchorsLock.RUnlock()
+
+	if anchors == nil {
+		return ErrNoX5CAnchors
+	}
+
+	issuerUrl, err := url.Parse(iss)
+	if err != nil {
+		return err
+	} else if issuerUrl.Hostname() == "" {
+		return ErrIssNoHostName
+	}
+
+	certs, err := tokens.Certificates(chain)
+	if err != nil {
+		return err
+	} else if err := tokens.CertifiesKey(certs[0], key); err != nil {
+		return fmt.Errorf("%w: %s", ErrCertNotForKey, err)
+	} else if !slices.Contains(certs[0].ExtKeyUsage, x509.ExtKeyUsageServerAuth) {
+		// Chain verification would accept leaf certificates without extended
+		// key usage for any usage.
+		return ErrCertNoServerAuth
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range certs[1:] {
+		intermediates.AddCert(c)
+	}
+	if _, err := certs[0].Verify(x509.VerifyOptions{
+		DNSName:       issuerUrl.Hostname(),
+		Roots:         anchors,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}); err != nil {
+		return fmt.Errorf("%w: %s", ErrCertNotForIss, err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package roots
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/cert"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+// Create a self-signed certificate for example.com with the given extended key
+// usages. Returns the certificate and its key.
+func mkCert(t *testing.T, usages ...x509.ExtKeyUsage) (*x509.Certificate, jwk.Key) {
+	t.Helper()
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "example.com"},
+		DNSNames:              []string{"example.com"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		ExtKeyUsage:           usages,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &sk.PublicKey, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := jwk.Import(&sk.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, key
+}
+
+func TestVerifyBindingX5C(t *testing.T) {
+	t.Cleanup(ResetX5CAnchors)
+
+	tests := []struct {
+		usages   []x509.ExtKeyUsage
+		iss      string
+		expected error
+	}{
+		{[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, "https://example.com", nil},
+		{[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, "https://example.org", ErrCertNotForIss},
+		{[]x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, "https://example.com", ErrCertNoServerAuth},
+		{[]x509.ExtKeyUsage{x509.ExtKeyUsageAny}, "https://example.com", ErrCertNoServerAuth},
+		{nil, "https://example.com", ErrCertNoServerAuth},
+	}
+	for _, test := range tests {
+		ResetX5CAnchors()
+		c, key := mkCert(t, test.usages...)
+		chain := &cert.Chain{}
+		if err := chain.AddString(base64.StdEncoding.EncodeToString(c.Raw)); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := VerifyBindingX5C(test.iss, key, chain); !errors.Is(err, ErrNoX5CAnchors) {
+			t.Errorf("expected no anchors, got %v", err)
+		}
+		AddX5CAnchor(c)
+		if err := VerifyBindingX5C(test.iss, key, chain); !errors.Is(err, test.expected) {
+			t.Errorf("usages %v, issuer %s: expected %v, got %v", test.usages, test.iss, test.expected, err)
+		}
+	}
+}
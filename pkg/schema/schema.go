@@ -0,0 +1,125 @@
+/*
+This package validates claims prototypes of emblems and endorsements against
+the JSON schema shipped in proto.schema.json.
+*/
+package schema
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+)
+
+//go:embed proto.schema.json
+var protoSchema []byte
+
+const schemaURL = "https://github.com/adem-wg/adem-proto/pkg/schema/proto.schema.json"
+
+var ErrUnknownCty = errors.New("no schema for content type")
+
+var emblemSchema, endorsementSchema = func() (*jsonschema.Schema, *jsonschema.Schema) {
+	c := jsonschema.NewCompiler()
+	if doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(protoSchema)); err != nil {
+		panic(err)
+	} else if err := c.AddResource(schemaURL, doc); err != nil {
+		panic(err)
+	}
+	return c.MustCompile(schemaURL + "#/$defs/emblem"), c.MustCompile(schemaURL + "#/$defs/endorsement")
+}()
+
+// Constraints of the "emb" claim that the schema knows.
+var schemaConstraints = func() map[string]bool {
+	var doc struct {
+		Defs struct {
+			Emb struct {
+				Properties map[string]any `json:"properties"`
+			} `json:"emb"`
+		} `json:"$defs"`
+	}
+	if err := json.Unmarshal(protoSchema, &doc); err != nil {
+		panic(err)
+	}
+	known := map[string]bool{}
+	for name := range doc.Defs.Emb.Properties {
+		known[name] = true
+	}
+	return known
+}()
+
+var printer = message.NewPrinter(language.English)
+
+// Error that lists all schema violations of a claims prototype by JSON
+// pointer.
+type ValidationError struct {
+	Violations []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("claims prototype violates schema:\n- %s", strings.Join(e.Violations, "\n- "))
+}
+
+func collect(e *jsonschema.ValidationError, violations []string) []string {
+	if len(e.Causes) == 0 {
+		path := "/" + strings.Join(e.InstanceLocation, "/")
+		return append(violations, fmt.Sprintf("%s: %s", path, e.ErrorKind.LocalizedString(printer)))
+	}
+	for _, cause := range e.Causes {
+		violations = collect(cause, violations)
+	}
+	return violations
+}
+
+// Validate a claims prototype of a token with the given content type. Claims
+// registered as extensions (see [tokens.RegisterClaim]) are exempt, as are
+// registered extension constraints (see [tokens.RegisterConstraint]) that the
+// schema does not know.
+func ValidateProto(cty consts.CTY, bs []byte) error {
+	var schema *jsonschema.Schema
+	switch cty {
+	case consts.EmblemCty:
+		schema = emblemSchema
+	case consts.EndorsementCty:
+		schema = endorsementSchema
+	default:
+		return ErrUnknownCty
+	}
+
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(bs))
+	if err != nil {
+		return err
+	}
+
+	// Registered claim extensions are validated by their own validators.
+	if claims, ok := doc.(map[string]any); ok {
+		for name := range claims {
+			if tokens.IsClaimExtension(name) {
+				delete(claims, name)
+			}
+		}
+		if emb, ok := claims["emb"].(map[string]any); ok {
+			for name := range emb {
+				if !schemaConstraints[name] && tokens.IsConstraintExtension(name) {
+					delete(emb, name)
+				}
+			}
+		}
+	}
+
+	if err := schema.Validate(doc); err != nil {
+		var vErr *jsonschema.ValidationError
+		if errors.As(err, &vErr) {
+			return &ValidationError{Violations: collect(vErr, nil)}
+		}
+		return err
+	}
+	return nil
+}
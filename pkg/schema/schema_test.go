@@ -0,0 +1,81 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+func TestValidEmblemProto(t *testing.T) {
+	proto := `{"ver":"v1","iss":"https://example.com","assets":["*.example.com","[192.0.2.0/24]"],"emb":{"prp":["protective"],"dst":["dns","udp"]}}`
+	if err := ValidateProto(consts.EmblemCty, []byte(proto)); err != nil {
+		t.Fatalf("expected valid proto, got %v", err)
+	}
+}
+
+func TestValidEndorsementProto(t *testing.T) {
+	proto := `{"ver":"v1","iss":"https://authority.example","sub":"https://example.com","end":true,"emb":{"wnd":3600}}`
+	if err := ValidateProto(consts.EndorsementCty, []byte(proto)); err != nil {
+		t.Fatalf("expected valid proto, got %v", err)
+	}
+}
+
+func TestInvalidProtoPaths(t *testing.T) {
+	proto := `{"ver":"v1","asset":["example.com"],"emb":{"prp":"protective"}}`
+	err := ValidateProto(consts.EmblemCty, []byte(proto))
+	var vErr *ValidationError
+	if !errors.As(err, &vErr) {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+
+	joined := strings.Join(vErr.Violations, "\n")
+	for _, expected := range []string{"/emb/prp", "'asset'", "'assets'"} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("expected violations to mention %s, got:\n%s", expected, joined)
+		}
+	}
+}
+
+func TestClaimExtensionsExempt(t *testing.T) {
+	proto := []byte(`{"ver":"v1","assets":["example.com"],"contact":"mailto:noc@example.com"}`)
+	if err := ValidateProto(consts.EmblemCty, proto); err == nil {
+		t.Fatalf("expected unregistered claim to be rejected")
+	} else if err := tokens.RegisterClaim(tokens.ClaimExtension{Name: "contact"}); err != nil {
+		t.Fatalf("register claim: %v", err)
+	}
+	t.Cleanup(func() { tokens.UnregisterClaim("contact") })
+	if err := ValidateProto(consts.EmblemCty, proto); err != nil {
+		t.Fatalf("expected registered claim to be exempt, got %v", err)
+	}
+}
+
+type anyConstraint struct{}
+
+func (anyConstraint) Check(jwt.Token) error {
+	return nil
+}
+
+func TestConstraintExtensionsExempt(t *testing.T) {
+	typo := []byte(`{"ver":"v1","emb":{"maxasset":2}}`)
+	if err := ValidateProto(consts.EndorsementCty, typo); err == nil {
+		t.Fatalf("expected unknown constraint to be rejected")
+	}
+
+	proto := []byte(`{"ver":"v1","emb":{"x-region":"eu","crit":["x-region"]}}`)
+	if err := ValidateProto(consts.EndorsementCty, proto); err == nil {
+		t.Fatalf("expected unregistered constraint to be rejected")
+	} else if err := tokens.RegisterConstraint("x-region", func(json.RawMessage) (tokens.Constraint, error) { return anyConstraint{}, nil }); err != nil {
+		t.Fatalf("register constraint: %v", err)
+	}
+	t.Cleanup(func() { tokens.UnregisterConstraint("x-region") })
+	if err := ValidateProto(consts.EndorsementCty, proto); err != nil {
+		t.Fatalf("expected registered constraint to be exempt, got %v", err)
+	} else if err := ValidateProto(consts.EndorsementCty, []byte(`{"ver":"v1","emb":{"maxassets":-1}}`)); err == nil {
+		t.Fatalf("expected known constraints to be validated")
+	}
+}
@@ -0,0 +1,277 @@
+package signer
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/cose"
+	"github.com/adem-wg/adem-proto/pkg/gen"
+	"github.com/adem-wg/adem-proto/pkg/tokenlog"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var ErrUnknownOp = errors.New("unknown operation")
+var ErrNoKeys = errors.New("signer holds no keys")
+var ErrAmbiguousKey = errors.New("signer holds several keys; request one by kid")
+var ErrIllegalMessage = errors.New("message is no JWS signing input or COSE Sig_structure")
+var ErrAlgMismatch = errors.New("algorithm of key and message do not match")
+
+// Policy decides whether the key with the given KID may sign the requested
+// token. Returning an error refuses the request.
+type Policy func(kid string, req *gen.SigningRequest) error
+
+// Entry of the audit log. Every sign request is logged, including refused
+// ones.
+type AuditEntry struct {
+	Time   time.Time     `json:"time"`
+	Kid    string        `json:"kid,omitempty"`
+	Alg    string        `json:"alg,omitempty"`
+	Format consts.Format `json:"format,omitempty"`
+	Cty    consts.CTY    `json:"cty,omitempty"`
+	Claims jwt.Token     `json:"claims,omitempty"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// Server side of the remote signer protocol.
+type Server struct {
+	signers   map[string]crypto.Signer
+	pubs      map[string]jwk.Key
+	policy    Policy
+	audit     io.Writer
+	auditLock sync.Mutex
+	tokenLog  *tokenlog.Log
+}
+
+// Create a server signing with the given private keys. Keys without algorithm
+// are assigned the algorithm matching their key type. Requests are checked
+// against policy, if not nil, and logged to audit as JSON lines.
+func NewServer(keys jwk.Set, policy Policy, audit io.Writer) (*Server, error) {
+	if keys.Len() == 0 {
+		return nil, ErrNoKeys
+	}
+
+	s := &Server{
+		signers: make(map[string]crypto.Signer, keys.Len()),
+		pubs:    make(map[string]jwk.Key, keys.Len()),
+		policy:  policy,
+		audit:   audit,
+	}
+	for i := range keys.Len() {
+		var raw any
+		if k, ok := keys.Key(i); !ok {
+			return nil, fmt.Errorf("could not access key at index %d", i)
+		} else if err := tokens.SetAlg(k, jwa.NoSignature()); err != nil {
+			return nil, err
+		} else if pub, err := k.PublicKey(); err != nil {
+			return nil, err
+		} else if kid, err := tokens.SetKID(pub, true); err != nil {
+			return nil, err
+		} else if err := jwk.Export(k, &raw); err != nil {
+			return nil, err
+		} else if signer, ok := raw.(crypto.Signer); !ok {
+			return nil, gen.ErrNoSigner
+		} else {
+			s.signers[kid] = signer
+			s.pubs[kid] = pub
+		}
+	}
+	return s, nil
+}
+
+// Return the KIDs of the server's keys.
+func (s *Server) KIDs() []string {
+	kids := make([]string, 0, len(s.pubs))
+	for kid := range s.pubs {
+		kids = append(kids, kid)
+	}
+	return kids
+}
+
+// Append the messages of all signed requests to the given token log. Signatures
+// are withheld if a message cannot be logged.
+func (s *Server) LogTo(l *tokenlog.Log) {
+	s.tokenLog = l
+}
+
+// Accept connections and answer their requests until the listener fails.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		var req Request
+		if err := dec.Decode(&req); err != nil {
+			if !errors.Is(err, io.EOF) {
+				enc.Encode(&Response{Error: err.Error()})
+			}
+			return
+		} else if err := enc.Encode(s.respond(&req)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) respond(req *Request) *Response {
+	switch req.Op {
+	case OpKey:
+		if kid, err := s.selectKid(req.Kid); err != nil {
+			return &Response{Error: err.Error()}
+		} else if bs, err := json.Marshal(s.pubs[kid]); err != nil {
+			return &Response{Error: err.Error()}
+		} else {
+			return &Response{Key: bs}
+		}
+	case OpSign:
+		if sig, err := s.sign(req); err != nil {
+			return &Response{Error: err.Error()}
+		} else {
+			return &Response{Signature: sig}
+		}
+	default:
+		return &Response{Error: fmt.Sprintf("%s: %s", ErrUnknownOp, req.Op)}
+	}
+}
+
+func (s *Server) selectKid(kid string) (string, error) {
+	if kid != "" {
+		if _, ok := s.pubs[kid]; !ok {
+			return "", fmt.Errorf("%w: %s", tokens.ErrKeyNotFound, kid)
+		}
+		return kid, nil
+	} else if len(s.pubs) > 1 {
+		return "", ErrAmbiguousKey
+	}
+	for kid := range s.pubs {
+		return kid, nil
+	}
+	return "", ErrNoKeys
+}
+
+// Sign the requested message and log the request. The signature is
+// ASN.1-encoded for ECDSA keys (see [crypto.Signer]).
+func (s *Server) sign(req *Request) (sig []byte, err error) {
+	entry := AuditEntry{Time: time.Now().UTC(), Kid: req.Kid, Format: req.Format}
+	defer func() {
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		s.log(&entry)
+	}()
+
+	kid, err := s.selectKid(req.Kid)
+	if err != nil {
+		return nil, err
+	}
+	entry.Kid = kid
+
+	signReq, err := ParseMessage(req.Format, req.Message)
+	if err != nil {
+		return nil, err
+	}
+	entry.Alg = signReq.Alg.String()
+	entry.Cty = signReq.Cty
+	entry.Claims = signReq.Claims
+
+	if keyAlg, ok := s.pubs[kid].Algorithm(); !ok || keyAlg.String() != signReq.Alg.String() {
+		return nil, ErrAlgMismatch
+	} else if s.policy != nil {
+		if err := s.policy(kid, signReq); err != nil {
+			return nil, err
+		}
+	}
+
+	digest := signReq.Message
+	if hash := signReq.HashFunc(); hash != 0 {
+		h := hash.New()
+		h.Write(signReq.Message)
+		digest = h.Sum(nil)
+	}
+	if sig, err := s.signers[kid].Sign(rand.Reader, digest, signReq.HashFunc()); err != nil {
+		return nil, err
+	} else if s.tokenLog == nil {
+		return sig, nil
+	} else if _, err := s.tokenLog.Append(signReq.Message); err != nil {
+		return nil, fmt.Errorf("could not log token: %w", err)
+	} else {
+		return sig, nil
+	}
+}
+
+func (s *Server) log(entry *AuditEntry) {
+	if s.audit == nil {
+		return
+	}
+	s.auditLock.Lock()
+	defer s.auditLock.Unlock()
+	json.NewEncoder(s.audit).Encode(entry)
+}
+
+// Parse the message of a sign request, i.e., the JWS signing input or the
+// COSE Sig_structure of a token. Returns the request as the token's signer
+// would see it. Claims are neither verified nor validated.
+func ParseMessage(format consts.Format, msg []byte) (*gen.SigningRequest, error) {
+	req := &gen.SigningRequest{Format: format, Message: msg}
+	switch format {
+	case consts.FormatJWS:
+		parts := bytes.Split(msg, []byte("."))
+		if len(parts) != 2 {
+			return nil, ErrIllegalMessage
+		}
+
+		headers := jws.NewHeaders()
+		if hdrs, err := base64.RawURLEncoding.DecodeString(string(parts[0])); err != nil {
+			return nil, err
+		} else if err := json.Unmarshal(hdrs, headers); err != nil {
+			return nil, err
+		} else if payload, err := base64.RawURLEncoding.DecodeString(string(parts[1])); err != nil {
+			return nil, err
+		} else if claims, err := jwt.Parse(payload, jwt.WithVerify(false), jwt.WithValidate(false)); err != nil {
+			return nil, err
+		} else {
+			req.Alg, _ = headers.Algorithm()
+			cty, _ := headers.ContentType()
+			req.Cty = consts.CTY(cty)
+			req.Claims = claims
+		}
+	case consts.FormatCOSE:
+		if m, err := cose.ParseToBeSigned(msg); err != nil {
+			return nil, err
+		} else if alg, err := m.Algorithm(); err != nil {
+			return nil, err
+		} else if claims, err := m.Claims(); err != nil {
+			return nil, err
+		} else {
+			cty, _ := m.ContentType()
+			req.Alg = alg
+			req.Cty = consts.CTY(cty)
+			req.Claims = claims
+		}
+	default:
+		return nil, ErrIllegalMessage
+	}
+	return req, nil
+}
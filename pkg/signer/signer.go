@@ -0,0 +1,121 @@
+/*
+This package implements a remote signer protocol over Unix sockets. It lets
+root keys live in a separate, hardened process (or a bridge to an HSM) while
+tokens are generated elsewhere. Clients send newline-delimited JSON requests
+and receive one JSON response per request.
+
+There are two operations. "key" returns the signer's public key as JWK.
+"sign" signs a message, i.e., the JWS signing input or COSE Sig_structure of a
+token. As these embed the token's headers and claims, the server extracts
+what it is asked to sign from the message itself and can enforce its own
+policy and keep an audit log.
+*/
+package signer
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/gen"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/cert"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+var ErrNoRequest = errors.New("remote signers only sign tokens")
+
+const OpKey = "key"
+const OpSign = "sign"
+
+type Request struct {
+	Op string `json:"op"`
+	// KID of the key to use; may be omitted if the signer holds a single key.
+	Kid     string        `json:"kid,omitempty"`
+	Format  consts.Format `json:"format,omitempty"`
+	Message []byte        `json:"message,omitempty"`
+}
+
+type Response struct {
+	Key       json.RawMessage `json:"key,omitempty"`
+	Signature []byte          `json:"signature,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// Client of a remote signer. Implements [gen.Signer].
+type Client struct {
+	socket string
+	kid    string
+	pub    jwk.Key
+}
+
+// Connect to the remote signer listening on the given Unix socket and fetch
+// the public key with the given KID. The KID may be empty if the signer holds
+// a single key.
+func Dial(socket string, kid string) (*Client, error) {
+	c := &Client{socket: socket, kid: kid}
+	if resp, err := c.roundTrip(&Request{Op: OpKey, Kid: kid}); err != nil {
+		return nil, err
+	} else if pub, err := jwk.ParseKey(resp.Key); err != nil {
+		return nil, err
+	} else if kid, err := tokens.GetKID(pub); err != nil {
+		return nil, err
+	} else {
+		c.kid = kid
+		c.pub = pub
+		return c, nil
+	}
+}
+
+// Attach a certificate chain to the signer's public key (see
+// [tokens.SetX5C]).
+func (c *Client) SetX5C(chain *cert.Chain) error {
+	return tokens.SetX5C(c.pub, chain)
+}
+
+func (c *Client) PublicKey() (jwk.Key, error) {
+	return c.pub.PublicKey()
+}
+
+func (c *Client) Public() crypto.PublicKey {
+	var raw any
+	if err := jwk.Export(c.pub, &raw); err != nil {
+		return nil
+	}
+	return raw
+}
+
+// Sign the message of the given [*gen.SigningRequest]. Signing bare digests
+// is refused, as the remote signer could not know what it signs. The digest is
+// recalculated remotely.
+func (c *Client) Sign(_ io.Reader, _ []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if req, ok := opts.(*gen.SigningRequest); !ok {
+		return nil, ErrNoRequest
+	} else if resp, err := c.roundTrip(&Request{Op: OpSign, Kid: c.kid, Format: req.Format, Message: req.Message}); err != nil {
+		return nil, err
+	} else {
+		return resp.Signature, nil
+	}
+}
+
+func (c *Client) roundTrip(req *Request) (*Response, error) {
+	conn, err := net.Dial("unix", c.socket)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var resp Response
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return nil, err
+	} else if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, err
+	} else if resp.Error != "" {
+		return nil, fmt.Errorf("remote signer: %s", resp.Error)
+	}
+	return &resp, nil
+}
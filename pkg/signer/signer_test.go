@@ -0,0 +1,130 @@
+package signer
+
+import (
+	"bytes"
+	"crypto"
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/cose"
+	"github.com/adem-wg/adem-proto/pkg/gen"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var errRefused = errors.New("refused")
+
+// Start a server for a fresh key of the given algorithm. Returns the client
+// and the server's audit log.
+func mkSigner(t *testing.T, alg jwa.SignatureAlgorithm, policy Policy) (*Client, *bytes.Buffer) {
+	t.Helper()
+	key, err := tokens.GenerateKey(alg)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	set := jwk.NewSet()
+	set.AddKey(key)
+
+	audit := &bytes.Buffer{}
+	server, err := NewServer(set, policy, audit)
+	if err != nil {
+		t.Fatalf("new server: %v", err)
+	}
+	socket := filepath.Join(t.TempDir(), "signer.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go server.Serve(l)
+
+	client, err := Dial(socket, "")
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	return client, audit
+}
+
+func mkProto(t *testing.T) jwt.Token {
+	t.Helper()
+	proto := jwt.New()
+	if err := proto.Set("ver", string(consts.V1)); err != nil {
+		t.Fatalf("set ver: %v", err)
+	} else if err := proto.Set("assets", []string{"example.com"}); err != nil {
+		t.Fatalf("set assets: %v", err)
+	}
+	return proto
+}
+
+func TestRemoteSign(t *testing.T) {
+	for _, alg := range []jwa.SignatureAlgorithm{jwa.ES256(), jwa.ES512(), jwa.EdDSA()} {
+		client, audit := mkSigner(t, alg, nil)
+		pk, err := client.PublicKey()
+		if err != nil {
+			t.Fatalf("public key: %v", err)
+		}
+
+		if _, compact, err := gen.SignEmblem(client, false, alg, mkProto(t), 60); err != nil {
+			t.Errorf("%s: sign JWS: %v", alg, err)
+		} else if _, err := jws.Verify(compact, jws.WithKey(alg, pk)); err != nil {
+			t.Errorf("%s: verify JWS: %v", alg, err)
+		}
+
+		if _, signed, err := gen.SignEmblemCOSE(client, alg, mkProto(t), 60); err != nil {
+			t.Errorf("%s: sign COSE: %v", alg, err)
+		} else if msg, err := cose.Parse(signed); err != nil {
+			t.Errorf("%s: parse COSE: %v", alg, err)
+		} else if err := msg.Verify(pk); err != nil {
+			t.Errorf("%s: verify COSE: %v", alg, err)
+		}
+
+		if lines := strings.Count(audit.String(), "\n"); lines != 2 {
+			t.Errorf("%s: expected 2 audit entries, got %d", alg, lines)
+		}
+	}
+}
+
+func TestRemoteSignPolicy(t *testing.T) {
+	policy := func(kid string, req *gen.SigningRequest) error {
+		if req.Cty != consts.EmblemCty {
+			return errRefused
+		} else if !req.Claims.Has("assets") {
+			return errRefused
+		}
+		return nil
+	}
+	client, audit := mkSigner(t, jwa.ES256(), policy)
+
+	if _, _, err := gen.SignEmblem(client, false, jwa.ES256(), mkProto(t), 60); err != nil {
+		t.Errorf("sign emblem: %v", err)
+	}
+
+	endorsed, err := tokens.GenerateKey(jwa.ES256())
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	if _, _, err := gen.SignEndorsement(client, false, jwa.ES256(), jwt.New(), endorsed, jwa.ES256(), false, 60); err == nil {
+		t.Error("policy should refuse endorsements")
+	}
+
+	lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 audit entries, got %d", len(lines))
+	} else if !strings.Contains(lines[1], `"cty":"adem-end"`) || !strings.Contains(lines[1], errRefused.Error()) {
+		t.Errorf("unexpected audit entry: %s", lines[1])
+	}
+}
+
+func TestSignBareDigest(t *testing.T) {
+	client, _ := mkSigner(t, jwa.ES256(), nil)
+	if _, err := client.Sign(nil, make([]byte, 32), crypto.SHA256); err == nil {
+		t.Error("remote signer should refuse bare digests")
+	}
+}
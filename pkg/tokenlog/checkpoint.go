@@ -0,0 +1,81 @@
+package tokenlog
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/mod/sumdb/note"
+)
+
+var ErrIllegalCheckpoint = errors.New("illegal checkpoint")
+var ErrOriginMismatch = errors.New("checkpoint origin does not match the log's key name")
+
+// A log checkpoint (see [C2SP tlog-checkpoint]).
+//
+// [C2SP tlog-checkpoint]: https://c2sp.org/tlog-checkpoint
+type Checkpoint struct {
+	// Unique identifier of the log, e.g., "example.com/adem-log"
+	Origin string
+	Size   uint64
+	Root   []byte
+}
+
+func (c *Checkpoint) String() string {
+	return fmt.Sprintf("%s\n%d\n%s\n", c.Origin, c.Size, base64.StdEncoding.EncodeToString(c.Root))
+}
+
+func parseCheckpoint(text string) (*Checkpoint, error) {
+	lines := strings.SplitN(text, "\n", 4)
+	if len(lines) < 4 || lines[0] == "" {
+		return nil, ErrIllegalCheckpoint
+	} else if size, err := strconv.ParseUint(lines[1], 10, 64); err != nil {
+		return nil, ErrIllegalCheckpoint
+	} else if root, err := base64.StdEncoding.DecodeString(lines[2]); err != nil || len(root) != 32 {
+		return nil, ErrIllegalCheckpoint
+	} else {
+		return &Checkpoint{Origin: lines[0], Size: size, Root: root}, nil
+	}
+}
+
+// Generate a key pair to sign checkpoints with. The name is the log's origin.
+// Returns the encoded signer and verifier key (see [note.GenerateKey]).
+func GenerateKey(origin string) (string, string, error) {
+	return note.GenerateKey(rand.Reader, origin)
+}
+
+// Sign the checkpoint as note. The checkpoint's origin must match the key's
+// name.
+func signCheckpoint(c *Checkpoint, signer note.Signer) ([]byte, error) {
+	if c.Origin != signer.Name() {
+		return nil, ErrOriginMismatch
+	}
+	return note.Sign(&note.Note{Text: c.String()}, signer)
+}
+
+// Open a signed checkpoint and check its signature by the given verifier.
+func OpenCheckpoint(signed []byte, verifier note.Verifier) (*Checkpoint, error) {
+	if n, err := note.Open(signed, note.VerifierList(verifier)); err != nil {
+		return nil, err
+	} else if c, err := parseCheckpoint(n.Text); err != nil {
+		return nil, err
+	} else if c.Origin != verifier.Name() {
+		return nil, ErrOriginMismatch
+	} else {
+		return c, nil
+	}
+}
+
+// Read a checkpoint without checking its signature, e.g., of the log one
+// appends to.
+func readCheckpoint(signed []byte) (*Checkpoint, error) {
+	if i := bytes.Index(signed, []byte("\n\n")); i < 0 {
+		return nil, ErrIllegalCheckpoint
+	} else {
+		return parseCheckpoint(string(signed[:i+1]))
+	}
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package tokenlog
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Lock the log directory against concurrent appends by other processes.
+// Returns a function that releases the lock.
+func lockDir(dir string) (func(), error) {
+	f, err := os.OpenFile(filepath.Join(dir, ".lock"), os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	} else if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
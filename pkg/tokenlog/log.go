@@ -0,0 +1,168 @@
+package tokenlog
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/adem-wg/adem-proto/pkg/util"
+	"github.com/transparency-dev/merkle/compact"
+	"golang.org/x/mod/sumdb/note"
+)
+
+var ErrLogExists = errors.New("log already exists")
+
+// Log appends entries to a log stored in a local directory. Appends are
+// serialized, also across processes on Unix systems.
+type Log struct {
+	dir    string
+	signer note.Signer
+	lock   sync.Mutex
+}
+
+// Create an empty log in dir whose checkpoints are signed with skey (see
+// [GenerateKey]). The key's name is the log's origin.
+func Create(dir string, skey string) (*Log, error) {
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		return nil, err
+	} else if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	} else if _, err := os.Stat(filepath.Join(dir, checkpointPath)); err == nil {
+		return nil, ErrLogExists
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+
+	l := &Log{dir: dir, signer: signer}
+	cp := &Checkpoint{Origin: signer.Name(), Size: 0, Root: hasher.EmptyRoot()}
+	if err := l.writeCheckpoint(cp); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Open the log in dir to append to it. Checkpoints are signed with skey.
+func Open(dir string, skey string) (*Log, error) {
+	signer, err := note.NewSigner(skey)
+	if err != nil {
+		return nil, err
+	} else if signed, err := os.ReadFile(filepath.Join(dir, checkpointPath)); err != nil {
+		return nil, err
+	} else if cp, err := readCheckpoint(signed); err != nil {
+		return nil, err
+	} else if cp.Origin != signer.Name() {
+		return nil, ErrOriginMismatch
+	}
+	return &Log{dir: dir, signer: signer}, nil
+}
+
+func (l *Log) writeFile(path string, data []byte) error {
+	name := filepath.Join(l.dir, filepath.FromSlash(path))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+	return util.WriteFileAtomic(name, data, 0644)
+}
+
+func (l *Log) writeCheckpoint(cp *Checkpoint) error {
+	if signed, err := signCheckpoint(cp, l.signer); err != nil {
+		return err
+	} else {
+		return l.writeFile(checkpointPath, signed)
+	}
+}
+
+// Append entries to the log and publish a new checkpoint. Returns the index
+// of the first appended entry.
+func (l *Log) Append(entries ...[]byte) (uint64, error) {
+	for _, entry := range entries {
+		if len(entry) > 0xffff {
+			return 0, ErrEntryTooLarge
+		}
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	unlock, err := lockDir(l.dir)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	signed, err := os.ReadFile(filepath.Join(l.dir, checkpointPath))
+	if err != nil {
+		return 0, err
+	}
+	cp, err := readCheckpoint(signed)
+	if err != nil {
+		return 0, err
+	} else if cp.Origin != l.signer.Name() {
+		return 0, ErrOriginMismatch
+	}
+
+	// Tiles are only ever read for the current size
+	r := NewClient(DirFetcher(l.dir), nil)
+	oldSize := cp.Size
+	size := oldSize + uint64(len(entries))
+	hashes, err := r.leafHashes(0, oldSize, oldSize)
+	if err != nil {
+		return 0, err
+	}
+	for _, entry := range entries {
+		hashes = append(hashes, hasher.HashLeaf(entry))
+	}
+
+	// Rewrite the last, partial entry bundle and add new ones
+	start := oldSize - oldSize%tileWidth
+	bundled, err := r.Entries(start, oldSize, oldSize)
+	if err != nil {
+		return 0, err
+	}
+	bundled = append(bundled, entries...)
+	for index := start / tileWidth; index*tileWidth < size; index++ {
+		lo := index*tileWidth - start
+		hi := min(lo+tileWidth, size-start)
+		if err := l.writeFile(tilePath(entriesLevel, index, hi-lo), encodeBundle(bundled[lo:hi])); err != nil {
+			return 0, err
+		}
+	}
+
+	// Write the tiles that changed at every tile level
+	level := hashes
+	for tileLevel := 0; len(level) > 0; tileLevel++ {
+		oldWidth := oldSize >> (tileLevel * tileHeight)
+		levelSize := uint64(len(level))
+		for index := oldWidth / tileWidth; levelSize > oldWidth && index*tileWidth < levelSize; index++ {
+			width := tileWidthAt(index, levelSize)
+			tile := make([]byte, 0, width*32)
+			for _, h := range level[index*tileWidth : index*tileWidth+width] {
+				tile = append(tile, h...)
+			}
+			if err := l.writeFile(tilePath(strconv.Itoa(tileLevel), index, width), tile); err != nil {
+				return 0, err
+			}
+		}
+		for range tileHeight {
+			level = parents(level)
+		}
+	}
+
+	rf := &compact.RangeFactory{Hash: hasher.HashChildren}
+	rng := rf.NewEmptyRange(0)
+	for _, h := range hashes {
+		if err := rng.Append(h, nil); err != nil {
+			return 0, err
+		}
+	}
+	root := hasher.EmptyRoot()
+	if size > 0 {
+		if root, err = rng.GetRootHash(nil); err != nil {
+			return 0, err
+		}
+	}
+	return oldSize, l.writeCheckpoint(&Checkpoint{Origin: cp.Origin, Size: size, Root: root})
+}
@@ -0,0 +1,287 @@
+package tokenlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/transparency-dev/merkle/compact"
+	"github.com/transparency-dev/merkle/proof"
+	"github.com/transparency-dev/merkle/rfc6962"
+	"golang.org/x/mod/sumdb/note"
+)
+
+var ErrIllegalTile = errors.New("illegal tile")
+var ErrEntryNotFound = errors.New("entry not found in log")
+
+// Tiles hold 2^8 hashes or entries.
+const tileHeight = 8
+const tileWidth = 1 << tileHeight
+
+const checkpointPath = "checkpoint"
+const entriesLevel = "entries"
+
+var hasher = rfc6962.DefaultHasher
+
+// Path of a tile, e.g., "tile/0/x001/x234/067.p/8" for the partial tile of
+// width 8 with index 1234067 at level 0.
+func tilePath(level string, index uint64, width uint64) string {
+	n := fmt.Sprintf("%03d", index%1000)
+	for index >= 1000 {
+		index /= 1000
+		n = fmt.Sprintf("x%03d/%s", index%1000, n)
+	}
+	path := "tile/" + level + "/" + n
+	if width < tileWidth {
+		path += fmt.Sprintf(".p/%d", width)
+	}
+	return path
+}
+
+// Fetcher retrieves files of a log's static layout by their path, e.g.,
+// "checkpoint".
+type Fetcher func(path string) ([]byte, error)
+
+// Fetch log files from a local directory.
+func DirFetcher(dir string) Fetcher {
+	return func(path string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+	}
+}
+
+// Fetch log files from a web server. If client is nil, http.DefaultClient is
+// used.
+func HTTPFetcher(baseURL string, client *http.Client) Fetcher {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	return func(path string) ([]byte, error) {
+		resp, err := client.Get(baseURL + "/" + path)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("could not fetch %s: %s", path, resp.Status)
+		}
+		return io.ReadAll(resp.Body)
+	}
+}
+
+// Client reads a log, e.g., to prove inclusion of entries or consistency of
+// checkpoints.
+type Client struct {
+	fetch    Fetcher
+	verifier note.Verifier
+	tiles    map[string][]byte
+}
+
+// Create a client of a log whose checkpoints are signed by verifier's key.
+func NewClient(fetch Fetcher, verifier note.Verifier) *Client {
+	return &Client{fetch: fetch, verifier: verifier, tiles: make(map[string][]byte)}
+}
+
+// Fetch and open the log's latest checkpoint. Returns the checkpoint and its
+// signed note.
+func (c *Client) Checkpoint() (*Checkpoint, []byte, error) {
+	if signed, err := c.fetch(checkpointPath); err != nil {
+		return nil, nil, err
+	} else if cp, err := OpenCheckpoint(signed, c.verifier); err != nil {
+		return nil, nil, err
+	} else {
+		return cp, signed, nil
+	}
+}
+
+// Return the verifier of the log's checkpoints.
+func (c *Client) Verifier() note.Verifier {
+	return c.verifier
+}
+
+func (c *Client) tile(level string, index uint64, width uint64) ([]byte, error) {
+	path := tilePath(level, index, width)
+	if tile, ok := c.tiles[path]; ok {
+		return tile, nil
+	} else if tile, err := c.fetch(path); err != nil {
+		return nil, err
+	} else {
+		c.tiles[path] = tile
+		return tile, nil
+	}
+}
+
+// Width of the tile with the given index at a tree level of the given size.
+func tileWidthAt(index uint64, levelSize uint64) uint64 {
+	return min(tileWidth, levelSize-index*tileWidth)
+}
+
+// Return the hashes of tile index at the given tile level of a tree with size
+// leaves.
+func (c *Client) tileHashes(level int, index uint64, size uint64) ([][]byte, error) {
+	width := tileWidthAt(index, size>>(level*tileHeight))
+	tile, err := c.tile(strconv.Itoa(level), index, width)
+	if err != nil {
+		return nil, err
+	} else if uint64(len(tile)) != width*32 {
+		return nil, fmt.Errorf("%w: %s", ErrIllegalTile, tilePath(strconv.Itoa(level), index, width))
+	}
+
+	hashes := make([][]byte, width)
+	for i := range hashes {
+		hashes[i] = tile[i*32 : (i+1)*32]
+	}
+	return hashes, nil
+}
+
+// Return the hashes of the leaves in [start, end) of a tree with size leaves.
+func (c *Client) leafHashes(start, end, size uint64) ([][]byte, error) {
+	hashes := [][]byte{}
+	for index := start / tileWidth; index*tileWidth < end; index++ {
+		tile, err := c.tileHashes(0, index, size)
+		if err != nil {
+			return nil, err
+		}
+		lo := max(start, index*tileWidth) - index*tileWidth
+		hi := min(end, index*tileWidth+uint64(len(tile))) - index*tileWidth
+		hashes = append(hashes, tile[lo:hi]...)
+	}
+	return hashes, nil
+}
+
+// Return the hash of a perfect subtree of a tree with size leaves. Nodes at
+// levels between tile levels are hashed from the tile below.
+func (c *Client) nodeHash(id compact.NodeID, size uint64) ([]byte, error) {
+	level := int(id.Level / tileHeight)
+	rest := id.Level % tileHeight
+	first := id.Index << rest
+	tile, err := c.tileHashes(level, first/tileWidth, size)
+	if err != nil {
+		return nil, err
+	}
+
+	lo := first % tileWidth
+	hi := lo + 1<<rest
+	if hi > uint64(len(tile)) {
+		return nil, fmt.Errorf("%w: node %d at level %d not in tile", ErrIllegalTile, id.Index, id.Level)
+	}
+	hashes := tile[lo:hi]
+	for len(hashes) > 1 {
+		hashes = parents(hashes)
+	}
+	return hashes[0], nil
+}
+
+// Hash pairs of nodes to their parents. An unpaired last node is dropped.
+func parents(hashes [][]byte) [][]byte {
+	ps := make([][]byte, 0, len(hashes)/2)
+	for i := 0; i+1 < len(hashes); i += 2 {
+		ps = append(ps, hasher.HashChildren(hashes[i], hashes[i+1]))
+	}
+	return ps
+}
+
+func (c *Client) proof(nodes proof.Nodes, size uint64) ([][]byte, error) {
+	hashes := make([][]byte, 0, len(nodes.IDs))
+	for _, id := range nodes.IDs {
+		if h, err := c.nodeHash(id, size); err != nil {
+			return nil, err
+		} else {
+			hashes = append(hashes, h)
+		}
+	}
+	return nodes.Rehash(hashes, hasher.HashChildren)
+}
+
+// Prove that entry is the index-th entry of the log at the given checkpoint.
+func (c *Client) ProveInclusion(index uint64, entry []byte, cp *Checkpoint) error {
+	if nodes, err := proof.Inclusion(index, cp.Size); err != nil {
+		return err
+	} else if p, err := c.proof(nodes, cp.Size); err != nil {
+		return err
+	} else {
+		return proof.VerifyInclusion(hasher, index, cp.Size, hasher.HashLeaf(entry), p, cp.Root)
+	}
+}
+
+// Prove that the log at checkpoint cp extends the log at checkpoint old.
+func (c *Client) ProveConsistency(old *Checkpoint, cp *Checkpoint) error {
+	if old.Origin != cp.Origin {
+		return ErrOriginMismatch
+	} else if nodes, err := proof.Consistency(old.Size, cp.Size); err != nil {
+		return err
+	} else if p, err := c.proof(nodes, cp.Size); err != nil {
+		return err
+	} else {
+		return proof.VerifyConsistency(hasher, old.Size, cp.Size, p, old.Root, cp.Root)
+	}
+}
+
+func parseBundle(bundle []byte) ([][]byte, error) {
+	entries := [][]byte{}
+	for len(bundle) > 0 {
+		if len(bundle) < 2 {
+			return nil, ErrIllegalTile
+		}
+		n := int(binary.BigEndian.Uint16(bundle))
+		if len(bundle) < 2+n {
+			return nil, ErrIllegalTile
+		}
+		entries = append(entries, bundle[2:2+n])
+		bundle = bundle[2+n:]
+	}
+	return entries, nil
+}
+
+func encodeBundle(entries [][]byte) []byte {
+	var buf bytes.Buffer
+	for _, entry := range entries {
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(len(entry))))
+		buf.Write(entry)
+	}
+	return buf.Bytes()
+}
+
+// Return the entries in [start, end) of a log with size entries.
+func (c *Client) Entries(start, end, size uint64) ([][]byte, error) {
+	entries := [][]byte{}
+	for index := start / tileWidth; index*tileWidth < end; index++ {
+		width := tileWidthAt(index, size)
+		if bundle, err := c.tile(entriesLevel, index, width); err != nil {
+			return nil, err
+		} else if tile, err := parseBundle(bundle); err != nil {
+			return nil, err
+		} else if uint64(len(tile)) != width {
+			return nil, fmt.Errorf("%w: %s", ErrIllegalTile, tilePath(entriesLevel, index, width))
+		} else {
+			lo := max(start, index*tileWidth) - index*tileWidth
+			hi := min(end, index*tileWidth+width) - index*tileWidth
+			entries = append(entries, tile[lo:hi]...)
+		}
+	}
+	return entries, nil
+}
+
+// Return the index of the first occurrence of entry in the log at the given
+// checkpoint.
+func (c *Client) FindEntry(entry []byte, cp *Checkpoint) (uint64, error) {
+	for start := uint64(0); start < cp.Size; start += tileWidth {
+		entries, err := c.Entries(start, min(start+tileWidth, cp.Size), cp.Size)
+		if err != nil {
+			return 0, err
+		}
+		for i, e := range entries {
+			if bytes.Equal(e, entry) {
+				return start + uint64(i), nil
+			}
+		}
+	}
+	return 0, ErrEntryNotFound
+}
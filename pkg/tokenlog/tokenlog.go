@@ -0,0 +1,73 @@
+/*
+This package implements a transparency log of the tokens an issuer signs. The
+log is an append-only Merkle tree with RFC 6962 hashing, stored in the static
+tlog layout (see [C2SP tlog-tiles]): a signed checkpoint, hash tiles, and entry
+bundles. Any static web server can serve the log to third parties, who monitor
+it for tokens the issuer should not have signed, e.g., emblems for assets the
+issuer does not own.
+
+Entries are the bytes that a token's signature covers, i.e., the JWS signing
+input or the COSE Sig_structure. They embed the token's headers and claims but
+not its signature. Hence, tools that output tokens and remote signers that only
+see what they sign log the same entries, and monitors can decode entries with
+[signer.ParseMessage].
+
+Checkpoints are signed notes (see [C2SP signed-note]) that commit to the log's
+size and root hash.
+
+[C2SP tlog-tiles]: https://c2sp.org/tlog-tiles
+[C2SP signed-note]: https://c2sp.org/signed-note
+*/
+package tokenlog
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/cose"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+)
+
+var ErrIllegalToken = errors.New("token is neither a JWS nor a COSE_Sign1 message")
+var ErrEntryTooLarge = errors.New("log entries must not exceed 65535 bytes")
+
+// Return the log entries of a token, one per signature. Tokens in JWS JSON
+// serialization may carry several signatures, e.g., co-signed endorsements;
+// entries are returned in the order of the signatures.
+func Entries(token []byte) ([][]byte, error) {
+	token = bytes.TrimSpace(token)
+	if cose.IsCOSE(token) {
+		if msg, err := cose.Parse(token); err != nil {
+			return nil, err
+		} else if entry, err := msg.ToBeSigned(); err != nil {
+			return nil, err
+		} else {
+			return [][]byte{entry}, nil
+		}
+	}
+
+	general, err := tokens.ParseGeneralJWS(token)
+	if err != nil {
+		return nil, err
+	}
+	entries := [][]byte{}
+	for _, compact := range general.Compact() {
+		if i := bytes.LastIndexByte(compact, '.'); i < 0 {
+			return nil, ErrIllegalToken
+		} else {
+			entries = append(entries, compact[:i])
+		}
+	}
+	return entries, nil
+}
+
+// Return the encoding of the token an entry was taken from. COSE
+// Sig_structures are CBOR arrays of four elements, whereas JWS signing inputs
+// are base64url-encoded text.
+func EntryFormat(entry []byte) consts.Format {
+	if len(entry) > 0 && entry[0] == 0x84 {
+		return consts.FormatCOSE
+	}
+	return consts.FormatJWS
+}
@@ -0,0 +1,151 @@
+package tokenlog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"golang.org/x/mod/sumdb/note"
+)
+
+func TestTilePath(t *testing.T) {
+	cases := map[string]string{
+		tilePath("0", 0, tileWidth):       "tile/0/000",
+		tilePath("1", 67, 8):              "tile/1/067.p/8",
+		tilePath("0", 1234067, tileWidth): "tile/0/x001/x234/067",
+		tilePath(entriesLevel, 1000, 1):   "tile/entries/x001/000.p/1",
+	}
+	for got, expected := range cases {
+		if got != expected {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	}
+}
+
+// Reference root hash following RFC 6962, Section 2.1.
+func referenceRoot(entries [][]byte) []byte {
+	if len(entries) == 0 {
+		return hasher.EmptyRoot()
+	} else if len(entries) == 1 {
+		return hasher.HashLeaf(entries[0])
+	}
+	k := 1
+	for k*2 < len(entries) {
+		k *= 2
+	}
+	return hasher.HashChildren(referenceRoot(entries[:k]), referenceRoot(entries[k:]))
+}
+
+func testLog(t *testing.T) (*Log, note.Verifier) {
+	skey, vkey, err := GenerateKey("example.com/log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier, err := note.NewVerifier(vkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	l, err := Create(dir, skey)
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := Create(dir, skey); !errors.Is(err, ErrLogExists) {
+		t.Fatalf("expected ErrLogExists, got %v", err)
+	}
+	return l, verifier
+}
+
+func TestLog(t *testing.T) {
+	l, verifier := testLog(t)
+	entries := [][]byte{}
+	checkpoints := []*Checkpoint{}
+	for _, n := range []int{0, 1, 3, 252, 1, 300, 256, 66000} {
+		batch := [][]byte{}
+		for range n {
+			batch = append(batch, fmt.Appendf(nil, "entry %d", len(entries)+len(batch)))
+		}
+		if index, err := l.Append(batch...); err != nil {
+			t.Fatalf("could not append: %s", err)
+		} else if index != uint64(len(entries)) {
+			t.Fatalf("expected index %d, got %d", len(entries), index)
+		}
+		entries = append(entries, batch...)
+
+		c := NewClient(DirFetcher(l.dir), verifier)
+		cp, _, err := c.Checkpoint()
+		if err != nil {
+			t.Fatal(err)
+		} else if cp.Size != uint64(len(entries)) {
+			t.Fatalf("expected size %d, got %d", len(entries), cp.Size)
+		} else if !bytes.Equal(cp.Root, referenceRoot(entries)) {
+			t.Fatalf("unexpected root at size %d", cp.Size)
+		}
+
+		for _, i := range []uint64{0, cp.Size / 2, cp.Size - 1} {
+			if cp.Size == 0 {
+				break
+			} else if err := c.ProveInclusion(i, entries[i], cp); err != nil {
+				t.Fatalf("could not prove inclusion of %d at size %d: %s", i, cp.Size, err)
+			} else if err := c.ProveInclusion(i, []byte("forged"), cp); err == nil {
+				t.Fatalf("proved inclusion of forged entry")
+			}
+		}
+		for _, old := range checkpoints {
+			if old.Size == 0 {
+				continue
+			} else if err := c.ProveConsistency(old, cp); err != nil {
+				t.Fatalf("could not prove consistency of %d and %d: %s", old.Size, cp.Size, err)
+			}
+		}
+		checkpoints = append(checkpoints, cp)
+	}
+
+	c := NewClient(DirFetcher(l.dir), verifier)
+	cp, _, err := c.Checkpoint()
+	if err != nil {
+		t.Fatal(err)
+	} else if got, err := c.Entries(250, 600, cp.Size); err != nil {
+		t.Fatal(err)
+	} else if len(got) != 350 || !bytes.Equal(got[0], entries[250]) || !bytes.Equal(got[349], entries[599]) {
+		t.Fatalf("unexpected entries")
+	} else if i, err := c.FindEntry(entries[513], cp); err != nil || i != 513 {
+		t.Fatalf("expected entry 513, got %d (%v)", i, err)
+	} else if _, err := c.FindEntry([]byte("missing"), cp); !errors.Is(err, ErrEntryNotFound) {
+		t.Fatalf("expected ErrEntryNotFound, got %v", err)
+	}
+}
+
+func TestOpenCheckpoint(t *testing.T) {
+	l, verifier := testLog(t)
+	other, _ := testLog(t)
+	c := NewClient(DirFetcher(other.dir), verifier)
+	if _, _, err := c.Checkpoint(); err == nil {
+		t.Fatal("expected checkpoint signed by other key to be rejected")
+	}
+
+	skey, _, err := GenerateKey("example.com/other")
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := Open(l.dir, skey); !errors.Is(err, ErrOriginMismatch) {
+		t.Fatalf("expected ErrOriginMismatch, got %v", err)
+	}
+}
+
+func TestEntries(t *testing.T) {
+	token := []byte(`{"payload":"cGw","signatures":[{"protected":"aDE","signature":"c2ln"},{"protected":"aDI","signature":"c2ln"}]}`)
+	if entries, err := Entries(token); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 2 || string(entries[0]) != "aDE.cGw" || string(entries[1]) != "aDI.cGw" {
+		t.Fatalf("unexpected entries: %q", entries)
+	} else if EntryFormat(entries[0]) != consts.FormatJWS {
+		t.Fatal("expected JWS entry")
+	}
+
+	if entries, err := Entries([]byte("aDE.cGw.c2ln\n")); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 || string(entries[0]) != "aDE.cGw" {
+		t.Fatalf("unexpected entries: %q", entries)
+	}
+}
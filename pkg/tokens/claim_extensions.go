@@ -0,0 +1,171 @@
+package tokens
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var ErrClaimRegistered = errors.New("claim already registered")
+var ErrClaimUnregistered = errors.New("claim not registered")
+var ErrUnknownCriticalClaim = errors.New("unknown critical claim")
+var ErrCriticalClaimMissing = errors.New("critical claim missing")
+
+// Protected header listing the critical claim extensions of a JWS. The JWS
+// "crit" header may only list header parameters (see RFC 7515, Section
+// 4.1.11); signers list "adem-crit" itself in "crit" so that verifiers that do
+// not understand it reject the token.
+const CriticalHeader = "adem-crit"
+
+// Decode the "adem-crit" header as list of claim names.
+func init() {
+	jws.RegisterCustomField(CriticalHeader, []string{})
+}
+
+// Claims defined by ADEM or JWT. They cannot be registered as extensions.
+var reservedClaims = []string{
+	jwt.IssuerKey, jwt.SubjectKey, jwt.AudienceKey, jwt.ExpirationKey,
+	jwt.NotBeforeKey, jwt.IssuedAtKey, jwt.JwtIDKey,
+	"ver", "log", "key", "jwk", "assets", "emb", "end",
+}
+
+// ClaimExtension describes a custom claim of emblems or endorsements.
+type ClaimExtension struct {
+	Name string
+	// Value of the type that the claim is decoded into; see
+	// [jwt.RegisterCustomField]. If nil, the claim is decoded as generic JSON.
+	Type any
+	// Validate the decoded claim value. May be nil.
+	Validate func(value any) error
+	// If true, signers list the claim in the "adem-crit" header of tokens that
+	// contain it. Verifiers that do not understand the claim must then reject
+	// such tokens.
+	Critical bool
+}
+
+var claimsLock sync.RWMutex
+var claimRegistry = map[string]*ClaimExtension{}
+
+// Register a claim extension.
+func RegisterClaim(ext ClaimExtension) error {
+	claimsLock.Lock()
+	defer claimsLock.Unlock()
+
+	if _, ok := claimRegistry[ext.Name]; ok || slices.Contains(reservedClaims, ext.Name) {
+		return fmt.Errorf("%w: %s", ErrClaimRegistered, ext.Name)
+	}
+	if ext.Type != nil {
+		jwt.RegisterCustomField(ext.Name, ext.Type)
+	}
+	claimRegistry[ext.Name] = &ext
+	return nil
+}
+
+// Remove a claim extension, e.g., one registered by a test. The claim's type
+// stays registered with the JWT parser; registering the claim again replaces
+// it.
+func UnregisterClaim(name string) {
+	claimsLock.Lock()
+	defer claimsLock.Unlock()
+
+	delete(claimRegistry, name)
+}
+
+// Mark a registered claim extension as critical.
+func MarkCritical(name string) error {
+	claimsLock.Lock()
+	defer claimsLock.Unlock()
+
+	if ext, ok := claimRegistry[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrClaimUnregistered, name)
+	} else {
+		ext.Critical = true
+		return nil
+	}
+}
+
+// Check whether the given claim is a registered extension.
+func IsClaimExtension(name string) bool {
+	claimsLock.RLock()
+	defer claimsLock.RUnlock()
+
+	_, ok := claimRegistry[name]
+	return ok
+}
+
+// Return the registered extensions present in the given token.
+func presentExtensions(t jwt.Token) []*ClaimExtension {
+	claimsLock.RLock()
+	defer claimsLock.RUnlock()
+
+	present := []*ClaimExtension{}
+	for _, name := range t.Keys() {
+		if ext, ok := claimRegistry[name]; ok {
+			present = append(present, ext)
+		}
+	}
+	slices.SortFunc(present, func(a, b *ClaimExtension) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return present
+}
+
+// Return the names of critical claim extensions present in the given token.
+// Signers list them in the token's "adem-crit" header.
+func CriticalClaims(t jwt.Token) []string {
+	crit := []string{}
+	for _, ext := range presentExtensions(t) {
+		if ext.Critical {
+			crit = append(crit, ext.Name)
+		}
+	}
+	return crit
+}
+
+// Check that the verifier understands all claims that are marked critical,
+// and that all of them are present in the token.
+func CheckCritical(crit []string, t jwt.Token) error {
+	for _, name := range crit {
+		if !IsClaimExtension(name) {
+			return fmt.Errorf("%w: %s", ErrUnknownCriticalClaim, name)
+		} else if !t.Has(name) {
+			return fmt.Errorf("%w: %s", ErrCriticalClaimMissing, name)
+		}
+	}
+	return nil
+}
+
+// Return the values of all registered claim extensions in the given token by
+// name.
+func ExtensionClaims(t jwt.Token) map[string]any {
+	claims := map[string]any{}
+	for _, ext := range presentExtensions(t) {
+		var value any
+		if err := t.Get(ext.Name, &value); err == nil {
+			claims[ext.Name] = value
+		}
+	}
+	return claims
+}
+
+// Run the validators of all registered claim extensions in the given token.
+func validateClaimExtensions(t jwt.Token) error {
+	for _, ext := range presentExtensions(t) {
+		if ext.Validate == nil {
+			continue
+		}
+
+		var value any
+		if err := t.Get(ext.Name, &value); err != nil {
+			return err
+		} else if err := ext.Validate(value); err != nil {
+			return fmt.Errorf("invalid claim %q: %w", ext.Name, err)
+		}
+	}
+	return nil
+}
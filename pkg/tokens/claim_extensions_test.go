@@ -0,0 +1,81 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+type legalBasis struct {
+	Treaty  string `json:"treaty"`
+	Article int    `json:"article"`
+}
+
+var errNoTreaty = errors.New("treaty missing")
+
+func TestRegisterClaim(t *testing.T) {
+	if err := RegisterClaim(ClaimExtension{Name: "assets"}); !errors.Is(err, ErrClaimRegistered) {
+		t.Fatalf("expected reserved claim to be rejected, got %v", err)
+	} else if err := RegisterClaim(ClaimExtension{Name: "x-contact"}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	t.Cleanup(func() { UnregisterClaim("x-contact") })
+	if err := RegisterClaim(ClaimExtension{Name: "x-contact"}); !errors.Is(err, ErrClaimRegistered) {
+		t.Fatalf("expected duplicate registration to fail, got %v", err)
+	} else if err := MarkCritical("x-unknown"); !errors.Is(err, ErrClaimUnregistered) {
+		t.Fatalf("expected ErrClaimUnregistered, got %v", err)
+	}
+}
+
+func TestClaimExtensionValidation(t *testing.T) {
+	if err := RegisterClaim(ClaimExtension{
+		Name: "x-legal",
+		Type: legalBasis{},
+		Validate: func(value any) error {
+			if basis, ok := value.(legalBasis); !ok || basis.Treaty == "" {
+				return errNoTreaty
+			}
+			return nil
+		},
+		Critical: true,
+	}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	t.Cleanup(func() { UnregisterClaim("x-legal") })
+
+	parse := func(raw string) jwt.Token {
+		t.Helper()
+		if tok, err := jwt.Parse([]byte(raw), jwt.WithVerify(false), jwt.WithValidate(false)); err != nil {
+			t.Fatalf("parse: %v", err)
+			return nil
+		} else {
+			return tok
+		}
+	}
+
+	valid := parse(`{"ver":"` + string(consts.V1) + `","assets":["example.com"],"x-legal":{"treaty":"GC I","article":44}}`)
+	if err := jwt.Validate(valid, jwt.WithValidator(EmblemValidator)); err != nil {
+		t.Fatalf("expected emblem to validate, got %v", err)
+	} else if crit := CriticalClaims(valid); !slices.Equal(crit, []string{"x-legal"}) {
+		t.Fatalf("unexpected critical claims: %v", crit)
+	} else if claims := ExtensionClaims(valid); claims["x-legal"] != (legalBasis{"GC I", 44}) {
+		t.Fatalf("unexpected extension claims: %v", claims)
+	}
+
+	invalid := parse(`{"ver":"` + string(consts.V1) + `","assets":["example.com"],"x-legal":{"article":44}}`)
+	if err := EmblemValidator.Validate(context.Background(), invalid); !errors.Is(err, errNoTreaty) {
+		t.Fatalf("expected extension validator to fail, got %v", err)
+	}
+
+	if err := CheckCritical([]string{"x-legal"}, valid); err != nil {
+		t.Fatalf("expected known critical claim to be accepted, got %v", err)
+	} else if err := CheckCritical([]string{"x-other"}, valid); !errors.Is(err, ErrUnknownCriticalClaim) {
+		t.Fatalf("expected ErrUnknownCriticalClaim, got %v", err)
+	} else if err := CheckCritical([]string{"x-legal"}, parse(`{"ver":"v1"}`)); !errors.Is(err, ErrCriticalClaimMissing) {
+		t.Fatalf("expected ErrCriticalClaimMissing, got %v", err)
+	}
+}
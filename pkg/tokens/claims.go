@@ -17,13 +17,28 @@ import (
 type Log = []*LogConfig
 type Assets = []*ident.AI
 
-// Register JWT fields of emblems for easier parsing.
+// Register version v1 of ADEM. The "ver" claim is shared by all versions and
+// hence registered independently.
 func init() {
+	jwt.RegisterCustomField("ver", "")
+	if err := RegisterVersion(&VersionRules{
+		Version:              consts.V1,
+		RegisterClaims:       registerClaimsV1,
+		EmblemValidator:      emblemValidatorV1,
+		EndorsementValidator: endorsementValidatorV1,
+		ConstraintViolations: constraintViolationsV1,
+	}); err != nil {
+		panic(err)
+	}
+}
+
+// Register JWT fields of emblems for easier parsing.
+func registerClaimsV1() {
 	jwt.RegisterCustomField("log", Log{})
 	jwt.RegisterCustomField("key", "")
+	jwt.RegisterCustomField("jwk", EmbeddedKey{})
 	jwt.RegisterCustomField("assets", Assets{})
 	jwt.RegisterCustomField("emb", EmblemConstraints{})
-	jwt.RegisterCustomField("ver", "")
 }
 
 var ErrIllegalConst = errors.New("json element is illegal constant")
@@ -113,6 +128,56 @@ type EmblemConstraints struct {
 	Distribution *ChannelMask `json:"dst,omitempty"`
 	Assets       []*ident.AI  `json:"assets,omitempty"`
 	Window       *int         `json:"wnd,omitempty"`
+	// Names of constraints that verifiers must understand.
+	Critical []string `json:"crit,omitempty"`
+	// Raw JSON values of all other constraints by name. See
+	// [RegisterConstraint].
+	Extensions map[string]json.RawMessage `json:"-"`
+}
+
+// Names of the constraints that are members of [EmblemConstraints].
+var builtinConstraints = []string{"prp", "dst", "assets", "wnd", "crit"}
+
+// Avoids recursive calls of custom JSON (un)marshalling.
+type emblemConstraintsJSON EmblemConstraints
+
+func (ec *EmblemConstraints) UnmarshalJSON(bs []byte) error {
+	var builtin emblemConstraintsJSON
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(bs, &builtin); err != nil {
+		return err
+	} else if err := json.Unmarshal(bs, &members); err != nil {
+		return err
+	}
+
+	*ec = EmblemConstraints(builtin)
+	for name, raw := range members {
+		if !util.Contains(builtinConstraints, name) {
+			if ec.Extensions == nil {
+				ec.Extensions = map[string]json.RawMessage{}
+			}
+			ec.Extensions[name] = raw
+		}
+	}
+	return nil
+}
+
+func (ec EmblemConstraints) MarshalJSON() ([]byte, error) {
+	bs, err := json.Marshal(emblemConstraintsJSON(ec))
+	if err != nil || len(ec.Extensions) == 0 {
+		return bs, err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(bs, &members); err != nil {
+		return nil, err
+	}
+	for name, raw := range ec.Extensions {
+		if !util.Contains(builtinConstraints, name) {
+			members[name] = raw
+		}
+	}
+	return json.Marshal(members)
 }
 
 // Struct that represents an identifying log binding.
@@ -152,8 +217,33 @@ var ErrAssets = errors.New("emblems require non-empty assets claim")
 var ErrLogClaim = errors.New("emblems must not contain a log claim")
 var ErrEndMissing = errors.New("endorsements require end claim")
 
-// Validation function for emblem tokens.
-var EmblemValidator = jwt.ValidatorFunc(func(_ context.Context, t jwt.Token) error {
+// Validation function for emblem tokens. Dispatches to the validator of the
+// token's version and validates registered claim extensions.
+var EmblemValidator = jwt.ValidatorFunc(func(ctx context.Context, t jwt.Token) error {
+	if rules, err := RulesFor(t); err != nil {
+		return err
+	} else {
+		if err := rules.EmblemValidator.Validate(ctx, t); err != nil {
+			return err
+		}
+		return validateClaimExtensions(t)
+	}
+})
+
+// Validation function for endorsement tokens. Dispatches to the validator of
+// the token's version and validates registered claim extensions.
+var EndorsementValidator = jwt.ValidatorFunc(func(ctx context.Context, t jwt.Token) error {
+	if rules, err := RulesFor(t); err != nil {
+		return err
+	} else {
+		if err := rules.EndorsementValidator.Validate(ctx, t); err != nil {
+			return err
+		}
+		return validateClaimExtensions(t)
+	}
+})
+
+var emblemValidatorV1 = jwt.ValidatorFunc(func(_ context.Context, t jwt.Token) error {
 	if err := validateCommon(t); err != nil {
 		return err
 	}
@@ -172,8 +262,7 @@ var EmblemValidator = jwt.ValidatorFunc(func(_ context.Context, t jwt.Token) err
 	return nil
 })
 
-// Validation function for endorsement tokens.
-var EndorsementValidator = jwt.ValidatorFunc(func(_ context.Context, t jwt.Token) error {
+var endorsementValidatorV1 = jwt.ValidatorFunc(func(_ context.Context, t jwt.Token) error {
 	if err := validateCommon(t); err != nil {
 		return err
 	}
@@ -209,11 +298,6 @@ func validateCommon(t jwt.Token) error {
 		return err
 	}
 
-	var ver string
-	if err := t.Get("ver", &ver); err != nil || ver != string(consts.V1) {
-		return ErrIllegalVersion
-	}
-
 	if iss, ok := t.Issuer(); ok && validateOI(iss) != nil {
 		return jwt.InvalidIssuerError()
 	}
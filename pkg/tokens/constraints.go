@@ -1,38 +1,14 @@
 package tokens
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 
+	"github.com/adem-wg/adem-proto/pkg/ident"
 	"github.com/lestrrat-go/jwx/v3/jwt"
 )
 
-// Check that the given emblem's assets claim complies with the given assets
-// constraints.
-func checkAssetConstraint(emblem jwt.Token, constraints EmblemConstraints) bool {
-	if len(constraints.Assets) == 0 {
-		return true
-	}
-
-	var assets Assets
-	if err := emblem.Get("assets", &assets); err != nil {
-		return false
-	} else {
-		for _, ai := range assets {
-			match := false
-			for _, constraint := range constraints.Assets {
-				if constraint.MoreGeneral(ai) {
-					match = true
-					break
-				}
-			}
-			if !match {
-				return false
-			}
-		}
-		return true
-	}
-}
-
 var ErrAssetConstraint = errors.New("emblem does not satisfy asset constraint")
 var ErrPrpConstraint = errors.New("emblem does not satisfy prp constraint")
 var ErrDstConstraint = errors.New("emblem does not satisfy dst constraint")
@@ -40,38 +16,81 @@ var ErrWndConstraint = errors.New("emblem does not satisfy wnd constraint")
 var ErrMissingExpNbf = errors.New("emblem misses nbf or exp")
 
 // Verify that the given emblem complies with the given endorsement's
-// constraints.
+// constraints. Returns the first violation reported by
+// [ConstraintViolations].
 func VerifyConstraints(emblem jwt.Token, endorsement jwt.Token) error {
+	if violations := ConstraintViolations(emblem, endorsement); len(violations) > 0 {
+		return violations[0]
+	}
+	return nil
+}
+
+// List all constraints of the given endorsement that the given emblem
+// violates. Asset violations are reported per asset. The semantics of
+// constraints are defined by the endorsement's version. Returned errors wrap
+// the respective constraint error, e.g., [ErrAssetConstraint].
+func ConstraintViolations(emblem jwt.Token, endorsement jwt.Token) []error {
+	if rules, err := RulesFor(endorsement); err != nil {
+		return []error{err}
+	} else {
+		return rules.ConstraintViolations(emblem, endorsement)
+	}
+}
+
+func constraintViolationsV1(emblem jwt.Token, endorsement jwt.Token) []error {
 	var endCnstrs, embCnstrs EmblemConstraints
 	if err := endorsement.Get("emb", &endCnstrs); err != nil {
 		if errors.Is(err, jwt.ClaimNotFoundError()) {
 			return nil
 		} else {
-			return err
+			return []error{err}
 		}
-	} else if !checkAssetConstraint(emblem, endCnstrs) {
-		return ErrAssetConstraint
-	} else if err := emblem.Get("emb", &embCnstrs); err != nil {
-		return err // this claim must be present; any error should lead to failure
-	} else {
-		embPrp := embCnstrs.Purpose
-		endPrp := endCnstrs.Purpose
-		if endPrp != nil && *endPrp&*embPrp != *embPrp {
-			return ErrPrpConstraint
-		}
-		embDst := embCnstrs.Distribution
-		endDst := endCnstrs.Distribution
-		if endDst != nil && *endDst&*embDst != *embDst {
-			return ErrDstConstraint
+	}
+
+	violations := []error{}
+	if len(endCnstrs.Assets) > 0 {
+		var assets Assets
+		if err := emblem.Get("assets", &assets); err != nil {
+			violations = append(violations, fmt.Errorf("%w: %s", ErrAssetConstraint, err))
 		}
-		wnd := endCnstrs.Window
-		if exp, ok := emblem.Expiration(); !ok {
-			return ErrMissingExpNbf
-		} else if nbf, ok := emblem.NotBefore(); !ok {
-			return ErrMissingExpNbf
-		} else if wnd != nil && exp.Unix()-nbf.Unix() > int64(*wnd) {
-			return ErrWndConstraint
+		cover := ident.AssetSet(endCnstrs.Assets).MinimalCover()
+		for _, ai := range assets {
+			if !cover.Covers(ai) {
+				violations = append(violations, fmt.Errorf("%w: asset %s not covered by %s", ErrAssetConstraint, ai, encodeConstraint(cover)))
+			}
 		}
 	}
-	return nil
+
+	if err := emblem.Get("emb", &embCnstrs); err != nil {
+		return append(violations, err)
+	}
+
+	// Emblems that state no purposes or channels cannot be shown to comply
+	if endPrp, embPrp := endCnstrs.Purpose, embCnstrs.Purpose; endPrp != nil && embPrp == nil {
+		violations = append(violations, fmt.Errorf("%w: emblem states no purposes", ErrPrpConstraint))
+	} else if endPrp != nil && *endPrp&*embPrp != *embPrp {
+		violations = append(violations, fmt.Errorf("%w: purposes %s not within %s", ErrPrpConstraint, encodeConstraint(embPrp), encodeConstraint(endPrp)))
+	}
+	if endDst, embDst := endCnstrs.Distribution, embCnstrs.Distribution; endDst != nil && embDst == nil {
+		violations = append(violations, fmt.Errorf("%w: emblem states no distribution channels", ErrDstConstraint))
+	} else if endDst != nil && *endDst&*embDst != *embDst {
+		violations = append(violations, fmt.Errorf("%w: distribution channels %s not within %s", ErrDstConstraint, encodeConstraint(embDst), encodeConstraint(endDst)))
+	}
+
+	exp, expOk := emblem.Expiration()
+	nbf, nbfOk := emblem.NotBefore()
+	if !expOk || !nbfOk {
+		violations = append(violations, ErrMissingExpNbf)
+	} else if wnd := endCnstrs.Window; wnd != nil && exp.Unix()-nbf.Unix() > int64(*wnd) {
+		violations = append(violations, fmt.Errorf("%w: validity of %ds exceeds %ds", ErrWndConstraint, exp.Unix()-nbf.Unix(), *wnd))
+	}
+	return append(violations, checkExtensions(emblem, endCnstrs)...)
+}
+
+func encodeConstraint(v any) string {
+	if bs, err := json.Marshal(v); err != nil {
+		return fmt.Sprint(v)
+	} else {
+		return string(bs)
+	}
 }
@@ -1,9 +1,11 @@
 package tokens
 
 import (
+	"errors"
 	"testing"
 	"time"
 
+	"github.com/adem-wg/adem-proto/pkg/consts"
 	"github.com/adem-wg/adem-proto/pkg/ident"
 	"github.com/lestrrat-go/jwx/v3/jwt"
 )
@@ -36,6 +38,9 @@ func mkEmblemToken(t *testing.T, emb EmblemConstraints, assets []*ident.AI, nbf,
 func mkEndorsementToken(t *testing.T, emb *EmblemConstraints) jwt.Token {
 	t.Helper()
 	tok := jwt.New()
+	if err := tok.Set("ver", string(consts.V1)); err != nil {
+		t.Fatalf("set ver: %v", err)
+	}
 	if emb != nil {
 		if err := tok.Set("emb", *emb); err != nil {
 			t.Fatalf("set emb: %v", err)
@@ -61,11 +66,40 @@ func TestVerifyConstraintsAssetMismatch(t *testing.T) {
 	emblem := jwt.New()
 	if err := emblem.Set("assets", []*ident.AI{parseAI(t, "other.com")}); err != nil {
 		t.Fatalf("set assets: %v", err)
-	} else if err := VerifyConstraints(emblem, endorsement); err != ErrAssetConstraint {
+	} else if err := VerifyConstraints(emblem, endorsement); !errors.Is(err, ErrAssetConstraint) {
 		t.Fatalf("expected ErrAssetConstraint, got %v", err)
 	}
 }
 
+func TestVerifyConstraintsPrefixContainment(t *testing.T) {
+	constraints := EmblemConstraints{
+		Assets: []*ident.AI{parseAI(t, "[10.0.0.0/25]"), parseAI(t, "[10.0.0.128/25]")},
+	}
+	endorsement := mkEndorsementToken(t, &constraints)
+	emblem := jwt.New()
+	if err := emblem.Set("assets", []*ident.AI{parseAI(t, "[10.0.0.0/8]")}); err != nil {
+		t.Fatalf("set assets: %v", err)
+	} else if err := VerifyConstraints(emblem, endorsement); !errors.Is(err, ErrAssetConstraint) {
+		t.Fatalf("expected ErrAssetConstraint for wider prefix, got %v", err)
+	} else if err := VerifyConstraints(mkEmblemToken(t, EmblemConstraints{}, []*ident.AI{parseAI(t, "[10.0.0.0/24]")}, time.Now(), time.Now()), endorsement); err != nil {
+		t.Fatalf("expected prefix covered by union of constraints to comply")
+	}
+}
+
+func TestVerifyConstraintsPorts(t *testing.T) {
+	constraints := EmblemConstraints{
+		Assets: []*ident.AI{parseAI(t, "[192.0.2.0/24]:443")},
+	}
+	endorsement := mkEndorsementToken(t, &constraints)
+	now := time.Now()
+	for asset, expected := range map[string]bool{"[192.0.2.1]:443": true, "[192.0.2.1]": false, "[192.0.2.1]:80": false} {
+		emblem := mkEmblemToken(t, EmblemConstraints{}, []*ident.AI{parseAI(t, asset)}, now, now)
+		if err := VerifyConstraints(emblem, endorsement); (err == nil) != expected {
+			t.Errorf("expected constraint check for %s to be %v", asset, expected)
+		}
+	}
+}
+
 func TestVerifyConstraintsPurposeMismatch(t *testing.T) {
 	pEnd := Protective
 	pEmb := Indicative
@@ -76,7 +110,7 @@ func TestVerifyConstraintsPurposeMismatch(t *testing.T) {
 	now := time.Now()
 	emblem := mkEmblemToken(t, embConstraints, []*ident.AI{parseAI(t, "example.com")}, now, now.Add(time.Minute))
 
-	if err := VerifyConstraints(emblem, endorsement); err != ErrPrpConstraint {
+	if err := VerifyConstraints(emblem, endorsement); !errors.Is(err, ErrPrpConstraint) {
 		t.Fatalf("expected ErrPrpConstraint, got %v", err)
 	}
 }
@@ -91,11 +125,25 @@ func TestVerifyConstraintsDistributionMismatch(t *testing.T) {
 	now := time.Now()
 	emblem := mkEmblemToken(t, embConstraints, []*ident.AI{parseAI(t, "example.com")}, now, now.Add(time.Minute))
 
-	if err := VerifyConstraints(emblem, endorsement); err != ErrDstConstraint {
+	if err := VerifyConstraints(emblem, endorsement); !errors.Is(err, ErrDstConstraint) {
 		t.Fatalf("expected ErrDstConstraint, got %v", err)
 	}
 }
 
+func TestVerifyConstraintsUnstatedPurpose(t *testing.T) {
+	p := Protective
+	d := DNS
+	endorsement := mkEndorsementToken(t, &EmblemConstraints{Purpose: &p, Distribution: &d})
+	now := time.Now()
+	emblem := mkEmblemToken(t, EmblemConstraints{}, []*ident.AI{parseAI(t, "example.com")}, now, now.Add(time.Minute))
+
+	if err := VerifyConstraints(emblem, endorsement); !errors.Is(err, ErrPrpConstraint) {
+		t.Fatalf("expected ErrPrpConstraint, got %v", err)
+	} else if violations := ConstraintViolations(emblem, endorsement); len(violations) != 2 || !errors.Is(violations[1], ErrDstConstraint) {
+		t.Fatalf("expected prp and dst violations, got %v", violations)
+	}
+}
+
 func TestVerifyConstraintsWindowExceeded(t *testing.T) {
 	wnd := 5
 	endConstraints := EmblemConstraints{Window: &wnd}
@@ -106,7 +154,7 @@ func TestVerifyConstraintsWindowExceeded(t *testing.T) {
 	exp := nbf.Add(10 * time.Second)
 	emblem := mkEmblemToken(t, embConstraints, []*ident.AI{parseAI(t, "example.com")}, nbf, exp)
 
-	if err := VerifyConstraints(emblem, endorsement); err != ErrWndConstraint {
+	if err := VerifyConstraints(emblem, endorsement); !errors.Is(err, ErrWndConstraint) {
 		t.Fatalf("expected ErrWndConstraint, got %v", err)
 	}
 }
@@ -136,3 +184,38 @@ func TestVerifyConstraintsSuccess(t *testing.T) {
 		t.Fatalf("expected constraints to verify, got %v", err)
 	}
 }
+
+func TestConstraintViolationsListsAll(t *testing.T) {
+	pEnd := Protective
+	pEmb := Protective | Indicative
+	wnd := 5
+	endConstraints := EmblemConstraints{
+		Purpose: &pEnd,
+		Window:  &wnd,
+		Assets:  []*ident.AI{parseAI(t, "*.example.com")},
+	}
+	endorsement := mkEndorsementToken(t, &endConstraints)
+
+	nbf := time.Now()
+	assets := []*ident.AI{parseAI(t, "api.example.com"), parseAI(t, "other.com"), parseAI(t, "[192.0.2.1]")}
+	emblem := mkEmblemToken(t, EmblemConstraints{Purpose: &pEmb}, assets, nbf, nbf.Add(time.Minute))
+
+	counts := map[error]int{}
+	for _, err := range ConstraintViolations(emblem, endorsement) {
+		for _, target := range []error{ErrAssetConstraint, ErrPrpConstraint, ErrWndConstraint} {
+			if errors.Is(err, target) {
+				counts[target]++
+			}
+		}
+	}
+	if counts[ErrAssetConstraint] != 2 || counts[ErrPrpConstraint] != 1 || counts[ErrWndConstraint] != 1 {
+		t.Fatalf("unexpected violation counts: %v", counts)
+	}
+}
+
+func TestConstraintViolationsNone(t *testing.T) {
+	endorsement := mkEndorsementToken(t, nil)
+	if violations := ConstraintViolations(jwt.New(), endorsement); len(violations) != 0 {
+		t.Fatalf("expected no violations, got %v", violations)
+	}
+}
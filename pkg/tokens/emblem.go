@@ -0,0 +1,142 @@
+package tokens
+
+import (
+	"errors"
+	"time"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/ident"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var ErrValidity = errors.New("expiry must be after not-before")
+
+// Typed representation of an emblem's claims.
+type Emblem struct {
+	Issuer      string
+	Assets      []*ident.AI
+	Constraints EmblemConstraints
+	IssuedAt    time.Time
+	NotBefore   time.Time
+	Expiration  time.Time
+}
+
+// Check that the emblem's claims are well-formed. Time claims may be unset;
+// they will be set when signing the emblem.
+func (e *Emblem) Validate() error {
+	if len(e.Assets) == 0 {
+		return ErrAssets
+	} else if err := validateOI(e.Issuer); err != nil {
+		return err
+	} else if !e.NotBefore.IsZero() && !e.Expiration.IsZero() && !e.Expiration.After(e.NotBefore) {
+		return ErrValidity
+	}
+	return nil
+}
+
+// Convert the emblem into an unsigned JWT.
+func (e *Emblem) Token() (jwt.Token, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+
+	t := jwt.New()
+	if err := t.Set("ver", string(consts.V1)); err != nil {
+		return nil, err
+	} else if err := t.Set("assets", e.Assets); err != nil {
+		return nil, err
+	} else if err := t.Set("emb", e.Constraints); err != nil {
+		return nil, err
+	} else if e.Issuer != "" {
+		if err := t.Set(jwt.IssuerKey, e.Issuer); err != nil {
+			return nil, err
+		}
+	}
+	if err := setTimes(t, e.IssuedAt, e.NotBefore, e.Expiration); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Read an emblem's claims from the given JWT.
+func EmblemFromToken(t jwt.Token) (*Emblem, error) {
+	var e Emblem
+	if err := t.Get("assets", &e.Assets); err != nil {
+		return nil, ErrAssets
+	} else if err := t.Get("emb", &e.Constraints); err != nil && !errors.Is(err, jwt.ClaimNotFoundError()) {
+		return nil, err
+	}
+	e.Issuer, _ = t.Issuer()
+	e.IssuedAt, e.NotBefore, e.Expiration = getTimes(t)
+
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Builder for emblems. Errors are reported by [EmblemBuilder.Build].
+type EmblemBuilder struct {
+	emblem Emblem
+}
+
+func BuildEmblem() *EmblemBuilder {
+	return &EmblemBuilder{}
+}
+
+func (b *EmblemBuilder) WithIssuer(iss string) *EmblemBuilder {
+	b.emblem.Issuer = iss
+	return b
+}
+
+func (b *EmblemBuilder) WithAssets(assets ...*ident.AI) *EmblemBuilder {
+	b.emblem.Assets = append(b.emblem.Assets, assets...)
+	return b
+}
+
+func (b *EmblemBuilder) WithPurpose(prp PurposeMask) *EmblemBuilder {
+	b.emblem.Constraints.Purpose = &prp
+	return b
+}
+
+func (b *EmblemBuilder) WithDistribution(dst ChannelMask) *EmblemBuilder {
+	b.emblem.Constraints.Distribution = &dst
+	return b
+}
+
+func (b *EmblemBuilder) WithValidity(nbf time.Time, exp time.Time) *EmblemBuilder {
+	b.emblem.NotBefore = nbf
+	b.emblem.Expiration = exp
+	return b
+}
+
+// Return the built emblem if its claims are well-formed.
+func (b *EmblemBuilder) Build() (*Emblem, error) {
+	e := b.emblem
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func setTimes(t jwt.Token, iat time.Time, nbf time.Time, exp time.Time) error {
+	for key, val := range map[string]time.Time{
+		jwt.IssuedAtKey:   iat,
+		jwt.NotBeforeKey:  nbf,
+		jwt.ExpirationKey: exp,
+	} {
+		if val.IsZero() {
+			continue
+		} else if err := t.Set(key, val); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getTimes(t jwt.Token) (iat time.Time, nbf time.Time, exp time.Time) {
+	iat, _ = t.IssuedAt()
+	nbf, _ = t.NotBefore()
+	exp, _ = t.Expiration()
+	return
+}
@@ -0,0 +1,170 @@
+package tokens
+
+import (
+	"errors"
+	"time"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var ErrLogNoIss = errors.New("endorsements with log claim require issuer")
+var ErrLogEmpty = errors.New("log claim must not be empty")
+
+// Typed representation of an endorsement's claims.
+type Endorsement struct {
+	Issuer  string
+	Subject string
+	// KID of the endorsed key. Will be set when signing the endorsement.
+	Key string
+	// Whether to embed the full endorsed key when signing the endorsement. Set
+	// when decoding endorsements that embed the endorsed key.
+	EmbedKey    bool
+	Log         Log
+	End         bool
+	Constraints *EmblemConstraints
+	IssuedAt    time.Time
+	NotBefore   time.Time
+	Expiration  time.Time
+}
+
+// Check that the endorsement's claims are well-formed. Time claims and the
+// endorsed key may be unset; they will be set when signing the endorsement.
+func (e *Endorsement) Validate() error {
+	if err := validateOI(e.Issuer); err != nil {
+		return err
+	} else if err := validateOI(e.Subject); err != nil {
+		return err
+	} else if e.Log != nil && len(e.Log) == 0 {
+		return ErrLogEmpty
+	} else if e.Log != nil && e.Issuer == "" {
+		return ErrLogNoIss
+	} else if !e.NotBefore.IsZero() && !e.Expiration.IsZero() && !e.Expiration.After(e.NotBefore) {
+		return ErrValidity
+	}
+	return nil
+}
+
+// Convert the endorsement into an unsigned JWT.
+func (e *Endorsement) Token() (jwt.Token, error) {
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+
+	t := jwt.New()
+	if err := t.Set("ver", string(consts.V1)); err != nil {
+		return nil, err
+	} else if err := t.Set("end", e.End); err != nil {
+		return nil, err
+	}
+
+	optional := map[string]any{}
+	if e.Issuer != "" {
+		optional[jwt.IssuerKey] = e.Issuer
+	}
+	if e.Subject != "" {
+		optional[jwt.SubjectKey] = e.Subject
+	}
+	if e.Key != "" {
+		optional["key"] = e.Key
+	}
+	if e.Log != nil {
+		optional["log"] = e.Log
+	}
+	if e.Constraints != nil {
+		optional["emb"] = *e.Constraints
+	}
+	for key, val := range optional {
+		if err := t.Set(key, val); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := setTimes(t, e.IssuedAt, e.NotBefore, e.Expiration); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Read an endorsement's claims from the given JWT.
+func EndorsementFromToken(t jwt.Token) (*Endorsement, error) {
+	var e Endorsement
+	if err := t.Get("end", &e.End); err != nil && !errors.Is(err, jwt.ClaimNotFoundError()) {
+		return nil, err
+	} else if err := t.Get("key", &e.Key); err != nil && !errors.Is(err, jwt.ClaimNotFoundError()) {
+		return nil, err
+	} else if err := t.Get("log", &e.Log); err != nil && !errors.Is(err, jwt.ClaimNotFoundError()) {
+		return nil, err
+	}
+	e.EmbedKey = t.Has("jwk")
+
+	if t.Has("emb") {
+		var emb EmblemConstraints
+		if err := t.Get("emb", &emb); err != nil {
+			return nil, err
+		}
+		e.Constraints = &emb
+	}
+	e.Issuer, _ = t.Issuer()
+	e.Subject, _ = t.Subject()
+	e.IssuedAt, e.NotBefore, e.Expiration = getTimes(t)
+
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Builder for endorsements. Errors are reported by [EndorsementBuilder.Build].
+type EndorsementBuilder struct {
+	endorsement Endorsement
+}
+
+func BuildEndorsement() *EndorsementBuilder {
+	return &EndorsementBuilder{}
+}
+
+func (b *EndorsementBuilder) WithIssuer(iss string) *EndorsementBuilder {
+	b.endorsement.Issuer = iss
+	return b
+}
+
+func (b *EndorsementBuilder) WithSubject(sub string) *EndorsementBuilder {
+	b.endorsement.Subject = sub
+	return b
+}
+
+func (b *EndorsementBuilder) WithKey(kid string) *EndorsementBuilder {
+	b.endorsement.Key = kid
+	return b
+}
+
+func (b *EndorsementBuilder) WithLog(log Log) *EndorsementBuilder {
+	b.endorsement.Log = log
+	return b
+}
+
+func (b *EndorsementBuilder) WithEnd(end bool) *EndorsementBuilder {
+	b.endorsement.End = end
+	return b
+}
+
+func (b *EndorsementBuilder) WithConstraints(emb EmblemConstraints) *EndorsementBuilder {
+	b.endorsement.Constraints = &emb
+	return b
+}
+
+func (b *EndorsementBuilder) WithValidity(nbf time.Time, exp time.Time) *EndorsementBuilder {
+	b.endorsement.NotBefore = nbf
+	b.endorsement.Expiration = exp
+	return b
+}
+
+// Return the built endorsement if its claims are well-formed.
+func (b *EndorsementBuilder) Build() (*Endorsement, error) {
+	e := b.endorsement
+	if err := e.Validate(); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
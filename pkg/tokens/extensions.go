@@ -0,0 +1,179 @@
+package tokens
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var ErrConstraintRegistered = errors.New("constraint already registered")
+var ErrUnknownCritical = errors.New("unknown critical constraint")
+var ErrExtConstraint = errors.New("emblem does not satisfy constraint")
+var ErrMaxAssetsConstraint = errors.New("emblem does not satisfy maxassets constraint")
+var ErrExpConstraint = errors.New("emblem does not satisfy exp constraint")
+var ErrIssConstraint = errors.New("emblem does not satisfy iss constraint")
+
+// Constraint is a decoded extension constraint of an endorsement's "emb"
+// claim.
+type Constraint interface {
+	// Check that the given emblem complies with the constraint.
+	Check(emblem jwt.Token) error
+}
+
+// ConstraintDecoder decodes the JSON value of an extension constraint.
+type ConstraintDecoder func(raw json.RawMessage) (Constraint, error)
+
+var constraintsLock sync.RWMutex
+var constraintRegistry = map[string]ConstraintDecoder{}
+
+// Register an extension constraint. The name is the constraint's member name
+// in the "emb" claim and must not collide with built-in constraints.
+func RegisterConstraint(name string, decode ConstraintDecoder) error {
+	constraintsLock.Lock()
+	defer constraintsLock.Unlock()
+
+	if _, ok := constraintRegistry[name]; ok || slices.Contains(builtinConstraints, name) {
+		return fmt.Errorf("%w: %s", ErrConstraintRegistered, name)
+	}
+	constraintRegistry[name] = decode
+	return nil
+}
+
+// Remove an extension constraint, e.g., one registered by a test.
+func UnregisterConstraint(name string) {
+	constraintsLock.Lock()
+	defer constraintsLock.Unlock()
+
+	delete(constraintRegistry, name)
+}
+
+// Check whether the given name is a registered extension constraint.
+func IsConstraintExtension(name string) bool {
+	_, ok := lookupConstraint(name)
+	return ok
+}
+
+func lookupConstraint(name string) (ConstraintDecoder, bool) {
+	constraintsLock.RLock()
+	defer constraintsLock.RUnlock()
+
+	decode, ok := constraintRegistry[name]
+	return decode, ok
+}
+
+// Check the given emblem against all extension constraints. Unknown
+// constraints are ignored unless they are marked critical. Critical
+// constraints must be known even if the endorsement does not state them.
+func checkExtensions(emblem jwt.Token, constraints EmblemConstraints) []error {
+	violations := []error{}
+	crit := slices.Clone(constraints.Critical)
+	slices.Sort(crit)
+	for _, name := range slices.Compact(crit) {
+		if !slices.Contains(builtinConstraints, name) && !IsConstraintExtension(name) {
+			violations = append(violations, fmt.Errorf("%w: %s", ErrUnknownCritical, name))
+		}
+	}
+
+	names := make([]string, 0, len(constraints.Extensions))
+	for name := range constraints.Extensions {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		if decode, ok := lookupConstraint(name); !ok {
+			// Unknown critical constraints are reported above.
+			continue
+		} else if constraint, err := decode(constraints.Extensions[name]); err != nil {
+			violations = append(violations, fmt.Errorf("%w %s: %s", ErrExtConstraint, name, err))
+		} else if err := constraint.Check(emblem); err != nil {
+			violations = append(violations, err)
+		}
+	}
+	return violations
+}
+
+// Register the extension constraints shipped with this package.
+func init() {
+	for name, decode := range map[string]ConstraintDecoder{
+		"maxassets": decodeMaxAssets,
+		"exp":       decodeExpCeiling,
+		"iss":       decodeIssuers,
+	} {
+		if err := RegisterConstraint(name, decode); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Upper bound on the number of assets of an emblem.
+type MaxAssetsConstraint int
+
+func decodeMaxAssets(raw json.RawMessage) (Constraint, error) {
+	var max MaxAssetsConstraint
+	if err := json.Unmarshal(raw, &max); err != nil {
+		return nil, err
+	} else if max < 0 {
+		return nil, errors.New("maxassets must not be negative")
+	}
+	return max, nil
+}
+
+func (c MaxAssetsConstraint) Check(emblem jwt.Token) error {
+	var assets Assets
+	if err := emblem.Get("assets", &assets); err != nil {
+		return fmt.Errorf("%w: %s", ErrMaxAssetsConstraint, err)
+	} else if len(assets) > int(c) {
+		return fmt.Errorf("%w: %d assets exceed %d", ErrMaxAssetsConstraint, len(assets), c)
+	}
+	return nil
+}
+
+// Absolute upper bound on an emblem's expiration time as NumericDate.
+type ExpCeilingConstraint int64
+
+func decodeExpCeiling(raw json.RawMessage) (Constraint, error) {
+	var ceiling ExpCeilingConstraint
+	if err := json.Unmarshal(raw, &ceiling); err != nil {
+		return nil, err
+	}
+	return ceiling, nil
+}
+
+func (c ExpCeilingConstraint) Check(emblem jwt.Token) error {
+	if exp, ok := emblem.Expiration(); !ok {
+		return ErrMissingExpNbf
+	} else if exp.Unix() > int64(c) {
+		return fmt.Errorf("%w: expiration %d after %d", ErrExpConstraint, exp.Unix(), c)
+	}
+	return nil
+}
+
+// Set of OIs that may issue emblems. Emblems without issuer never comply.
+type IssuerConstraint []string
+
+func decodeIssuers(raw json.RawMessage) (Constraint, error) {
+	var issuers IssuerConstraint
+	if err := json.Unmarshal(raw, &issuers); err != nil {
+		return nil, err
+	}
+	for _, iss := range issuers {
+		if err := validateOI(iss); err != nil {
+			return nil, err
+		}
+	}
+	return issuers, nil
+}
+
+func (c IssuerConstraint) Check(emblem jwt.Token) error {
+	if iss, ok := emblem.Issuer(); !ok {
+		return fmt.Errorf("%w: emblem has no issuer", ErrIssConstraint)
+	} else if !slices.Contains(c, iss) {
+		return fmt.Errorf("%w: issuer %s not permitted", ErrIssConstraint, iss)
+	}
+	return nil
+}
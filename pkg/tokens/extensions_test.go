@@ -0,0 +1,96 @@
+package tokens
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adem-wg/adem-proto/pkg/ident"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+func TestEmblemConstraintsExtensionsRoundtrip(t *testing.T) {
+	raw := `{"assets":["example.com"],"crit":["foo"],"foo":{"bar":1},"maxassets":2,"wnd":60}`
+	var constraints EmblemConstraints
+	if err := json.Unmarshal([]byte(raw), &constraints); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	} else if len(constraints.Extensions) != 2 || constraints.Window == nil || *constraints.Window != 60 {
+		t.Fatalf("unexpected constraints: %+v", constraints)
+	} else if bs, err := json.Marshal(constraints); err != nil {
+		t.Fatalf("marshal: %v", err)
+	} else if string(bs) != raw {
+		t.Fatalf("expected %s after roundtrip, got %s", raw, bs)
+	}
+}
+
+func mkExtEndorsement(t *testing.T, raw string) jwt.Token {
+	t.Helper()
+	var constraints EmblemConstraints
+	if err := json.Unmarshal([]byte(raw), &constraints); err != nil {
+		t.Fatalf("unmarshal constraints: %v", err)
+	}
+	return mkEndorsementToken(t, &constraints)
+}
+
+func TestExtensionConstraints(t *testing.T) {
+	nbf := time.Unix(1_700_000_000, 0)
+	emblem := mkEmblemToken(t, EmblemConstraints{}, []*ident.AI{parseAI(t, "a.example.com"), parseAI(t, "b.example.com")}, nbf, nbf.Add(time.Hour))
+	if err := emblem.Set(jwt.IssuerKey, "https://example.com"); err != nil {
+		t.Fatalf("set iss: %v", err)
+	}
+
+	tests := []struct {
+		emb      string
+		expected error
+	}{
+		{`{"maxassets":2}`, nil},
+		{`{"maxassets":1}`, ErrMaxAssetsConstraint},
+		{`{"exp":1700003600}`, nil},
+		{`{"exp":1700000001}`, ErrExpConstraint},
+		{`{"iss":["https://example.com"]}`, nil},
+		{`{"iss":["https://example.org"]}`, ErrIssConstraint},
+		{`{"maxassets":"two"}`, ErrExtConstraint},
+		{`{"unknown":true}`, nil},
+		{`{"unknown":true,"crit":["unknown"]}`, ErrUnknownCritical},
+		{`{"crit":["unknown"]}`, ErrUnknownCritical},
+		{`{"crit":["unknown","unknown"]}`, ErrUnknownCritical},
+		{`{"crit":["maxassets"]}`, nil},
+		{`{"maxassets":2,"crit":["maxassets","wnd"]}`, nil},
+	}
+	for _, test := range tests {
+		endorsement := mkExtEndorsement(t, test.emb)
+		if err := VerifyConstraints(emblem, endorsement); !errors.Is(err, test.expected) {
+			t.Errorf("expected %v for %s, got %v", test.expected, test.emb, err)
+		}
+		if violations := ConstraintViolations(emblem, endorsement); test.expected == nil && len(violations) != 0 {
+			t.Errorf("expected no violations for %s, got %v", test.emb, violations)
+		} else if test.expected != nil && (len(violations) != 1 || !errors.Is(violations[0], test.expected)) {
+			t.Errorf("expected violation %v for %s, got %v", test.expected, test.emb, violations)
+		}
+	}
+}
+
+type denyAll struct{}
+
+func (denyAll) Check(jwt.Token) error {
+	return errors.New("denied")
+}
+
+func TestRegisterConstraint(t *testing.T) {
+	if err := RegisterConstraint("denyall", func(json.RawMessage) (Constraint, error) { return denyAll{}, nil }); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	t.Cleanup(func() { UnregisterConstraint("denyall") })
+	if err := RegisterConstraint("denyall", nil); !errors.Is(err, ErrConstraintRegistered) {
+		t.Fatalf("expected ErrConstraintRegistered, got %v", err)
+	} else if err := RegisterConstraint("wnd", nil); !errors.Is(err, ErrConstraintRegistered) {
+		t.Fatalf("expected built-in constraint to be reserved, got %v", err)
+	}
+
+	nbf := time.Now()
+	emblem := mkEmblemToken(t, EmblemConstraints{}, []*ident.AI{parseAI(t, "example.com")}, nbf, nbf.Add(time.Hour))
+	if err := VerifyConstraints(emblem, mkExtEndorsement(t, `{"denyall":null}`)); err == nil {
+		t.Fatalf("expected registered constraint to be checked")
+	}
+}
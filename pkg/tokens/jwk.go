@@ -3,10 +3,12 @@ package tokens
 import (
 	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/elliptic"
 	"crypto/x509"
 	"encoding/base32"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"log"
 	"strings"
@@ -19,6 +21,26 @@ import (
 var ErrNoEndorsedKey = errors.New("no endorsed key present")
 var ErrAlgMissing = errors.New("input key misses algorithm")
 var ErrUnsupportedKey = errors.New("unsupported key")
+var ErrEndorsedKeyMismatch = errors.New("embedded key does not match endorsed KID")
+
+// Wrapper type for JSON (un)marshalling of endorsed keys embedded in
+// endorsements.
+type EmbeddedKey struct {
+	Key jwk.Key
+}
+
+func (k *EmbeddedKey) UnmarshalJSON(bs []byte) error {
+	if key, err := jwk.ParseKey(bs); err != nil {
+		return err
+	} else {
+		k.Key = key
+		return nil
+	}
+}
+
+func (k EmbeddedKey) MarshalJSON() ([]byte, error) {
+	return json.Marshal(k.Key)
+}
 
 // Get the KID of a key endorsed in an emblem.
 func GetEndorsedKID(t jwt.Token) (string, error) {
@@ -30,6 +52,28 @@ func GetEndorsedKID(t jwt.Token) (string, error) {
 	}
 }
 
+// Get the full key endorsed in an endorsement. Returns [ErrNoEndorsedKey] if
+// the endorsement only commits to the key's KID, and [ErrEndorsedKeyMismatch]
+// if the embedded key does not match the endorsed KID.
+func GetEndorsedKey(t jwt.Token) (jwk.Key, error) {
+	var embedded EmbeddedKey
+	if kid, err := GetEndorsedKID(t); err != nil {
+		return nil, err
+	} else if !t.Has("jwk") {
+		return nil, ErrNoEndorsedKey
+	} else if err := t.Get("jwk", &embedded); err != nil {
+		return nil, err
+	} else if embeddedKid, err := CalcKID(embedded.Key); err != nil {
+		return nil, err
+	} else if embeddedKid != kid {
+		return nil, ErrEndorsedKeyMismatch
+	} else if _, err := SetKID(embedded.Key, true); err != nil {
+		return nil, err
+	} else {
+		return embedded.Key, nil
+	}
+}
+
 // Get a key's KID. If it has no KID, it will be calculated.
 func GetKID(key jwk.Key) (string, error) {
 	if kid, ok := key.KeyID(); ok {
@@ -125,6 +169,8 @@ func SignatureAlgForKey(key any) (jwa.SignatureAlgorithm, error) {
 		default:
 			return jwa.NoSignature(), ErrUnsupportedKey
 		}
+	case ed25519.PublicKey:
+		return jwa.EdDSA(), nil
 	default:
 		return jwa.NoSignature(), ErrUnsupportedKey
 	}
@@ -1,10 +1,12 @@
 package tokens_test
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/adem-wg/adem-proto/pkg/tokens"
 	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jwt"
 )
 
 func TestCalcKID(t *testing.T) {
@@ -46,3 +48,29 @@ func TestCalcKID(t *testing.T) {
 		}
 	}
 }
+
+func TestGetEndorsedKey(t *testing.T) {
+	keyJSON := []byte(`{"alg":"ES512","crv":"P-521","kty":"EC","x":"AGibOTvFl5yp-bQkk6upyVieJ5baU5P5KXJ-lph_MXcZPquZgtrwuSJ-H-SHLAe4ES_61Q7JkuvnAHDb_70WUztN","y":"ALZYcr-F5dTXoLLOdvbqDskuJ3hIhY7DMUtUS7w23GsRyZ4q7qYdK6kuNHofnsCVVsHs9XEvbnC6wBaoSJd6cAqb"}`)
+	kid := "jhn3xih42qaufdseof7ldv5iwgck5oo725cf63aryl2tr6evxbyq"
+	parse := func(claims string) jwt.Token {
+		t.Helper()
+		if tok, err := jwt.Parse([]byte(claims), jwt.WithVerify(false), jwt.WithValidate(false)); err != nil {
+			t.Fatalf("parse token: %v", err)
+			return nil
+		} else {
+			return tok
+		}
+	}
+
+	if key, err := tokens.GetEndorsedKey(parse(`{"key":"` + kid + `","jwk":` + string(keyJSON) + `}`)); err != nil {
+		t.Fatalf("get endorsed key: %v", err)
+	} else if keyKid, _ := key.KeyID(); keyKid != kid {
+		t.Fatalf("expected endorsed key to have kid %s, got %s", kid, keyKid)
+	}
+
+	if _, err := tokens.GetEndorsedKey(parse(`{"key":"` + kid + `"}`)); !errors.Is(err, tokens.ErrNoEndorsedKey) {
+		t.Fatalf("expected ErrNoEndorsedKey, got %v", err)
+	} else if _, err := tokens.GetEndorsedKey(parse(`{"key":"3oepjm7zfw4vhfgnkji7qtpxzc4pnmtt7kzcxogn5l25ziqp7dka","jwk":` + string(keyJSON) + `}`)); !errors.Is(err, tokens.ErrEndorsedKeyMismatch) {
+		t.Fatalf("expected ErrEndorsedKeyMismatch, got %v", err)
+	}
+}
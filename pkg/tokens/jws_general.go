@@ -0,0 +1,73 @@
+package tokens
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+var ErrNoSignatures = errors.New("JWS has no signatures")
+var ErrPayloadMismatch = errors.New("signatures cover different payloads")
+var ErrIllegalCompact = errors.New("illegal JWS compact serialization")
+
+// JWS in JSON general serialization (see RFC 7515, Section 7.2.1). Only
+// protected headers are supported; unprotected headers are dropped.
+type GeneralJWS struct {
+	Payload    string             `json:"payload"`
+	Signatures []GeneralSignature `json:"signatures"`
+}
+
+type GeneralSignature struct {
+	Protected string `json:"protected"`
+	Signature string `json:"signature"`
+}
+
+// Check whether the given token is in JSON serialization rather than compact
+// serialization.
+func IsGeneralJWS(raw []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{"))
+}
+
+// Parse a JWS in JSON general serialization or compact serialization.
+func ParseGeneralJWS(raw []byte) (*GeneralJWS, error) {
+	raw = bytes.TrimSpace(raw)
+	if !IsGeneralJWS(raw) {
+		g := &GeneralJWS{}
+		return g, g.AddCompact(raw)
+	}
+
+	var g GeneralJWS
+	if err := json.Unmarshal(raw, &g); err != nil {
+		return nil, err
+	} else if len(g.Signatures) == 0 {
+		return nil, ErrNoSignatures
+	}
+	return &g, nil
+}
+
+// Add the signature of a JWS in compact serialization. The JWS must cover the
+// same payload as all other signatures.
+func (g *GeneralJWS) AddCompact(compact []byte) error {
+	parts := bytes.Split(bytes.TrimSpace(compact), []byte("."))
+	if len(parts) != 3 {
+		return ErrIllegalCompact
+	} else if len(g.Signatures) > 0 && g.Payload != string(parts[1]) {
+		return ErrPayloadMismatch
+	}
+
+	g.Payload = string(parts[1])
+	g.Signatures = append(g.Signatures, GeneralSignature{
+		Protected: string(parts[0]),
+		Signature: string(parts[2]),
+	})
+	return nil
+}
+
+// Split the JWS into one JWS in compact serialization per signature.
+func (g *GeneralJWS) Compact() [][]byte {
+	compact := make([][]byte, 0, len(g.Signatures))
+	for _, sig := range g.Signatures {
+		compact = append(compact, []byte(sig.Protected+"."+g.Payload+"."+sig.Signature))
+	}
+	return compact
+}
@@ -0,0 +1,42 @@
+package tokens_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+)
+
+func TestGeneralJWS(t *testing.T) {
+	g, err := tokens.ParseGeneralJWS([]byte(" aaa.ppp.sss\n"))
+	if err != nil {
+		t.Fatalf("could not parse compact JWS: %s", err)
+	} else if err := g.AddCompact([]byte("bbb.ppp.ttt")); err != nil {
+		t.Fatalf("could not add signature: %s", err)
+	} else if err := g.AddCompact([]byte("ccc.qqq.uuu")); !errors.Is(err, tokens.ErrPayloadMismatch) {
+		t.Errorf("expected payload mismatch, got %v", err)
+	} else if err := g.AddCompact([]byte("ccc.qqq")); !errors.Is(err, tokens.ErrIllegalCompact) {
+		t.Errorf("expected illegal compact serialization, got %v", err)
+	}
+
+	raw, err := json.Marshal(g)
+	if err != nil {
+		t.Fatal(err)
+	} else if !tokens.IsGeneralJWS(raw) {
+		t.Errorf("%s should be in JSON serialization", raw)
+	}
+
+	parsed, err := tokens.ParseGeneralJWS(raw)
+	if err != nil {
+		t.Fatalf("could not parse JSON serialization: %s", err)
+	}
+	compact := parsed.Compact()
+	if len(compact) != 2 || string(compact[0]) != "aaa.ppp.sss" || string(compact[1]) != "bbb.ppp.ttt" {
+		t.Errorf("unexpected compact serializations: %q", compact)
+	}
+
+	if _, err := tokens.ParseGeneralJWS([]byte(`{"payload":"ppp","signatures":[]}`)); !errors.Is(err, tokens.ErrNoSignatures) {
+		t.Errorf("expected no signatures, got %v", err)
+	}
+}
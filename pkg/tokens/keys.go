@@ -0,0 +1,120 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+var ErrUnsupportedAlg = errors.New("unsupported algorithm")
+var ErrKeyNotFound = errors.New("no key with kid")
+
+// Prefix of JWK thumbprint URIs using SHA-256 (see RFC 9278).
+const thumbprintURIPrefix = "urn:ietf:params:oauth:jwk-thumbprint:sha-256:"
+
+// Generate a fresh private key for the given signing algorithm. The key is
+// assigned the algorithm and its KID.
+func GenerateKey(alg jwa.SignatureAlgorithm) (jwk.Key, error) {
+	var raw any
+	var err error
+	switch alg {
+	case jwa.ES256():
+		raw, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case jwa.ES384():
+		raw, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case jwa.ES512():
+		raw, err = ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	case jwa.EdDSA():
+		_, raw, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedAlg, alg)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := jwk.Import(raw)
+	if err != nil {
+		return nil, err
+	} else if err := key.Set(jwk.AlgorithmKey, alg); err != nil {
+		return nil, err
+	} else if _, err := SetKID(key, true); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Set a key's algorithm if it has none. If alg is [jwa.NoSignature], the
+// algorithm is derived from the key type.
+func SetAlg(key jwk.Key, alg jwa.SignatureAlgorithm) error {
+	if keyAlg, ok := key.Algorithm(); ok && keyAlg.String() != "" {
+		return nil
+	} else if alg != jwa.NoSignature() {
+		return key.Set(jwk.AlgorithmKey, alg)
+	}
+
+	var raw any
+	if pk, err := key.PublicKey(); err != nil {
+		return err
+	} else if err := jwk.Export(pk, &raw); err != nil {
+		return err
+	} else if alg, err := SignatureAlgForKey(raw); err != nil {
+		return err
+	} else {
+		return key.Set(jwk.AlgorithmKey, alg)
+	}
+}
+
+// Select the key with the given KID from a key set. Keys without algorithm are
+// assigned alg (see [SetAlg]) before their KID is calculated.
+func SelectKey(set jwk.Set, kid string, alg jwa.SignatureAlgorithm) (jwk.Key, error) {
+	for i := range set.Len() {
+		if k, ok := set.Key(i); !ok {
+			continue
+		} else if err := SetAlg(k, alg); err != nil {
+			return nil, err
+		} else if keyKid, err := CalcKID(k); err != nil {
+			return nil, err
+		} else if keyKid == kid {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, kid)
+}
+
+// Calculate a key's JWK thumbprint URI using SHA-256 (see RFC 9278).
+func ThumbprintURI(key jwk.Key) (string, error) {
+	if pk, err := key.PublicKey(); err != nil {
+		return "", err
+	} else if digest, err := pk.Thumbprint(crypto.SHA256); err != nil {
+		return "", err
+	} else {
+		return thumbprintURIPrefix + base64.RawURLEncoding.EncodeToString(digest), nil
+	}
+}
+
+// Return the hash function that messages are digested with before signing
+// them with the given algorithm. Returns 0 for EdDSA, which signs messages
+// directly.
+func SignatureHash(alg jwa.SignatureAlgorithm) (crypto.Hash, error) {
+	switch alg {
+	case jwa.ES256():
+		return crypto.SHA256, nil
+	case jwa.ES384():
+		return crypto.SHA384, nil
+	case jwa.ES512():
+		return crypto.SHA512, nil
+	case jwa.EdDSA():
+		return 0, nil
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrUnsupportedAlg, alg)
+	}
+}
@@ -0,0 +1,75 @@
+package tokens_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+func TestGenerateKey(t *testing.T) {
+	for _, alg := range []jwa.SignatureAlgorithm{jwa.ES256(), jwa.ES384(), jwa.ES512(), jwa.EdDSA()} {
+		if key, err := tokens.GenerateKey(alg); err != nil {
+			t.Errorf("could not generate %s key: %s", alg, err)
+		} else if keyAlg, ok := key.Algorithm(); !ok || keyAlg.String() != alg.String() {
+			t.Errorf("expected alg %s, got %v", alg, keyAlg)
+		} else if kid, ok := key.KeyID(); !ok {
+			t.Errorf("%s key has no kid", alg)
+		} else if calced, err := tokens.CalcKID(key); err != nil || calced != kid {
+			t.Errorf("expected kid %s, got %s", calced, kid)
+		}
+	}
+
+	if _, err := tokens.GenerateKey(jwa.RS256()); !errors.Is(err, tokens.ErrUnsupportedAlg) {
+		t.Errorf("expected unsupported algorithm, got %v", err)
+	}
+}
+
+func TestSelectKey(t *testing.T) {
+	set := jwk.NewSet()
+	kids := []string{}
+	for _, alg := range []jwa.SignatureAlgorithm{jwa.ES256(), jwa.EdDSA()} {
+		key, err := tokens.GenerateKey(alg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kid, _ := key.KeyID()
+		kids = append(kids, kid)
+		// Strip kid and alg to mimic keys loaded from PEM
+		if err := key.Remove(jwk.KeyIDKey); err != nil {
+			t.Fatal(err)
+		} else if err := key.Remove(jwk.AlgorithmKey); err != nil {
+			t.Fatal(err)
+		}
+		set.AddKey(key)
+	}
+
+	for _, kid := range kids {
+		if key, err := tokens.SelectKey(set, kid, jwa.NoSignature()); err != nil {
+			t.Errorf("could not select %s: %s", kid, err)
+		} else if calced, _ := tokens.CalcKID(key); calced != kid {
+			t.Errorf("selected wrong key: expected %s, got %s", kid, calced)
+		}
+	}
+
+	if _, err := tokens.SelectKey(set, "unknown", jwa.NoSignature()); !errors.Is(err, tokens.ErrKeyNotFound) {
+		t.Errorf("expected key not found, got %v", err)
+	}
+}
+
+func TestThumbprintURI(t *testing.T) {
+	// Example of RFC 9278, Section 3
+	key, err := jwk.ParseKey([]byte(`{"kty":"RSA","n":"0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw","e":"AQAB","alg":"RS256","kid":"2011-04-29"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "urn:ietf:params:oauth:jwk-thumbprint:sha-256:NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"
+	if uri, err := tokens.ThumbprintURI(key); err != nil {
+		t.Error(err)
+	} else if uri != expected {
+		t.Errorf("expected %s, got %s", expected, uri)
+	}
+}
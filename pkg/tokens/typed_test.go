@@ -0,0 +1,79 @@
+package tokens
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+func TestEmblemBuilderRoundtrip(t *testing.T) {
+	nbf := time.Now().Truncate(time.Second)
+	emblem, err := BuildEmblem().
+		WithIssuer("https://example.com").
+		WithAssets(parseAI(t, "example.com"), parseAI(t, "[192.0.2.0/24]")).
+		WithPurpose(Protective).
+		WithDistribution(DNS|TLS).
+		WithValidity(nbf, nbf.Add(time.Hour)).
+		Build()
+	if err != nil {
+		t.Fatalf("build emblem: %v", err)
+	}
+
+	if tok, err := emblem.Token(); err != nil {
+		t.Fatalf("convert emblem: %v", err)
+	} else if err := jwt.Validate(tok, jwt.WithValidator(EmblemValidator)); err != nil {
+		t.Fatalf("expected emblem to validate, got %v", err)
+	} else if decoded, err := EmblemFromToken(tok); err != nil {
+		t.Fatalf("read emblem: %v", err)
+	} else if decoded.Issuer != emblem.Issuer || len(decoded.Assets) != 2 {
+		t.Fatalf("unexpected emblem after roundtrip: %+v", decoded)
+	} else if *decoded.Constraints.Purpose != Protective || *decoded.Constraints.Distribution != DNS|TLS {
+		t.Fatalf("unexpected constraints after roundtrip: %+v", decoded.Constraints)
+	} else if !decoded.Expiration.Equal(nbf.Add(time.Hour)) {
+		t.Fatalf("unexpected exp after roundtrip: %v", decoded.Expiration)
+	}
+}
+
+func TestEmblemBuilderRejects(t *testing.T) {
+	now := time.Now()
+	if _, err := BuildEmblem().Build(); err != ErrAssets {
+		t.Fatalf("expected ErrAssets, got %v", err)
+	} else if _, err := BuildEmblem().WithAssets(parseAI(t, "example.com")).WithIssuer("http://example.com").Build(); err == nil {
+		t.Fatalf("expected illegal issuer to be rejected")
+	} else if _, err := BuildEmblem().WithAssets(parseAI(t, "example.com")).WithValidity(now, now).Build(); err != ErrValidity {
+		t.Fatalf("expected ErrValidity, got %v", err)
+	}
+}
+
+func TestEndorsementBuilderRoundtrip(t *testing.T) {
+	wnd := 60
+	endorsement, err := BuildEndorsement().
+		WithIssuer("https://authority.example").
+		WithSubject("https://example.com").
+		WithKey("kid").
+		WithEnd(true).
+		WithConstraints(EmblemConstraints{Window: &wnd}).
+		Build()
+	if err != nil {
+		t.Fatalf("build endorsement: %v", err)
+	}
+
+	if tok, err := endorsement.Token(); err != nil {
+		t.Fatalf("convert endorsement: %v", err)
+	} else if decoded, err := EndorsementFromToken(tok); err != nil {
+		t.Fatalf("read endorsement: %v", err)
+	} else if decoded.Subject != endorsement.Subject || decoded.Key != "kid" || !decoded.End {
+		t.Fatalf("unexpected endorsement after roundtrip: %+v", decoded)
+	} else if decoded.Constraints == nil || *decoded.Constraints.Window != wnd {
+		t.Fatalf("unexpected constraints after roundtrip: %+v", decoded.Constraints)
+	}
+}
+
+func TestEndorsementBuilderRejects(t *testing.T) {
+	if _, err := BuildEndorsement().WithLog(Log{}).WithIssuer("https://example.com").Build(); err != ErrLogEmpty {
+		t.Fatalf("expected ErrLogEmpty, got %v", err)
+	} else if _, err := BuildEndorsement().WithLog(Log{&LogConfig{Ver: "v1"}}).Build(); err != ErrLogNoIss {
+		t.Fatalf("expected ErrLogNoIss, got %v", err)
+	}
+}
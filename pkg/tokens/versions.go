@@ -0,0 +1,112 @@
+package tokens
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var ErrVersionRegistered = errors.New("version already registered")
+var ErrMixedVersions = errors.New("token versions must not be mixed")
+
+// VersionRules bundles everything that is specific to one version of ADEM,
+// i.e., one value of the "ver" claim.
+type VersionRules struct {
+	Version consts.Version
+	// Register the version's custom JWT claims. Called once when the version is
+	// registered. Note that claim registrations are global; versions must agree
+	// on the types of claims they share.
+	RegisterClaims func()
+	// Validators for emblems and endorsements. They need not check the "ver"
+	// claim.
+	EmblemValidator      jwt.Validator
+	EndorsementValidator jwt.Validator
+	// List all violations of an endorsement's constraints (see
+	// [ConstraintViolations]). The semantics of constraints are defined by the
+	// endorsement's version.
+	ConstraintViolations func(emblem jwt.Token, endorsement jwt.Token) []error
+	// Other versions whose endorsements may endorse emblems and endorsements of
+	// this version. Tokens of the same version are always compatible.
+	AcceptsEndorsementsOf []consts.Version
+}
+
+var registryLock sync.RWMutex
+var registry = map[consts.Version]*VersionRules{}
+
+// Register the rules of an ADEM version.
+func RegisterVersion(rules *VersionRules) error {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	if _, ok := registry[rules.Version]; ok {
+		return fmt.Errorf("%w: %s", ErrVersionRegistered, rules.Version)
+	}
+	if rules.RegisterClaims != nil {
+		rules.RegisterClaims()
+	}
+	registry[rules.Version] = rules
+	return nil
+}
+
+// Remove the rules of an ADEM version, e.g., of a version registered by a
+// test. Claims registered by the version's RegisterClaims are kept.
+func UnregisterVersion(ver consts.Version) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	delete(registry, ver)
+}
+
+// Look up the rules of an ADEM version.
+func LookupVersion(ver consts.Version) (*VersionRules, bool) {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	rules, ok := registry[ver]
+	return rules, ok
+}
+
+// List all registered ADEM versions.
+func Versions() []consts.Version {
+	registryLock.RLock()
+	defer registryLock.RUnlock()
+
+	versions := make([]consts.Version, 0, len(registry))
+	for ver := range registry {
+		versions = append(versions, ver)
+	}
+	slices.Sort(versions)
+	return versions
+}
+
+// Look up the rules of the version given by a token's "ver" claim.
+func RulesFor(t jwt.Token) (*VersionRules, error) {
+	var ver string
+	if err := t.Get("ver", &ver); err != nil {
+		return nil, ErrIllegalVersion
+	} else if rules, ok := LookupVersion(consts.Version(ver)); !ok {
+		return nil, fmt.Errorf("%w: %s", ErrIllegalVersion, ver)
+	} else {
+		return rules, nil
+	}
+}
+
+// Check whether an endorsement may endorse a token according to the rules of
+// the endorsed token's version.
+func CheckVersions(endorsed jwt.Token, endorsement jwt.Token) error {
+	if endorsedRules, err := RulesFor(endorsed); err != nil {
+		return err
+	} else if endorsementRules, err := RulesFor(endorsement); err != nil {
+		return err
+	} else if endorsedRules.Version == endorsementRules.Version {
+		return nil
+	} else if slices.Contains(endorsedRules.AcceptsEndorsementsOf, endorsementRules.Version) {
+		return nil
+	} else {
+		return fmt.Errorf("%w: %s token endorsed by %s endorsement", ErrMixedVersions, endorsedRules.Version, endorsementRules.Version)
+	}
+}
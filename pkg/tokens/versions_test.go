@@ -0,0 +1,59 @@
+package tokens
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+var errTestEmblem = errors.New("test emblem validator")
+
+func mkVersionedToken(t *testing.T, ver consts.Version) jwt.Token {
+	t.Helper()
+	tok := jwt.New()
+	if err := tok.Set("ver", string(ver)); err != nil {
+		t.Fatalf("set ver: %v", err)
+	}
+	return tok
+}
+
+func TestVersionRegistry(t *testing.T) {
+	next := consts.Version("v-next")
+	rules := &VersionRules{
+		Version: next,
+		EmblemValidator: jwt.ValidatorFunc(func(context.Context, jwt.Token) error {
+			return errTestEmblem
+		}),
+		EndorsementValidator: jwt.ValidatorFunc(func(context.Context, jwt.Token) error {
+			return nil
+		}),
+		AcceptsEndorsementsOf: []consts.Version{consts.V1},
+	}
+	if err := RegisterVersion(rules); err != nil {
+		t.Fatalf("register version: %v", err)
+	}
+	t.Cleanup(func() { UnregisterVersion(next) })
+	if err := RegisterVersion(rules); !errors.Is(err, ErrVersionRegistered) {
+		t.Fatalf("expected ErrVersionRegistered, got %v", err)
+	} else if !slices.Contains(Versions(), consts.V1) || !slices.Contains(Versions(), next) {
+		t.Fatalf("unexpected versions: %v", Versions())
+	}
+
+	if err := jwt.Validate(mkVersionedToken(t, next), jwt.WithValidator(EmblemValidator)); !errors.Is(err, errTestEmblem) {
+		t.Fatalf("expected dispatch to version validator, got %v", err)
+	} else if err := jwt.Validate(mkVersionedToken(t, "v0"), jwt.WithValidator(EmblemValidator)); !errors.Is(err, ErrIllegalVersion) {
+		t.Fatalf("expected ErrIllegalVersion for unknown version, got %v", err)
+	}
+
+	if err := CheckVersions(mkVersionedToken(t, next), mkVersionedToken(t, consts.V1)); err != nil {
+		t.Fatalf("expected v1 endorsement of %s token to be accepted, got %v", next, err)
+	} else if err := CheckVersions(mkVersionedToken(t, consts.V1), mkVersionedToken(t, next)); !errors.Is(err, ErrMixedVersions) {
+		t.Fatalf("expected ErrMixedVersions, got %v", err)
+	} else if err := CheckVersions(mkVersionedToken(t, consts.V1), mkVersionedToken(t, consts.V1)); err != nil {
+		t.Fatalf("expected same versions to be compatible, got %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package tokens
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"slices"
+
+	"github.com/lestrrat-go/jwx/v3/cert"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+var ErrNoCerts = errors.New("no certificates found")
+var ErrX5CKeyMismatch = errors.New("leaf certificate does not certify key")
+
+// Parse a PEM-encoded certificate chain. The first certificate must be the
+// leaf certificate; every further certificate must certify its predecessor.
+func ParseCertChain(bs []byte) (*cert.Chain, error) {
+	chain := &cert.Chain{}
+	for {
+		var block *pem.Block
+		block, bs = pem.Decode(bs)
+		if block == nil {
+			break
+		} else if block.Type != "CERTIFICATE" {
+			continue
+		} else if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+			return nil, err
+		} else if err := chain.AddString(base64.StdEncoding.EncodeToString(block.Bytes)); err != nil {
+			return nil, err
+		}
+	}
+
+	if chain.Len() == 0 {
+		return nil, ErrNoCerts
+	}
+	return chain, nil
+}
+
+// Decode the certificates of an x5c chain.
+func Certificates(chain *cert.Chain) ([]*x509.Certificate, error) {
+	certs := make([]*x509.Certificate, 0, chain.Len())
+	for i := range chain.Len() {
+		if raw, ok := chain.Get(i); !ok {
+			return nil, ErrNoCerts
+		} else if c, err := cert.Parse(raw); err != nil {
+			return nil, err
+		} else {
+			certs = append(certs, c)
+		}
+	}
+
+	if len(certs) == 0 {
+		return nil, ErrNoCerts
+	}
+	return certs, nil
+}
+
+// Check that the given certificate certifies the given key.
+func CertifiesKey(c *x509.Certificate, key jwk.Key) error {
+	if certKey, err := jwk.Import(c.PublicKey); err != nil {
+		return err
+	} else if certDigest, err := certKey.Thumbprint(crypto.SHA256); err != nil {
+		return err
+	} else if pk, err := key.PublicKey(); err != nil {
+		return err
+	} else if keyDigest, err := pk.Thumbprint(crypto.SHA256); err != nil {
+		return err
+	} else if !slices.Equal(certDigest, keyDigest) {
+		return ErrX5CKeyMismatch
+	}
+	return nil
+}
+
+// Attach an x5c certificate chain to a signing key. Signers include the chain
+// in the protected header of tokens signed by the key. The chain's leaf
+// certificate must certify the key.
+func SetX5C(key jwk.Key, chain *cert.Chain) error {
+	if certs, err := Certificates(chain); err != nil {
+		return err
+	} else if err := CertifiesKey(certs[0], key); err != nil {
+		return err
+	}
+	return key.Set(jwk.X509CertChainKey, chain)
+}
+
+// Extract the key certified by the leaf certificate of an x5c chain. The key
+// is assigned the given algorithm and its KID.
+func X5CKey(chain *cert.Chain, alg jwa.SignatureAlgorithm) (jwk.Key, error) {
+	if certs, err := Certificates(chain); err != nil {
+		return nil, err
+	} else if key, err := jwk.Import(certs[0].PublicKey); err != nil {
+		return nil, err
+	} else if err := key.Set(jwk.AlgorithmKey, alg); err != nil {
+		return nil, err
+	} else if _, err := SetKID(key, true); err != nil {
+		return nil, err
+	} else {
+		return key, nil
+	}
+}
@@ -0,0 +1,83 @@
+package tokens_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+func mkSelfSigned(t *testing.T, sk *ecdsa.PrivateKey) []byte {
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		DNSNames:     []string{"example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &sk.PublicKey, sk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestX5C(t *testing.T) {
+	sk, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chain, err := tokens.ParseCertChain(mkSelfSigned(t, sk))
+	if err != nil {
+		t.Fatalf("could not parse chain: %s", err)
+	} else if chain.Len() != 1 {
+		t.Fatalf("expected one certificate, got %d", chain.Len())
+	}
+
+	if _, err := tokens.ParseCertChain([]byte("no certificates")); !errors.Is(err, tokens.ErrNoCerts) {
+		t.Errorf("expected no certificates, got %v", err)
+	}
+
+	key, err := jwk.Import(sk)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := key.Set(jwk.AlgorithmKey, jwa.ES256()); err != nil {
+		t.Fatal(err)
+	} else if err := tokens.SetX5C(key, chain); err != nil {
+		t.Errorf("could not attach chain: %s", err)
+	} else if attached, ok := key.X509CertChain(); !ok || attached == nil || attached.Len() != 1 {
+		t.Error("chain not attached to key")
+	}
+
+	otherKey, err := jwk.Import(other)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := tokens.SetX5C(otherKey, chain); !errors.Is(err, tokens.ErrX5CKeyMismatch) {
+		t.Errorf("expected key mismatch, got %v", err)
+	}
+
+	if x5cKey, err := tokens.X5CKey(chain, jwa.ES256()); err != nil {
+		t.Errorf("could not extract key: %s", err)
+	} else if x5cKid, err := tokens.GetKID(x5cKey); err != nil {
+		t.Error(err)
+	} else if kid, err := tokens.CalcKID(key); err != nil {
+		t.Error(err)
+	} else if x5cKid != kid {
+		t.Errorf("expected kid %s, got %s", kid, x5cKid)
+	}
+}
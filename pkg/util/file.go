@@ -0,0 +1,32 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Write data to the named file such that readers either see the old or the
+// new contents, but never a partially written file. The data is written to a
+// temporary file in the same directory which then replaces the named file.
+func WriteFileAtomic(name string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	} else if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	} else if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	} else if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
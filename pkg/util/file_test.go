@@ -0,0 +1,33 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	name := filepath.Join(dir, "emblem.jws")
+	if err := os.WriteFile(name, []byte("old"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFileAtomic(name, []byte("new"), 0644); err != nil {
+		t.Fatalf("could not write file: %s", err)
+	} else if bs, err := os.ReadFile(name); err != nil {
+		t.Fatal(err)
+	} else if string(bs) != "new" {
+		t.Fatalf("expected new contents, got %q", bs)
+	} else if info, err := os.Stat(name); err != nil {
+		t.Fatal(err)
+	} else if info.Mode().Perm() != 0644 {
+		t.Fatalf("expected mode 0644, got %o", info.Mode().Perm())
+	}
+
+	if entries, err := os.ReadDir(dir); err != nil {
+		t.Fatal(err)
+	} else if len(entries) != 1 {
+		t.Fatalf("expected temporary file to be removed, got %d files", len(entries))
+	}
+}
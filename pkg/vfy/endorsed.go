@@ -9,19 +9,22 @@ import (
 	"github.com/lestrrat-go/jwx/v3/jwt"
 )
 
-func verifyEndorsed(emblem ADEMToken, root ADEMToken, endorsements []ADEMToken, trustedKeys jwk.Set) ([]VerificationResult, []string) {
+// Verify the endorsements of the emblem issuer's root key by other parties.
+// Returns the security levels, the issuers of the endorsements, and the
+// endorsements.
+func verifyEndorsed(emblem ADEMToken, root ADEMToken, endorsements []ADEMToken, trustedKeys jwk.Set) ([]VerificationResult, []string, []ADEMToken) {
 	rootIss, rootHasIss := root.Token.Issuer()
 	if !rootHasIss {
 		log.Printf("root endorsements misses issuer\n")
-		return []VerificationResult{INVALID}, nil
+		return []VerificationResult{INVALID}, nil, nil
 	}
 
 	issuers := []string{}
+	endorsing := []ADEMToken{}
 	trustedFound := false
 	existsEndorsement := false
 	for _, endorsement := range endorsements {
 		var end bool
-		var endLog tokens.Log
 		if endorsedKID, err := tokens.GetEndorsedKID(endorsement.Token); err != nil {
 			continue
 		} else if endSub, ok := endorsement.Token.Subject(); !ok {
@@ -37,19 +40,20 @@ func verifyEndorsed(emblem ADEMToken, root ADEMToken, endorsements []ADEMToken,
 			}
 		} else if !end {
 			continue
-		} else if err := endorsement.Token.Get("log", &endLog); err != nil {
-			if !errors.Is(err, jwt.ClaimNotFoundError()) {
-				log.Printf("could not access log claim: %s\n", err)
-			}
+		} else if endorsement.Commitment == NO_COMMITMENT {
 			continue
 		} else if root.VerificationKid != endorsedKID {
 			continue
+		} else if err := tokens.CheckVersions(root.Token, endorsement.Token); err != nil {
+			log.Printf("illegal endorsement: %s\n", err)
+			return []VerificationResult{INVALID}, nil, nil
 		} else if err := tokens.VerifyConstraints(emblem.Token, endorsement.Token); err != nil {
 			log.Printf("emblem does not comply with endorsement constraints: %s", err)
-			return []VerificationResult{INVALID}, nil
+			return []VerificationResult{INVALID}, nil, nil
 		} else {
 			existsEndorsement = true
 			issuers = append(issuers, endIss)
+			endorsing = append(endorsing, endorsement)
 			_, found := trustedKeys.LookupKeyID(endorsement.VerificationKid)
 			trustedFound = trustedFound || found
 		}
@@ -60,8 +64,8 @@ func verifyEndorsed(emblem ADEMToken, root ADEMToken, endorsements []ADEMToken,
 		if trustedFound {
 			results = append(results, ENDORSED_TRUSTED)
 		}
-		return results, issuers
+		return results, issuers, endorsing
 	} else {
-		return []VerificationResult{}, nil
+		return []VerificationResult{}, nil, nil
 	}
 }
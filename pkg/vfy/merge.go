@@ -0,0 +1,174 @@
+package vfy
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/cose"
+	"github.com/adem-wg/adem-proto/pkg/ident"
+	"github.com/adem-wg/adem-proto/pkg/util"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jws"
+)
+
+// Check whether a token's header declares it an emblem. Does not verify the
+// token.
+func isEmblem(rawToken []byte) bool {
+	rawToken = bytes.TrimSpace(rawToken)
+	var cty string
+	if cose.IsCOSE(rawToken) {
+		if msg, err := cose.Parse(rawToken); err == nil {
+			cty, _ = msg.ContentType()
+		}
+	} else if msg, err := jws.Parse(rawToken); err == nil && len(msg.Signatures()) == 1 {
+		cty, _ = msg.Signatures()[0].ProtectedHeaders().ContentType()
+	}
+	return cty == string(consts.EmblemCty)
+}
+
+// Return the tokens that declare themselves emblems.
+func filterEmblems(rawTokens [][]byte) [][]byte {
+	emblems := [][]byte{}
+	for _, t := range rawTokens {
+		if isEmblem(t) {
+			emblems = append(emblems, t)
+		}
+	}
+	return emblems
+}
+
+// Check that several emblems are parts of one split emblem, i.e., that they
+// state the same issuer and are either all signed by the same key or all
+// unsigned. Does not verify the emblems.
+func checkSplitEmblems(emblems [][]byte) error {
+	var iss, kid string
+	var unsigned bool
+	for i, emblem := range emblems {
+		emblem = bytes.TrimSpace(emblem)
+		body, err := ParseUnverified(emblem)
+		if err != nil {
+			return fmt.Errorf("emblem %d: %w", i+1, err)
+		}
+
+		var emblemKid string
+		emblemUnsigned := isUnsigned(emblem)
+		if !emblemUnsigned {
+			if emblemKid, err = VerificationKID(emblem); err != nil {
+				return fmt.Errorf("emblem %d: %w", i+1, err)
+			}
+		}
+
+		if emblemIss, _ := body.Issuer(); i == 0 {
+			iss, kid, unsigned = emblemIss, emblemKid, emblemUnsigned
+		} else if emblemIss != iss {
+			return fmt.Errorf("emblem %d: %w", i+1, ErrEmblemsIssuer)
+		} else if emblemUnsigned != unsigned {
+			return fmt.Errorf("emblem %d: %w", i+1, ErrEmblemsUnsigned)
+		} else if emblemKid != kid {
+			return fmt.Errorf("emblem %d: %w", i+1, ErrEmblemsKey)
+		}
+	}
+	return nil
+}
+
+// Check whether a token is an unsecured JWS (alg "none"). Does not verify the
+// token.
+func isUnsigned(rawToken []byte) bool {
+	if cose.IsCOSE(rawToken) {
+		return false
+	} else if msg, err := jws.Parse(rawToken); err != nil || len(msg.Signatures()) != 1 {
+		return false
+	} else {
+		alg, ok := msg.Signatures()[0].ProtectedHeaders().Algorithm()
+		return ok && alg == jwa.NoSignature()
+	}
+}
+
+// Merge the results of emblems that were verified one by one. Assets are
+// protected if any valid emblem protects them. The merged security levels are
+// those shared by all valid emblems; the issuer, commitment, endorsements, and
+// extension claims are kept if all valid emblems agree on them. The token set
+// is invalid if no emblem is valid or the valid emblems share no security
+// level.
+func mergeResults(parts []VerificationResults) VerificationResults {
+	var merged *VerificationResults
+	for _, part := range parts {
+		if util.Contains(part.results, INVALID) {
+			continue
+		} else if merged == nil {
+			merged = &VerificationResults{
+				results:    slices.Clone(part.results),
+				protected:  part.protected,
+				issuer:     part.issuer,
+				endorsedBy: part.endorsedBy,
+				commitment: part.commitment,
+				extensions: maps.Clone(part.extensions),
+			}
+			continue
+		}
+
+		merged.results = slices.DeleteFunc(merged.results, func(r VerificationResult) bool {
+			return !util.Contains(part.results, r)
+		})
+		merged.protected = merged.protected.Union(part.protected)
+		if merged.issuer != part.issuer {
+			merged.issuer = ""
+		}
+		if merged.commitment != part.commitment {
+			merged.commitment = NO_COMMITMENT
+		}
+		if !slices.Equal(merged.endorsedBy, part.endorsedBy) {
+			merged.endorsedBy = nil
+		}
+		maps.DeleteFunc(merged.extensions, func(name string, val any) bool {
+			partVal, ok := part.extensions[name]
+			return !ok || !reflect.DeepEqual(val, partVal)
+		})
+	}
+
+	if merged == nil {
+		log.Print("no emblem is valid")
+		return ResultInvalid()
+	} else if len(merged.results) == 0 {
+		log.Print("emblems share no security level")
+		return ResultInvalid()
+	}
+	merged.emblems = parts
+	return *merged
+}
+
+// Print the results of several emblems. Emblems with equal results are
+// grouped, and their protected assets are merged.
+func (res VerificationResults) printMerged() {
+	lns := []string{fmt.Sprintf("Verified set of tokens with %d emblems. Results per asset:", len(res.emblems))}
+	groups := []string{}
+	assets := map[string]ident.AssetSet{}
+	invalid := 0
+	for _, part := range res.emblems {
+		if util.Contains(part.results, INVALID) {
+			invalid++
+			continue
+		}
+
+		desc := strings.Join(append([]string{part.describeLevels()}, part.describe()...), "\n  ")
+		if _, ok := assets[desc]; !ok {
+			groups = append(groups, desc)
+		}
+		assets[desc] = assets[desc].Union(part.protected)
+	}
+
+	for _, desc := range groups {
+		lns = append(lns, fmt.Sprintf("- Protected assets:   %s", assets[desc].MinimalCover()))
+		lns = append(lns, "  "+desc)
+	}
+	if invalid > 0 {
+		lns = append(lns, fmt.Sprintf("- Invalid emblems:    %d", invalid))
+	}
+	log.Print(strings.Join(lns, "\n"))
+}
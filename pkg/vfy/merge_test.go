@@ -0,0 +1,152 @@
+package vfy
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/adem-wg/adem-proto/pkg/ident"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+func mustParseAI(t *testing.T, asset string) *ident.AI {
+	t.Helper()
+	ai, err := ident.ParseAI(asset)
+	if err != nil {
+		t.Fatalf("parse AI: %v", err)
+	}
+	return ai
+}
+
+func TestMergeSplitEmblems(t *testing.T) {
+	if err := tokens.RegisterClaim(tokens.ClaimExtension{Name: "x-contact"}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	t.Cleanup(func() { tokens.UnregisterClaim("x-contact") })
+
+	// Emblems with issuer require a root key commitment; trust the key instead
+	key := mkKey(t)
+	parts := [][]byte{}
+	for _, asset := range []string{"a.example.com", "b.example.com"} {
+		token := mkEmblemToken(t, "", asset)
+		if err := token.Set("x-contact", "noc@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, signEmblem(t, key, token))
+	}
+
+	res := VerifyTokens(parts, mkKeySet(t, key))
+	if len(res.Results()) == 0 || slices.Contains(res.Results(), INVALID) {
+		t.Fatalf("expected split emblem to verify, got %v", res.Results())
+	} else if res.extensions["x-contact"] != "noc@example.com" {
+		t.Errorf("expected shared extension claims, got %v", res.extensions)
+	}
+
+	for _, asset := range []string{"a.example.com", "b.example.com"} {
+		if levels := res.ResultsFor(mustParseAI(t, asset)); !slices.Equal(levels, res.Results()) {
+			t.Errorf("%s: expected %v, got %v", asset, res.Results(), levels)
+		}
+	}
+	if levels := res.ResultsFor(mustParseAI(t, "c.example.com")); levels != nil {
+		t.Errorf("expected c.example.com not to be protected, got %v", levels)
+	}
+}
+
+func TestMergeEndorsedSplitEmblems(t *testing.T) {
+	root, key := mkKey(t), mkKey(t)
+	endorsement := mkEndorsement(t, root, key, tokens.BuildEndorsement(), true)
+	// Parts whose signature does not verify count as invalid emblems
+	forged := mkEmblem(t, key, "", "c.example.com")
+	forged = append(forged[:len(forged)-4], "AAAA"...)
+	parts := [][]byte{
+		mkEmblem(t, key, "", "a.example.com"),
+		endorsement,
+		mkEmblem(t, key, "", "b.example.com"),
+		forged,
+	}
+
+	res := VerifyTokens(parts, mkKeySet(t, root))
+	if !slices.Equal(res.Results(), []VerificationResult{SIGNED, SIGNED_TRUSTED}) {
+		t.Fatalf("expected split emblem to verify, got %v", res.Results())
+	} else if len(res.emblems) != 3 || !res.Joins(endorsement) {
+		t.Errorf("expected three emblems based on the endorsement, got %d", len(res.emblems))
+	} else if res.ResultsFor(mustParseAI(t, "c.example.com")) != nil {
+		t.Error("expected forged emblem to protect nothing")
+	}
+}
+
+func TestMergeForeignEmblems(t *testing.T) {
+	key, other := mkKey(t), mkKey(t)
+	emblem := mkEmblem(t, key, "https://example.com", "a.example.com")
+
+	tests := []struct {
+		name    string
+		other   []byte
+		trusted jwk.Set
+	}{
+		{"other key", mkEmblem(t, other, "https://example.com", "b.example.com"), mkKeySet(t, key, other)},
+		{"other issuer", mkEmblem(t, key, "https://example.org", "b.example.com"), mkKeySet(t, key)},
+		{"unsigned", mkEmblem(t, nil, "https://example.com", "b.example.com"), mkKeySet(t, key)},
+	}
+	for _, test := range tests {
+		res := VerifyTokens([][]byte{emblem, test.other}, test.trusted)
+		if !slices.Equal(res.Results(), []VerificationResult{INVALID}) {
+			t.Errorf("%s: expected INVALID, got %v", test.name, res.Results())
+		} else if res.ResultsFor(mustParseAI(t, "a.example.com")) != nil {
+			t.Errorf("%s: expected no asset to be protected", test.name)
+		}
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	a := VerificationResults{
+		results:    []VerificationResult{SIGNED, ORGANIZATIONAL, ENDORSED},
+		protected:  ident.AssetSet{mustParseAI(t, "a.example.com")},
+		issuer:     "https://example.com",
+		extensions: map[string]any{"x-contact": "noc@example.com", "x-note": "a"},
+	}
+	b := VerificationResults{
+		results:    []VerificationResult{SIGNED, ORGANIZATIONAL},
+		protected:  ident.AssetSet{mustParseAI(t, "b.example.com")},
+		issuer:     "https://example.com",
+		extensions: map[string]any{"x-contact": "noc@example.com", "x-note": "b"},
+	}
+
+	merged := mergeResults([]VerificationResults{a, b, ResultInvalid()})
+	if !slices.Equal(merged.Results(), []VerificationResult{SIGNED, ORGANIZATIONAL}) {
+		t.Errorf("expected shared levels, got %v", merged.Results())
+	} else if len(merged.extensions) != 1 || merged.extensions["x-contact"] != "noc@example.com" {
+		t.Errorf("expected only shared extension claims, got %v", merged.extensions)
+	} else if levels := merged.ResultsFor(mustParseAI(t, "a.example.com")); !slices.Equal(levels, a.results) {
+		t.Errorf("expected levels of first emblem, got %v", levels)
+	}
+
+	unsigned := VerificationResults{results: []VerificationResult{UNSIGNED}}
+	if merged := mergeResults([]VerificationResults{a, unsigned}); !slices.Equal(merged.Results(), []VerificationResult{INVALID}) {
+		t.Errorf("expected emblems without shared level to be invalid, got %v", merged.Results())
+	}
+	if merged := mergeResults([]VerificationResults{ResultInvalid(), ResultInvalid()}); !slices.Equal(merged.Results(), []VerificationResult{INVALID}) {
+		t.Errorf("expected invalid emblems to be invalid, got %v", merged.Results())
+	}
+}
+
+func TestMergeUnsignedSplitEmblems(t *testing.T) {
+	parts := [][]byte{
+		mkEmblem(t, nil, "https://example.com", "a.example.com"),
+		mkEmblem(t, nil, "https://example.com", "b.example.com"),
+	}
+	res := VerifyTokens(parts, nil)
+	if !slices.Equal(res.Results(), []VerificationResult{UNSIGNED}) {
+		t.Fatalf("expected split unsigned emblem to verify, got %v", res.Results())
+	}
+	for _, asset := range []string{"a.example.com", "b.example.com"} {
+		if levels := res.ResultsFor(mustParseAI(t, asset)); !slices.Equal(levels, []VerificationResult{UNSIGNED}) {
+			t.Errorf("%s: expected UNSIGNED, got %v", asset, levels)
+		}
+	}
+
+	parts = append(parts, mkEmblem(t, nil, "https://example.org", "c.example.com"))
+	if res := VerifyTokens(parts, nil); !slices.Equal(res.Results(), []VerificationResult{INVALID}) {
+		t.Errorf("expected unsigned emblems of different issuers to be invalid, got %v", res.Results())
+	}
+}
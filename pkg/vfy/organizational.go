@@ -9,7 +9,10 @@ import (
 	"github.com/lestrrat-go/jwx/v3/jwt"
 )
 
-func verifySignedOrganizational(emblem ADEMToken, endorsements []ADEMToken, trustedKeys jwk.Set) ([]VerificationResult, *ADEMToken) {
+// Verify the chain of endorsements from the emblem's verification key up to
+// its root key. Returns the security levels, the root key's token, and the
+// endorsements of the chain.
+func verifySignedOrganizational(emblem ADEMToken, endorsements []ADEMToken, trustedKeys jwk.Set) ([]VerificationResult, *ADEMToken, []ADEMToken) {
 	embIss, embHasIss := emblem.Token.Issuer()
 	endorsedBy := make(map[string]ADEMToken)
 	for _, endorsement := range endorsements {
@@ -33,13 +36,14 @@ func verifySignedOrganizational(emblem ADEMToken, endorsements []ADEMToken, trus
 			continue
 		} else if _, ok := endorsedBy[endorsedKid]; ok {
 			log.Println("illegal branch in endorsements")
-			return []VerificationResult{INVALID}, nil
+			return []VerificationResult{INVALID}, nil, nil
 		} else {
 			endorsedBy[endorsedKid] = endorsement
 		}
 	}
 
 	var root *ADEMToken
+	chain := []ADEMToken{}
 	trustedFound := false
 	last := emblem
 	for root == nil {
@@ -48,10 +52,14 @@ func verifySignedOrganizational(emblem ADEMToken, endorsements []ADEMToken, trus
 		}
 
 		if endorsing, ok := endorsedBy[last.VerificationKid]; ok {
-			if err := tokens.VerifyConstraints(emblem.Token, endorsing.Token); err != nil {
+			if err := tokens.CheckVersions(last.Token, endorsing.Token); err != nil {
+				log.Printf("illegal endorsement: %s\n", err)
+				return []VerificationResult{INVALID}, nil, nil
+			} else if err := tokens.VerifyConstraints(emblem.Token, endorsing.Token); err != nil {
 				log.Printf("emblem does not comply with endorsement constraints: %s\n", err)
-				return []VerificationResult{INVALID}, nil
+				return []VerificationResult{INVALID}, nil, nil
 			} else {
+				chain = append(chain, endorsing)
 				last = endorsing
 			}
 		} else {
@@ -64,15 +72,15 @@ func verifySignedOrganizational(emblem ADEMToken, endorsements []ADEMToken, trus
 		results = append(results, SIGNED_TRUSTED)
 	}
 
-	rootLogged := root.Token.Has("log")
-	if embHasIss && !rootLogged {
+	rootCommitted := root.Commitment != NO_COMMITMENT
+	if embHasIss && !rootCommitted {
 		log.Print("emblem contains issuer but provides no root key commitment")
-		return []VerificationResult{INVALID}, nil
-	} else if rootLogged {
+		return []VerificationResult{INVALID}, nil, nil
+	} else if rootCommitted {
 		results = append(results, ORGANIZATIONAL)
 		if _, ok := trustedKeys.LookupKeyID(root.VerificationKid); ok {
 			results = append(results, ORGANIZATIONAL_TRUSTED)
 		}
 	}
-	return results, root
+	return results, root, chain
 }
@@ -1,7 +1,11 @@
 package vfy
 
 import (
+	"encoding/json"
+	"fmt"
+
 	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/cose"
 	"github.com/adem-wg/adem-proto/pkg/tokens"
 	"github.com/lestrrat-go/jwx/v3/jwk"
 	"github.com/lestrrat-go/jwx/v3/jws"
@@ -12,6 +16,13 @@ type ADEMToken struct {
 	IsEndorsement   bool
 	VerificationKid string
 	Token           jwt.Token
+	Unsigned        bool
+	// How the token's verification key is bound to its issuer, if it is a root
+	// key.
+	Commitment Commitment
+	// The token's encoding, i.e., the compact JWS of its signature or the COSE
+	// message.
+	Raw []byte
 }
 
 func VerifierFor(token []byte, key jwk.Key) TokenVerifier {
@@ -27,29 +38,203 @@ func VerifierFor(token []byte, key jwk.Key) TokenVerifier {
 				return nil, err
 			} else if len(msg.Signatures()) != 1 {
 				return nil, ErrTokenNonCompact
-			} else if body, err := jwt.Parse(payload, jwt.WithVerify(false)); err != nil {
+			} else if body, err := parseBody(msg.Signatures()[0].ProtectedHeaders(), payload); err != nil {
 				return nil, err
 			} else {
 				headers := msg.Signatures()[0].ProtectedHeaders()
-				var isEndorsement bool
-				if cty, ok := headers.ContentType(); !ok {
-					return nil, ErrCty
-				} else if cty == string(consts.EmblemCty) {
-					isEndorsement = false
-					if err := jwt.Validate(body, jwt.WithValidator(tokens.EmblemValidator)); err != nil {
-						return nil, err
-					}
-				} else if cty == string(consts.EndorsementCty) {
-					isEndorsement = true
-					if err := jwt.Validate(body, jwt.WithValidator(tokens.EndorsementValidator)); err != nil {
-						return nil, err
-					}
-				} else {
-					return nil, ErrCty
+				cty, _ := headers.ContentType()
+				isEndorsement, err := validateBody(cty, body)
+				if err != nil {
+					return nil, err
+				} else if err := checkCritical(headers, body); err != nil {
+					return nil, err
 				}
 
-				return &ADEMToken{isEndorsement, kid, body}, nil
+				return &ADEMToken{isEndorsement, kid, body, false, NO_COMMITMENT, token}, nil
 			}
 		},
 	}
 }
+
+// Return a verifier for a COSE-encoded token parsed from raw.
+func COSEVerifierFor(raw []byte, msg *cose.Message, key jwk.Key) TokenVerifier {
+	return TokenVerifier{
+		Verify: func() (*ADEMToken, error) {
+			if kid, err := tokens.GetKID(key); err != nil {
+				return nil, err
+			} else if err := msg.Verify(key); err != nil {
+				return nil, err
+			} else if body, err := msg.Claims(); err != nil {
+				return nil, err
+			} else {
+				cty, _ := msg.ContentType()
+				isEndorsement, err := validateBody(cty, body)
+				if err != nil {
+					return nil, err
+				} else if err := checkCriticalCOSE(msg, body); err != nil {
+					return nil, err
+				}
+
+				return &ADEMToken{isEndorsement, kid, body, false, NO_COMMITMENT, raw}, nil
+			}
+		},
+	}
+}
+
+// Validate a token's claims according to its content type. Returns whether
+// the token is an endorsement.
+func validateBody(cty string, body jwt.Token) (bool, error) {
+	switch cty {
+	case string(consts.EmblemCty):
+		return false, jwt.Validate(body, jwt.WithValidator(tokens.EmblemValidator))
+	case string(consts.EndorsementCty):
+		return true, jwt.Validate(body, jwt.WithValidator(tokens.EndorsementValidator))
+	default:
+		return false, ErrCty
+	}
+}
+
+// Parse the body of a signed JWS. Co-signers of endorsements state their own
+// issuer and root key commitment as "iss" and "log" parameters of their
+// signature's protected header. They replace the respective claims of the
+// shared payload; co-signers without "log" parameter commit to no root key.
+func parseBody(headers jws.Headers, payload []byte) (jwt.Token, error) {
+	body, err := jwt.Parse(payload, jwt.WithVerify(false))
+	if err != nil {
+		return nil, err
+	} else if cty, _ := headers.ContentType(); cty != string(consts.EndorsementCty) {
+		return body, nil
+	} else if !headers.Has(jwt.IssuerKey) {
+		return body, nil
+	}
+
+	var iss string
+	if err := headers.Get(jwt.IssuerKey, &iss); err != nil {
+		return nil, err
+	} else if err := body.Set(jwt.IssuerKey, iss); err != nil {
+		return nil, err
+	} else if err := body.Remove("log"); err != nil {
+		return nil, err
+	}
+
+	var rawLog any
+	var logs tokens.Log
+	if err := headers.Get("log", &rawLog); err == nil {
+		if bs, err := json.Marshal(rawLog); err != nil {
+			return nil, err
+		} else if err := json.Unmarshal(bs, &logs); err != nil {
+			return nil, err
+		} else if err := body.Set("log", logs); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
+
+// Reject tokens whose "crit" header lists header parameters other than
+// "adem-crit", or whose "adem-crit" header lists claims that are not
+// understood.
+func checkCritical(headers jws.Headers, body jwt.Token) error {
+	if crit, ok := headers.Critical(); ok {
+		for _, name := range crit {
+			if name != tokens.CriticalHeader {
+				return fmt.Errorf("%w: %s", ErrUnknownCriticalHeader, name)
+			} else if !headers.Has(name) {
+				return fmt.Errorf("%w: %s", ErrCriticalHeaderMissing, name)
+			}
+		}
+	}
+
+	if !headers.Has(tokens.CriticalHeader) {
+		return nil
+	}
+	var crit []string
+	if err := headers.Get(tokens.CriticalHeader, &crit); err != nil {
+		return fmt.Errorf("illegal %s header: %w", tokens.CriticalHeader, err)
+	}
+	return tokens.CheckCritical(crit, body)
+}
+
+// Like [checkCritical] for the protected header of COSE-encoded tokens.
+func checkCriticalCOSE(msg *cose.Message, body jwt.Token) error {
+	if labels, err := msg.Critical(); err != nil {
+		return err
+	} else {
+		for _, label := range labels {
+			if label != tokens.CriticalHeader {
+				return fmt.Errorf("%w: %v", ErrUnknownCriticalHeader, label)
+			}
+		}
+	}
+
+	if crit, ok, err := msg.CriticalClaims(); err != nil {
+		return err
+	} else if !ok {
+		return nil
+	} else {
+		return tokens.CheckCritical(crit, body)
+	}
+}
+
+// Parse an unsecured JWS (alg "none") as unsigned emblem. Endorsements must
+// always be signed.
+func parseUnsigned(msg *jws.Message) (*ADEMToken, error) {
+	sig := msg.Signatures()[0]
+	if len(sig.Signature()) != 0 {
+		return nil, ErrUnsignedSignature
+	} else if cty, ok := sig.ProtectedHeaders().ContentType(); !ok {
+		return nil, ErrCty
+	} else if cty == string(consts.EndorsementCty) {
+		return nil, ErrUnsignedEndorsement
+	} else if cty != string(consts.EmblemCty) {
+		return nil, ErrCty
+	} else if body, err := jwt.Parse(msg.Payload(), jwt.WithVerify(false)); err != nil {
+		return nil, err
+	} else if err := jwt.Validate(body, jwt.WithValidator(tokens.EmblemValidator)); err != nil {
+		return nil, err
+	} else if err := checkCritical(sig.ProtectedHeaders(), body); err != nil {
+		return nil, err
+	} else {
+		return &ADEMToken{false, "", body, true, NO_COMMITMENT, nil}, nil
+	}
+}
+
+// Parse a token's claims without verifying its signature or validating its
+// claims.
+func ParseUnverified(rawToken []byte) (jwt.Token, error) {
+	if cose.IsCOSE(rawToken) {
+		if msg, err := cose.Parse(rawToken); err != nil {
+			return nil, err
+		} else {
+			return msg.Claims()
+		}
+	} else if msg, err := jws.Parse(rawToken); err != nil {
+		return nil, err
+	} else {
+		return jwt.Parse(msg.Payload(), jwt.WithVerify(false))
+	}
+}
+
+// Return the KID of a token's verification key without verifying the token.
+// Tokens in JWS JSON serialization are not supported.
+func VerificationKID(rawToken []byte) (string, error) {
+	if cose.IsCOSE(rawToken) {
+		if msg, err := cose.Parse(rawToken); err != nil {
+			return "", err
+		} else if kid, ok := msg.KeyID(); !ok {
+			return "", cose.ErrNoKid
+		} else {
+			return kid, nil
+		}
+	} else if msg, err := jws.Parse(rawToken); err != nil {
+		return "", err
+	} else if len(msg.Signatures()) != 1 {
+		return "", ErrTokenNonCompact
+	} else if kid, ok := msg.Signatures()[0].ProtectedHeaders().KeyID(); ok {
+		return kid, nil
+	} else if key, ok := msg.Signatures()[0].ProtectedHeaders().JWK(); ok && key != nil {
+		return tokens.SetKID(key, true)
+	} else {
+		return "", ErrNoKeyFound
+	}
+}
@@ -3,9 +3,13 @@ package vfy
 import (
 	"errors"
 	"fmt"
+	"log"
 
+	"github.com/adem-wg/adem-proto/pkg/cose"
 	"github.com/adem-wg/adem-proto/pkg/roots"
 	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/cert"
+	"github.com/lestrrat-go/jwx/v3/jwa"
 	"github.com/lestrrat-go/jwx/v3/jwk"
 	"github.com/lestrrat-go/jwx/v3/jws"
 	"github.com/lestrrat-go/jwx/v3/jwt"
@@ -19,9 +23,12 @@ type TokenSet struct {
 	verified     map[string]bool
 	dependencies map[string][]TokenVerifier
 	keyMaterial  jwk.Set
-	roots        []ADEMToken
-	results      []ADEMToken
-	errors       []error
+	// Tokens whose verification key is not yet known by KID. They are added
+	// again once an endorsement embeds the key.
+	pending map[string][][]byte
+	roots   []ADEMToken
+	results []ADEMToken
+	errors  []error
 }
 
 func NewTokenSet(keyMaterial jwk.Set) TokenSet {
@@ -29,6 +36,7 @@ func NewTokenSet(keyMaterial jwk.Set) TokenSet {
 	th.verified = make(map[string]bool)
 	th.dependencies = make(map[string][]TokenVerifier)
 	th.keyMaterial = keyMaterial
+	th.pending = make(map[string][][]byte)
 	th.roots = make([]ADEMToken, 0)
 	th.results = make([]ADEMToken, 0)
 	th.errors = make([]error, 0)
@@ -36,18 +44,32 @@ func NewTokenSet(keyMaterial jwk.Set) TokenSet {
 }
 
 func (th *TokenSet) AddToken(rawToken []byte) error {
-	if msg, err := jws.Parse(rawToken); err != nil {
+	if cose.IsCOSE(rawToken) {
+		return th.addCOSEToken(rawToken)
+	} else if tokens.IsGeneralJWS(rawToken) {
+		return th.addGeneralToken(rawToken)
+	} else if msg, err := jws.Parse(rawToken); err != nil {
 		return err
 	} else if len(msg.Signatures()) != 1 {
 		return ErrTokenNonCompact
+	} else if alg, ok := msg.Signatures()[0].ProtectedHeaders().Algorithm(); ok && alg == jwa.NoSignature() {
+		if t, err := parseUnsigned(msg); err != nil {
+			return err
+		} else {
+			th.results = append(th.results, *t)
+			return nil
+		}
 	} else {
 		headers := msg.Signatures()[0].ProtectedHeaders()
 		var verificationKey jwk.Key
 		if headerKid, ok := headers.KeyID(); ok {
 			if kidKey, ok := th.keyMaterial.LookupKeyID(headerKid); ok {
 				verificationKey = kidKey
+			} else if x5cKey, ok := keyFromX5C(headers, headerKid); ok {
+				verificationKey = x5cKey
 			} else {
-				return ErrNoKeyFound
+				th.pending[headerKid] = append(th.pending[headerKid], rawToken)
+				return nil
 			}
 		} else if headerKey, ok := headers.JWK(); headerKey != nil && ok {
 			verificationKey = headerKey
@@ -55,41 +77,171 @@ func (th *TokenSet) AddToken(rawToken []byte) error {
 			return ErrNoKeyFound
 		}
 
-		if verificationKid, err := tokens.SetKID(verificationKey, true); err != nil {
+		if body, err := parseBody(headers, msg.Payload()); err != nil {
 			return err
 		} else {
-			verifier := VerifierFor(rawToken, verificationKey)
-			var logs tokens.Log
-			if body, err := jwt.Parse(msg.Payload(), jwt.WithVerify(false)); err != nil {
-				return err
-			} else if err := body.Get("log", &logs); err != nil && !errors.Is(err, jwt.ClaimNotFoundError()) {
+			chain, _ := headers.X509CertChain()
+			return th.addVerifier(verificationKey, VerifierFor(rawToken, verificationKey), body, chain)
+		}
+	}
+}
+
+// Get the verification key certified by the token's x5c certificate chain, if
+// it matches the given KID.
+func keyFromX5C(headers jws.Headers, kid string) (jwk.Key, bool) {
+	if chain, ok := headers.X509CertChain(); !ok || chain == nil {
+		return nil, false
+	} else if alg, ok := headers.Algorithm(); !ok {
+		return nil, false
+	} else if key, err := tokens.X5CKey(chain, alg); err != nil {
+		return nil, false
+	} else if x5cKid, _ := tokens.GetKID(key); x5cKid != kid {
+		return nil, false
+	} else {
+		return key, true
+	}
+}
+
+// Add a token in JWS JSON serialization, e.g., an endorsement signed by several
+// authorities. Every signature is treated as a token of its own. Signatures
+// added to the first one must state their signer's issuer in their protected
+// header (see [parseBody]).
+func (th *TokenSet) addGeneralToken(rawToken []byte) error {
+	if general, err := tokens.ParseGeneralJWS(rawToken); err != nil {
+		return err
+	} else {
+		errs := []error{}
+		for i, compact := range general.Compact() {
+			if i > 0 && !statesIssuer(compact) {
+				errs = append(errs, ErrCosignatureNoIss)
+			} else if err := th.AddToken(compact); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		return errors.Join(errs...)
+	}
+}
+
+// Check whether the protected header of a JWS in compact serialization states
+// an issuer.
+func statesIssuer(compact []byte) bool {
+	if msg, err := jws.Parse(compact); err != nil || len(msg.Signatures()) != 1 {
+		return false
+	} else {
+		return msg.Signatures()[0].ProtectedHeaders().Has(jwt.IssuerKey)
+	}
+}
+
+// Add a COSE-encoded token. COSE-encoded tokens reference their verification
+// key by KID only.
+func (th *TokenSet) addCOSEToken(rawToken []byte) error {
+	if msg, err := cose.Parse(rawToken); err != nil {
+		return err
+	} else if kid, ok := msg.KeyID(); !ok {
+		return ErrNoKeyFound
+	} else if key, ok := th.keyMaterial.LookupKeyID(kid); !ok {
+		th.pending[kid] = append(th.pending[kid], rawToken)
+		return nil
+	} else if body, err := msg.Claims(); err != nil {
+		return err
+	} else {
+		return th.addVerifier(key, COSEVerifierFor(rawToken, msg, key), body, nil)
+	}
+}
+
+// Register the verifier of a token with the given unverified body. Tokens that
+// commit to a root key are verified immediately. This includes tokens whose
+// x5c certificate chain binds their key to their issuer, if x5c trust anchors
+// are configured. All other tokens, including tokens whose chain does not bind
+// their key, are verified once their verification key was verified.
+func (th *TokenSet) addVerifier(verificationKey jwk.Key, verifier TokenVerifier, body jwt.Token, chain *cert.Chain) error {
+	if err := th.addEmbeddedKey(body); err != nil {
+		return err
+	} else if verificationKid, err := tokens.SetKID(verificationKey, true); err != nil {
+		return err
+	} else {
+		var logs tokens.Log
+		if err := body.Get("log", &logs); err != nil && !errors.Is(err, jwt.ClaimNotFoundError()) {
+			return err
+		} else if err == nil {
+			if len(logs) == 0 {
+				return ErrLogsEmpty
+			} else if iss, ok := body.Issuer(); !ok {
+				return ErrNoIss
+			} else if t, err := verifier.Verify(); err != nil {
 				return err
-			} else if err == nil {
-				if len(logs) == 0 {
-					return ErrLogsEmpty
-				} else if iss, ok := body.Issuer(); !ok {
-					return ErrNoIss
-				} else if t, err := verifier.Verify(); err != nil {
-					return err
-				} else {
-					for _, r := range roots.VerifyBindingCerts(iss, verificationKey, logs) {
-						if !r.Ok {
-							return ErrRootKeyUnbound
-						}
+			} else {
+				for _, r := range roots.VerifyBindingCerts(iss, verificationKey, logs) {
+					if !r.Ok {
+						return ErrRootKeyUnbound
 					}
-					th.roots = append(th.roots, *t)
 				}
+				t.Commitment = CT_COMMITMENT
+				th.roots = append(th.roots, *t)
+			}
+		} else if bindsX5C(body, verificationKey, chain) {
+			if t, err := verifier.Verify(); err != nil {
+				return err
 			} else {
-				th.dependencies[verificationKid] = append(th.dependencies[verificationKid], verifier)
+				t.Commitment = X5C_COMMITMENT
+				th.roots = append(th.roots, *t)
 			}
-			return nil
+		} else {
+			th.dependencies[verificationKid] = append(th.dependencies[verificationKid], verifier)
 		}
+		return nil
 	}
 }
 
+// Check whether the x5c certificate chain of a token binds its verification key
+// to its issuer. Chains of tokens without issuer are ignored.
+func bindsX5C(body jwt.Token, verificationKey jwk.Key, chain *cert.Chain) bool {
+	if iss, ok := body.Issuer(); !ok || chain == nil || !roots.HasX5CAnchors() {
+		return false
+	} else if err := roots.VerifyBindingX5C(iss, verificationKey, chain); err != nil {
+		log.Printf("%s: %s", ErrRootKeyUnbound, err)
+		return false
+	}
+	return true
+}
+
+// Add the endorsed key embedded in an endorsement to the key material, and
+// add all tokens that are pending on this key. The embedded key must match the
+// endorsed KID. Like all key material, the key is only trusted once the
+// endorsement was verified.
+func (th *TokenSet) addEmbeddedKey(body jwt.Token) error {
+	key, err := tokens.GetEndorsedKey(body)
+	if errors.Is(err, tokens.ErrNoEndorsedKey) || errors.Is(err, jwt.ClaimNotFoundError()) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	kid, err := tokens.GetKID(key)
+	if err != nil {
+		return err
+	} else if _, ok := th.keyMaterial.LookupKeyID(kid); ok {
+		return nil
+	} else if err := th.keyMaterial.AddKey(key); err != nil {
+		return err
+	}
+
+	pending := th.pending[kid]
+	delete(th.pending, kid)
+	for _, rawToken := range pending {
+		if err := th.AddToken(rawToken); err != nil {
+			th.errors = append(th.errors, err)
+		}
+	}
+	return nil
+}
+
 func (th *TokenSet) Verify(trustedKeys jwk.Set) ([]ADEMToken, []error) {
 	for _, r := range th.roots {
-		if kid, err := tokens.GetEndorsedKID(r.Token); err == nil {
+		if !r.IsEndorsement {
+			// Emblems signed by a root key endorse no further keys.
+			th.results = append(th.results, r)
+		} else if kid, err := tokens.GetEndorsedKID(r.Token); err == nil {
 			th.results = append(th.results, r)
 			th.setVerified(kid)
 		} else {
@@ -116,6 +268,10 @@ func (th *TokenSet) Verify(trustedKeys jwk.Set) ([]ADEMToken, []error) {
 		th.errors = append(th.errors, fmt.Errorf("could not validate verification key for %d token(s)", count))
 	}
 
+	for kid, pending := range th.pending {
+		th.errors = append(th.errors, fmt.Errorf("%w: %s for %d token(s)", ErrNoKeyFound, kid, len(pending)))
+	}
+
 	return th.results, th.errors
 }
 
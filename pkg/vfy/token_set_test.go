@@ -0,0 +1,412 @@
+package vfy
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/adem-wg/adem-proto/pkg/consts"
+	"github.com/adem-wg/adem-proto/pkg/gen"
+	"github.com/adem-wg/adem-proto/pkg/ident"
+	"github.com/adem-wg/adem-proto/pkg/roots"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/cert"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+	"github.com/lestrrat-go/jwx/v3/jws"
+	"github.com/lestrrat-go/jwx/v3/jwt"
+)
+
+func mkKey(t *testing.T) jwk.Key {
+	t.Helper()
+	key, err := tokens.GenerateKey(jwa.ES256())
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return key
+}
+
+func mkSigner(t *testing.T, key jwk.Key) gen.Signer {
+	t.Helper()
+	signer, err := gen.KeySigner(key)
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	return signer
+}
+
+// Return a set of the public keys of the given private keys.
+func mkKeySet(t *testing.T, keys ...jwk.Key) jwk.Set {
+	t.Helper()
+	set := jwk.NewSet()
+	for _, key := range keys {
+		if pk, err := key.PublicKey(); err != nil {
+			t.Fatalf("public key: %v", err)
+		} else if _, err := tokens.SetKID(pk, true); err != nil {
+			t.Fatalf("kid: %v", err)
+		} else if err := set.AddKey(pk); err != nil {
+			t.Fatalf("add key: %v", err)
+		}
+	}
+	return set
+}
+
+func mkEndorsement(t *testing.T, key jwk.Key, endorse jwk.Key, b *tokens.EndorsementBuilder, embedKey bool) []byte {
+	t.Helper()
+	if e, err := b.Build(); err != nil {
+		t.Fatalf("build endorsement: %v", err)
+	} else if token, err := e.Token(); err != nil {
+		t.Fatalf("endorsement token: %v", err)
+	} else if _, signed, err := gen.SignEndorsement(mkSigner(t, key), false, jwa.ES256(), token, endorse, jwa.ES256(), embedKey, 3600); err != nil {
+		t.Fatalf("sign endorsement: %v", err)
+	} else {
+		return signed
+	}
+	return nil
+}
+
+func mkEmblemToken(t *testing.T, iss string, assets ...string) jwt.Token {
+	t.Helper()
+	ais := make([]*ident.AI, 0, len(assets))
+	for _, asset := range assets {
+		if ai, err := ident.ParseAI(asset); err != nil {
+			t.Fatalf("parse AI: %v", err)
+		} else {
+			ais = append(ais, ai)
+		}
+	}
+
+	if e, err := tokens.BuildEmblem().WithIssuer(iss).WithAssets(ais...).Build(); err != nil {
+		t.Fatalf("build emblem: %v", err)
+	} else if token, err := e.Token(); err != nil {
+		t.Fatalf("emblem token: %v", err)
+	} else {
+		return token
+	}
+	return nil
+}
+
+// Sign an emblem for the given assets. If key is nil, the emblem is unsigned.
+func mkEmblem(t *testing.T, key jwk.Key, iss string, assets ...string) []byte {
+	t.Helper()
+	return signEmblem(t, key, mkEmblemToken(t, iss, assets...))
+}
+
+// Sign the given emblem. If key is nil, the emblem is unsigned.
+func signEmblem(t *testing.T, key jwk.Key, token jwt.Token) []byte {
+	t.Helper()
+	var signed []byte
+	var err error
+	if key == nil {
+		_, signed, err = gen.MkUnsignedEmblem(token, 3600)
+	} else {
+		_, signed, err = gen.SignEmblem(mkSigner(t, key), false, jwa.ES256(), token, 3600)
+	}
+	if err != nil {
+		t.Fatalf("sign emblem: %v", err)
+	}
+	return signed
+}
+
+// Verify the given tokens. Like [VerifyTokens], the token set's key material
+// comprises the untrusted and the trusted keys.
+func verifySet(t *testing.T, untrusted jwk.Set, trusted jwk.Set, rawTokens ...[]byte) ([]ADEMToken, []error) {
+	t.Helper()
+	tokens.AddSet(untrusted, trusted)
+	th := NewTokenSet(untrusted)
+	for _, rawToken := range rawTokens {
+		if err := th.AddToken(rawToken); err != nil {
+			th.errors = append(th.errors, err)
+		}
+	}
+	return th.Verify(trusted)
+}
+
+func TestCosignatureClaims(t *testing.T) {
+	k1, k2, endorsed := mkKey(t), mkKey(t), mkKey(t)
+	// Unknown logs cannot bind the first signer's key
+	logs := tokens.Log{{Ver: "v1", Id: "unknown"}}
+	b := tokens.BuildEndorsement().WithIssuer("https://a.example").WithLog(logs).WithEnd(true)
+	endorsement := mkEndorsement(t, k1, endorsed, b, false)
+
+	if _, err := gen.Cosign(endorsement, mkSigner(t, k2), false, jwa.ES256(), "", nil); !errors.Is(err, gen.ErrCosignNoIss) {
+		t.Fatalf("expected missing issuer, got %v", err)
+	}
+	cosigned, err := gen.Cosign(endorsement, mkSigner(t, k2), false, jwa.ES256(), "https://b.example", nil)
+	if err != nil {
+		t.Fatalf("cosign: %v", err)
+	}
+
+	results, errs := verifySet(t, mkKeySet(t, k1), mkKeySet(t, k2), cosigned)
+	if len(results) != 1 {
+		t.Fatalf("expected only the co-signature to verify, got %d tokens (%v)", len(results), errs)
+	} else if !errors.Is(errors.Join(errs...), ErrRootKeyUnbound) {
+		t.Errorf("expected first signature to be unbound, got %v", errs)
+	}
+
+	body := results[0].Token
+	if iss, _ := body.Issuer(); iss != "https://b.example" {
+		t.Errorf("expected co-signer's issuer, got %q", iss)
+	} else if body.Has("log") {
+		t.Error("co-signature must not inherit the first signer's log claim")
+	}
+}
+
+func TestCosignatureWithoutIssuer(t *testing.T) {
+	k1, k2, endorsed := mkKey(t), mkKey(t), mkKey(t)
+	b := tokens.BuildEndorsement().WithIssuer("https://a.example").WithEnd(true)
+	endorsement := mkEndorsement(t, k1, endorsed, b, false)
+
+	msg, err := jws.Parse(endorsement)
+	if err != nil {
+		t.Fatalf("parse endorsement: %v", err)
+	}
+	headers := jws.NewHeaders()
+	if kid, err := tokens.GetKID(k2); err != nil {
+		t.Fatal(err)
+	} else if err := headers.Set(jws.KeyIDKey, kid); err != nil {
+		t.Fatal(err)
+	} else if err := headers.Set(jws.ContentTypeKey, string(consts.EndorsementCty)); err != nil {
+		t.Fatal(err)
+	}
+	compact, err := jws.Sign(msg.Payload(), jws.WithKey(jwa.ES256(), k2, jws.WithProtectedHeaders(headers)))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	general, err := tokens.ParseGeneralJWS(endorsement)
+	if err != nil {
+		t.Fatal(err)
+	} else if err := general.AddCompact(compact); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(general)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	th := NewTokenSet(jwk.NewSet())
+	if err := th.AddToken(raw); !errors.Is(err, ErrCosignatureNoIss) {
+		t.Errorf("expected co-signature without issuer to be rejected, got %v", err)
+	}
+}
+
+// Generate a signing key with an x5c certificate chain that binds the key to
+// example.com. The self-signed certificate is configured as trust anchor.
+func mkX5CKey(t *testing.T) jwk.Key {
+	t.Helper()
+	key := mkKey(t)
+	var sk ecdsa.PrivateKey
+	if err := jwk.Export(key, &sk); err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "example.com"},
+		DNSNames:              []string{"example.com"},
+		NotBefore:             time.Now().Add(-time.Minute),
+		NotAfter:              time.Now().Add(time.Hour),
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &sk.PublicKey, &sk)
+	if err != nil {
+		t.Fatal(err)
+	} else if c, err := x509.ParseCertificate(der); err != nil {
+		t.Fatal(err)
+	} else {
+		roots.AddX5CAnchor(c)
+	}
+
+	chain := &cert.Chain{}
+	if err := chain.AddString(base64.StdEncoding.EncodeToString(der)); err != nil {
+		t.Fatal(err)
+	} else if err := tokens.SetX5C(key, chain); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestX5CFallback(t *testing.T) {
+	t.Cleanup(roots.ResetX5CAnchors)
+	key := mkX5CKey(t)
+
+	tests := []struct {
+		iss        string
+		trusted    jwk.Set
+		verified   bool
+		commitment Commitment
+	}{
+		{"https://example.com", jwk.NewSet(), true, X5C_COMMITMENT},
+		// Chains that do not bind the key are ignored
+		{"https://example.org", mkKeySet(t, key), true, NO_COMMITMENT},
+		{"https://example.org", jwk.NewSet(), false, NO_COMMITMENT},
+	}
+	for _, test := range tests {
+		emblem := mkEmblem(t, key, test.iss, "example.com")
+		results, errs := verifySet(t, jwk.NewSet(), test.trusted, emblem)
+		if !test.verified {
+			if len(results) != 0 {
+				t.Errorf("%s: expected emblem not to verify", test.iss)
+			}
+		} else if len(results) != 1 {
+			t.Errorf("%s: expected emblem to verify, got %v", test.iss, errs)
+		} else if results[0].Commitment != test.commitment {
+			t.Errorf("%s: expected commitment %q, got %q", test.iss, test.commitment, results[0].Commitment)
+		}
+	}
+}
+
+func TestEmbeddedKey(t *testing.T) {
+	root, emblemKey, other := mkKey(t), mkKey(t), mkKey(t)
+	emblem := mkEmblem(t, emblemKey, "", "example.com")
+	embedding := mkEndorsement(t, root, emblemKey, tokens.BuildEndorsement(), true)
+	kid, err := tokens.GetKID(emblemKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Tokens signed by unknown keys are pending until an endorsement embeds the
+	// key.
+	th := NewTokenSet(mkKeySet(t, root))
+	if err := th.AddToken(emblem); err != nil {
+		t.Fatalf("add emblem: %v", err)
+	} else if len(th.pending[kid]) != 1 {
+		t.Fatalf("expected emblem to be pending on %s", kid)
+	} else if err := th.AddToken(embedding); err != nil {
+		t.Fatalf("add endorsement: %v", err)
+	} else if len(th.pending) != 0 {
+		t.Errorf("expected no pending tokens, got %v", th.pending)
+	}
+	if results, errs := th.Verify(mkKeySet(t, root)); len(results) != 2 || len(errs) != 0 {
+		t.Errorf("expected emblem and endorsement to verify, got %d tokens (%v)", len(results), errs)
+	}
+
+	// Embedded keys must match the endorsed KID
+	b := tokens.BuildEndorsement()
+	if e, err := b.Build(); err != nil {
+		t.Fatal(err)
+	} else if token, err := e.Token(); err != nil {
+		t.Fatal(err)
+	} else if pk, err := other.PublicKey(); err != nil {
+		t.Fatal(err)
+	} else if err := token.Set("jwk", tokens.EmbeddedKey{Key: pk}); err != nil {
+		t.Fatal(err)
+	} else if _, mismatch, err := gen.SignEndorsement(mkSigner(t, root), false, jwa.ES256(), token, emblemKey, jwa.ES256(), false, 3600); err != nil {
+		t.Fatalf("sign endorsement: %v", err)
+	} else {
+		th := NewTokenSet(mkKeySet(t, root))
+		if err := th.AddToken(mismatch); !errors.Is(err, tokens.ErrEndorsedKeyMismatch) {
+			t.Errorf("expected key mismatch, got %v", err)
+		}
+	}
+}
+
+func TestUnsignedEndorsement(t *testing.T) {
+	payload, err := json.Marshal(map[string]any{"ver": string(consts.V1), "key": "kid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers := jws.NewHeaders()
+	if err := headers.Set(jws.ContentTypeKey, string(consts.EndorsementCty)); err != nil {
+		t.Fatal(err)
+	}
+	unsigned, err := jws.Sign(payload, jws.WithInsecureNoSignature(jws.WithProtectedHeaders(headers)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	th := NewTokenSet(jwk.NewSet())
+	if err := th.AddToken(unsigned); !errors.Is(err, ErrUnsignedEndorsement) {
+		t.Errorf("expected unsigned endorsement to be rejected, got %v", err)
+	}
+}
+
+// Check that errs contains an error that matches target.
+func containsErr(errs []error, target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCriticalClaims(t *testing.T) {
+	if err := tokens.RegisterClaim(tokens.ClaimExtension{Name: "x-contact", Critical: true}); err != nil {
+		t.Fatalf("register: %v", err)
+	}
+	t.Cleanup(func() { tokens.UnregisterClaim("x-contact") })
+
+	key := mkKey(t)
+	emblem := mkEmblemToken(t, "", "example.com")
+	if err := emblem.Set("x-contact", "ops@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	signed := signEmblem(t, key, emblem)
+	_, signedCOSE, err := gen.SignEmblemCOSE(mkSigner(t, key), jwa.ES256(), emblem, 3600)
+	if err != nil {
+		t.Fatalf("sign emblem: %v", err)
+	}
+
+	if msg, err := jws.Parse(signed); err != nil {
+		t.Fatal(err)
+	} else if crit, _ := msg.Signatures()[0].ProtectedHeaders().Critical(); len(crit) != 1 || crit[0] != tokens.CriticalHeader {
+		t.Errorf("expected crit header [%s], got %v", tokens.CriticalHeader, crit)
+	}
+
+	for _, raw := range [][]byte{signed, signedCOSE} {
+		if results, errs := verifySet(t, jwk.NewSet(), mkKeySet(t, key), raw); len(errs) > 0 || len(results) != 1 {
+			t.Errorf("expected emblem with understood critical claim to verify, got %v", errs)
+		}
+	}
+
+	tokens.UnregisterClaim("x-contact")
+	for _, raw := range [][]byte{signed, signedCOSE} {
+		if _, errs := verifySet(t, jwk.NewSet(), mkKeySet(t, key), raw); !containsErr(errs, tokens.ErrUnknownCriticalClaim) {
+			t.Errorf("expected unknown critical claim to be rejected, got %v", errs)
+		}
+	}
+}
+
+func TestUnknownCriticalHeader(t *testing.T) {
+	key := mkKey(t)
+	emblem, _, err := gen.MkUnsignedEmblem(mkEmblemToken(t, "", "example.com"), 3600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := json.Marshal(emblem)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headers := jws.NewHeaders()
+	if kid, err := tokens.GetKID(key); err != nil {
+		t.Fatal(err)
+	} else if err := headers.Set(jws.KeyIDKey, kid); err != nil {
+		t.Fatal(err)
+	} else if err := headers.Set(jws.ContentTypeKey, string(consts.EmblemCty)); err != nil {
+		t.Fatal(err)
+	} else if err := headers.Set("x-foo", 1); err != nil {
+		t.Fatal(err)
+	} else if err := headers.Set(jws.CriticalKey, []string{"x-foo"}); err != nil {
+		t.Fatal(err)
+	}
+	signed, err := jws.Sign(payload, jws.WithKey(jwa.ES256(), key, jws.WithProtectedHeaders(headers)))
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+
+	if _, errs := verifySet(t, jwk.NewSet(), mkKeySet(t, key), signed); !containsErr(errs, ErrUnknownCriticalHeader) {
+		t.Errorf("expected unknown critical header to be rejected, got %v", errs)
+	}
+}
@@ -1,11 +1,15 @@
 package vfy
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
 
+	"github.com/adem-wg/adem-proto/pkg/cose"
 	"github.com/adem-wg/adem-proto/pkg/ident"
 	"github.com/adem-wg/adem-proto/pkg/tokens"
 	"github.com/adem-wg/adem-proto/pkg/util"
@@ -20,39 +24,163 @@ var ErrRootKeyUnbound = errors.New("root key not properly committed")
 var ErrLogsEmpty = errors.New("logs field cannot be empty")
 var ErrNoIss = errors.New("issuer claim missing")
 var ErrTokenNonCompact = errors.New("token is not in compact serialization")
+var ErrUnsignedEndorsement = errors.New("endorsements must be signed")
+var ErrUnsignedSignature = errors.New("unsigned token carries signature")
+var ErrCosignatureNoIss = errors.New("co-signature does not state its issuer")
+var ErrEmblemsIssuer = errors.New("emblems state different issuers")
+var ErrEmblemsKey = errors.New("emblems are signed by different keys")
+var ErrEmblemsUnsigned = errors.New("emblems mix signed and unsigned emblems")
+var ErrUnknownCriticalHeader = errors.New("unknown critical header")
+var ErrCriticalHeaderMissing = errors.New("critical header missing")
 
 type VerificationResults struct {
 	results    []VerificationResult
-	protected  []*ident.AI
+	protected  ident.AssetSet
 	issuer     string
 	endorsedBy []string
+	commitment Commitment
+	extensions map[string]any
+	// Endorsements that the security levels are based on
+	endorsements []ADEMToken
+	// Results of the individual emblems, if the token set holds several
+	// emblems (see [VerifyTokens]).
+	emblems []VerificationResults
 }
 
 func ResultInvalid() VerificationResults {
 	return VerificationResults{results: []VerificationResult{INVALID}}
 }
 
+// Return the security levels of a token set. For token sets with several
+// emblems, these are the security levels shared by all valid emblems (see
+// [VerificationResults.ResultsFor]).
+func (res VerificationResults) Results() []VerificationResult {
+	return res.results
+}
+
+// Return the security levels with which the given asset is protected. Returns
+// nil if the asset is not protected.
+func (res VerificationResults) ResultsFor(asset *ident.AI) []VerificationResult {
+	if res.emblems == nil {
+		if res.Protects(asset) {
+			return res.results
+		}
+		return nil
+	}
+
+	var results []VerificationResult
+	for _, part := range res.emblems {
+		for _, r := range part.ResultsFor(asset) {
+			if !util.Contains(results, r) {
+				results = append(results, r)
+			}
+		}
+	}
+	slices.Sort(results)
+	return results
+}
+
+// Check whether the verified emblem protects the given asset, e.g., a
+// concrete address and port that was observed. Invalid token sets protect
+// nothing.
+func (res VerificationResults) Protects(asset *ident.AI) bool {
+	if util.Contains(res.results, INVALID) {
+		return false
+	}
+	return res.protected.Covers(asset)
+}
+
+// Check whether the security levels are based on the given endorsement, i.e.,
+// whether it verified and is part of the emblem's chain of endorsements. For
+// endorsements with several signatures, all signatures must be part of the
+// chain.
+func (res VerificationResults) Joins(rawEndorsement []byte) bool {
+	signatures := [][]byte{rawEndorsement}
+	if !cose.IsCOSE(rawEndorsement) {
+		if general, err := tokens.ParseGeneralJWS(rawEndorsement); err != nil {
+			return false
+		} else {
+			signatures = general.Compact()
+		}
+	}
+
+	for _, sig := range signatures {
+		if !slices.ContainsFunc(res.allEndorsements(), func(t ADEMToken) bool {
+			return bytes.Equal(bytes.TrimSpace(t.Raw), bytes.TrimSpace(sig))
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+func (res VerificationResults) allEndorsements() []ADEMToken {
+	endorsements := slices.Clone(res.endorsements)
+	for _, part := range res.emblems {
+		endorsements = append(endorsements, part.allEndorsements()...)
+	}
+	return endorsements
+}
+
+// Return how the root key of the emblem's issuer is bound to the issuer.
+func (res VerificationResults) Commitment() Commitment {
+	return res.commitment
+}
+
 func (res VerificationResults) Print() {
+	if res.emblems != nil {
+		res.printMerged()
+		return
+	}
+
 	lns := []string{"Verified set of tokens. Results:"}
+	lns = append(lns, res.describeLevels())
+	if len(res.protected) > 0 {
+		lns = append(lns, fmt.Sprintf("- Protected assets:   %s", res.protected.MinimalCover()))
+	}
+	lns = append(lns, res.describe()...)
+	log.Print(strings.Join(lns, "\n"))
+}
+
+func (res VerificationResults) describeLevels() string {
 	resultsStrs := make([]string, 0, len(res.results))
 	for _, r := range res.results {
 		resultsStrs = append(resultsStrs, r.String())
 	}
-	lns = append(lns, fmt.Sprintf("- Security levels:    %s", strings.Join(resultsStrs, ", ")))
-	if len(res.protected) > 0 {
-		assets := make([]string, 0, len(res.protected))
-		for _, asset := range res.protected {
-			assets = append(assets, asset.String())
-		}
-		lns = append(lns, fmt.Sprintf("- Protected assets:   %s", strings.Join(assets, ", ")))
-	}
+	return fmt.Sprintf("- Security levels:    %s", strings.Join(resultsStrs, ", "))
+}
+
+// Describe the issuer, root key commitment, endorsements, and extension claims
+// of the verified emblem.
+func (res VerificationResults) describe() []string {
+	lns := []string{}
 	if res.issuer != "" {
 		lns = append(lns, fmt.Sprintf("- Issuer of emblem:   %s", res.issuer))
 	}
+	if res.commitment != NO_COMMITMENT {
+		lns = append(lns, fmt.Sprintf("- Root key bound by:  %s", res.commitment))
+	}
 	if len(res.endorsedBy) > 0 {
 		lns = append(lns, fmt.Sprintf("- Issuer endorsed by: %s", strings.Join(res.endorsedBy, ", ")))
 	}
-	log.Print(strings.Join(lns, "\n"))
+	if len(res.extensions) > 0 {
+		names := make([]string, 0, len(res.extensions))
+		for name := range res.extensions {
+			names = append(names, name)
+		}
+		slices.Sort(names)
+
+		claims := make([]string, 0, len(names))
+		for _, name := range names {
+			if bs, err := json.Marshal(res.extensions[name]); err != nil {
+				claims = append(claims, fmt.Sprintf("%s=%v", name, res.extensions[name]))
+			} else {
+				claims = append(claims, fmt.Sprintf("%s=%s", name, bs))
+			}
+		}
+		lns = append(lns, fmt.Sprintf("- Extension claims:   %s", strings.Join(claims, ", ")))
+	}
+	return lns
 }
 
 type VerificationResult byte
@@ -89,6 +217,24 @@ const SIGNED_TRUSTED VerificationResult = 5
 const ORGANIZATIONAL_TRUSTED VerificationResult = 6
 const ENDORSED_TRUSTED VerificationResult = 7
 
+// Evidence that binds a root key to its issuer's OI.
+type Commitment byte
+
+func (c Commitment) String() string {
+	switch c {
+	case CT_COMMITMENT:
+		return "Certificate Transparency"
+	case X5C_COMMITMENT:
+		return "X.509 certificate chain"
+	default:
+		return ""
+	}
+}
+
+const NO_COMMITMENT Commitment = 0
+const CT_COMMITMENT Commitment = 1
+const X5C_COMMITMENT Commitment = 2
+
 func filterKeys(rawTokens [][]byte) ([][]byte, jwk.Set) {
 	remaining := make([][]byte, 0)
 	keys := jwk.NewSet()
@@ -99,6 +245,10 @@ func filterKeys(rawTokens [][]byte) ([][]byte, jwk.Set) {
 			} else {
 				keys.AddKey(key)
 			}
+		} else if cose.IsCOSE(t) {
+			remaining = append(remaining, t)
+		} else if key, err := cose.ParseKey(t); err == nil {
+			keys.AddKey(key)
 		} else {
 			remaining = append(remaining, t)
 		}
@@ -107,9 +257,14 @@ func filterKeys(rawTokens [][]byte) ([][]byte, jwk.Set) {
 	return remaining, keys
 }
 
-// Verify a slice of ADEM tokens.
+// Verify a slice of ADEM tokens. If the tokens contain several emblems, e.g.,
+// because the assets were split over several emblems to fit a size budget,
+// every emblem is evaluated together with the other tokens on its own. Their
+// results are then merged per asset. Endorsements and keys are verified only
+// once for all emblems. Token sets with several emblems are invalid unless all
+// emblems state the same issuer and are either all signed by the same key or
+// all unsigned.
 func VerifyTokens(rawTokens [][]byte, trustedKeys jwk.Set) VerificationResults {
-
 	// Early termination for empty rawTokens slice
 	if len(rawTokens) == 0 {
 		return ResultInvalid()
@@ -120,6 +275,49 @@ func VerifyTokens(rawTokens [][]byte, trustedKeys jwk.Set) VerificationResults {
 		trustedKeys = jwk.NewSet()
 	}
 
+	rawEmblems := filterEmblems(rawTokens)
+	if len(rawEmblems) > 1 {
+		if err := checkSplitEmblems(rawEmblems); err != nil {
+			log.Printf("token set contains multiple emblems that are not parts of one emblem: %s", err)
+			return ResultInvalid()
+		}
+	}
+
+	emblems := []ADEMToken{}
+	endorsements := []ADEMToken{}
+	for _, t := range verifyTokenSet(rawTokens, trustedKeys) {
+		if t.IsEndorsement {
+			endorsements = append(endorsements, t)
+		} else {
+			emblems = append(emblems, t)
+		}
+	}
+
+	if len(emblems) == 0 {
+		log.Print("no emblem found")
+		return ResultInvalid()
+	} else if len(emblems) > max(len(rawEmblems), 1) {
+		log.Print("Token set contains multiple emblems")
+		return ResultInvalid()
+	} else if len(rawEmblems) <= 1 {
+		return verifyEmblem(emblems[0], endorsements, trustedKeys)
+	}
+
+	parts := make([]VerificationResults, 0, len(rawEmblems))
+	for i, emblem := range emblems {
+		log.Printf("evaluating emblem %d of %d", i+1, len(rawEmblems))
+		parts = append(parts, verifyEmblem(emblem, endorsements, trustedKeys))
+	}
+	// Emblems that did not verify
+	for range len(rawEmblems) - len(emblems) {
+		parts = append(parts, ResultInvalid())
+	}
+	return mergeResults(parts)
+}
+
+// Verify the signatures of a slice of ADEM tokens and return the verified
+// tokens.
+func verifyTokenSet(rawTokens [][]byte, trustedKeys jwk.Set) []ADEMToken {
 	tokensNoKeys, untrustedKeys := filterKeys(rawTokens)
 	tokens.AddSet(untrustedKeys, trustedKeys)
 
@@ -138,45 +336,46 @@ func VerifyTokens(rawTokens [][]byte, trustedKeys jwk.Set) VerificationResults {
 			log.Print(err)
 		}
 	}
+	return verifiedTokens
+}
 
-	var emblem *ADEMToken
-	var protected tokens.Assets // TODO: fix missing assignment
-	endorsements := []ADEMToken{}
-	for _, t := range verifiedTokens {
-		if t.IsEndorsement {
-			endorsements = append(endorsements, t)
-		} else if emblem == nil {
-			emblem = &t
-			if err := emblem.Token.Get("assets", &protected); err != nil {
-				if errors.Is(err, jwt.ClaimNotFoundError()) {
-					log.Printf("No assets claim")
-				} else {
-					log.Printf("Could not access assets claim: %s", err)
-				}
-				return ResultInvalid()
-			}
+// Determine the security levels of a verified emblem, given the verified
+// endorsements of its token set.
+func verifyEmblem(emblem ADEMToken, endorsements []ADEMToken, trustedKeys jwk.Set) VerificationResults {
+	var protected tokens.Assets
+	if err := emblem.Token.Get("assets", &protected); err != nil {
+		if errors.Is(err, jwt.ClaimNotFoundError()) {
+			log.Printf("No assets claim")
 		} else {
-			// Multiple emblems
-			log.Print("Token set contains multiple emblems")
-			return ResultInvalid()
+			log.Printf("Could not access assets claim: %s", err)
 		}
+		return ResultInvalid()
 	}
 
-	if emblem == nil {
-		log.Print("no emblem found")
-		return ResultInvalid()
+	// Endorsements cannot vouch for unsigned emblems. Hence, they must never
+	// raise the security level of an unsigned emblem.
+	if emblem.Unsigned {
+		if len(endorsements) > 0 {
+			log.Printf("ignoring %d endorsement(s) of unsigned emblem", len(endorsements))
+		}
+		return VerificationResults{
+			results:    []VerificationResult{UNSIGNED},
+			protected:  ident.AssetSet(protected),
+			extensions: tokens.ExtensionClaims(emblem.Token),
+		}
 	}
 
-	vfyResults, root := verifySignedOrganizational(*emblem, endorsements, trustedKeys)
+	vfyResults, root, chain := verifySignedOrganizational(emblem, endorsements, trustedKeys)
 	if util.Contains(vfyResults, INVALID) {
 		return ResultInvalid()
 	}
 
 	var endorsedResults []VerificationResult
 	var endorsedBy []string
+	var endorsing []ADEMToken
 
 	if util.Contains(vfyResults, ORGANIZATIONAL) {
-		endorsedResults, endorsedBy = verifyEndorsed(*emblem, *root, endorsements, trustedKeys)
+		endorsedResults, endorsedBy, endorsing = verifyEndorsed(emblem, *root, endorsements, trustedKeys)
 	}
 
 	if util.Contains(endorsedResults, INVALID) {
@@ -185,9 +384,12 @@ func VerifyTokens(rawTokens [][]byte, trustedKeys jwk.Set) VerificationResults {
 
 	iss, _ := root.Token.Issuer()
 	return VerificationResults{
-		results:    append(vfyResults, endorsedResults...),
-		issuer:     iss,
-		endorsedBy: endorsedBy,
-		protected:  protected,
+		results:      append(vfyResults, endorsedResults...),
+		issuer:       iss,
+		endorsedBy:   endorsedBy,
+		commitment:   root.Commitment,
+		protected:    ident.AssetSet(protected),
+		extensions:   tokens.ExtensionClaims(emblem.Token),
+		endorsements: append(chain, endorsing...),
 	}
 }
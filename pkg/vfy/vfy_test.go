@@ -0,0 +1,74 @@
+package vfy
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"github.com/adem-wg/adem-proto/pkg/cose"
+	"github.com/adem-wg/adem-proto/pkg/gen"
+	"github.com/adem-wg/adem-proto/pkg/tokens"
+	"github.com/lestrrat-go/jwx/v3/jwa"
+	"github.com/lestrrat-go/jwx/v3/jwk"
+)
+
+func mkEmblemCOSE(t *testing.T, key jwk.Key, assets ...string) []byte {
+	t.Helper()
+	_, signed, err := gen.SignEmblemCOSE(mkSigner(t, key), jwa.ES256(), mkEmblemToken(t, "", assets...), 3600)
+	if err != nil {
+		t.Fatalf("sign emblem: %v", err)
+	}
+	return signed
+}
+
+// Encode the public key of the given private key as JWK.
+func mkKeyJSON(t *testing.T, key jwk.Key) []byte {
+	t.Helper()
+	if pk, err := key.PublicKey(); err != nil {
+		t.Fatalf("public key: %v", err)
+	} else if bs, err := json.Marshal(pk); err != nil {
+		t.Fatalf("marshal key: %v", err)
+	} else {
+		return bs
+	}
+	return nil
+}
+
+func TestVerifyTokens(t *testing.T) {
+	root, emblemKey, other := mkKey(t), mkKey(t), mkKey(t)
+	endorsement := mkEndorsement(t, root, emblemKey, tokens.BuildEndorsement(), false)
+	embedding := mkEndorsement(t, root, emblemKey, tokens.BuildEndorsement(), true)
+	unsigned := mkEmblem(t, nil, "", "example.com")
+	// Unsigned emblem with the signature of a signed one
+	signed := mkEmblem(t, emblemKey, "", "example.com")
+	withSig := append(slices.Clone(unsigned), signed[bytes.LastIndexByte(signed, '.')+1:]...)
+
+	tests := []struct {
+		name     string
+		tokens   [][]byte
+		trusted  jwk.Set
+		expected []VerificationResult
+	}{
+		{"unsigned", [][]byte{unsigned}, nil, []VerificationResult{UNSIGNED}},
+		{"unsigned endorsed", [][]byte{unsigned, endorsement}, mkKeySet(t, root), []VerificationResult{UNSIGNED}},
+		{"unsigned with signature", [][]byte{withSig}, nil, []VerificationResult{INVALID}},
+		{"unsigned and signed emblem", [][]byte{signed, mkEmblem(t, nil, "", "example.com")}, mkKeySet(t, emblemKey), []VerificationResult{INVALID}},
+		{"signed untrusted", [][]byte{signed}, mkKeySet(t, other), []VerificationResult{INVALID}},
+		{"signed trusted", [][]byte{signed}, mkKeySet(t, emblemKey), []VerificationResult{SIGNED, SIGNED_TRUSTED}},
+		{"endorsed key", [][]byte{signed, endorsement, mkKeyJSON(t, emblemKey)}, mkKeySet(t, root), []VerificationResult{SIGNED, SIGNED_TRUSTED}},
+		{"embedded key", [][]byte{signed, embedding}, mkKeySet(t, root), []VerificationResult{SIGNED, SIGNED_TRUSTED}},
+		{"missing key", [][]byte{signed, endorsement}, mkKeySet(t, root), []VerificationResult{INVALID}},
+		{"cose", [][]byte{mkEmblemCOSE(t, emblemKey, "example.com")}, mkKeySet(t, emblemKey), []VerificationResult{SIGNED, SIGNED_TRUSTED}},
+		{"cose embedded key", [][]byte{cose.EncodeText(mkEmblemCOSE(t, emblemKey, "example.com")), embedding}, mkKeySet(t, root), []VerificationResult{SIGNED, SIGNED_TRUSTED}},
+		{"cose unknown kid", [][]byte{mkEmblemCOSE(t, emblemKey, "example.com")}, mkKeySet(t, other), []VerificationResult{INVALID}},
+	}
+	for _, test := range tests {
+		res := VerifyTokens(test.tokens, test.trusted)
+		if !slices.Equal(res.Results(), test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, res.Results())
+		} else if !slices.Contains(test.expected, INVALID) && !res.Protects(mustParseAI(t, "example.com")) {
+			t.Errorf("%s: expected example.com to be protected", test.name)
+		}
+	}
+}